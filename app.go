@@ -8,21 +8,71 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 )
 
 // App struct
 type App struct {
 	ctx            context.Context
+	paths          Paths          // Where profiles and images are stored (see paths.go)
+	mu             sync.RWMutex   // Guards profileManager; bound methods may be called concurrently
 	profileManager ProfileManager
+	pendingEvents  []pendingEvent // Events queued while mu is held, emitted by unlock
+	
+	diagnostics      StartupDiagnostics // What loading repaired or quarantined (see recovery.go)
+	loadedMonolithic bool               // Profiles came from the single-file profiles.json
+	
+	// Background saving (see persist.go and storage.go)
+	dirty             bool             // Profile state changed since the last successful write
+	dirtyProfiles     map[string]bool  // Loaded profiles whose files need rewriting
+	deletedProfiles   map[string]bool  // Profiles whose files need removing
+	profileLoadErrors map[string]error // Profiles whose files failed to load; never overwritten
+	writeMu           sync.Mutex       // Serializes profile file writes
+	saveSignal chan struct{} // Wakes the save loop when state becomes dirty
+	saveStop   chan struct{} // Closed on shutdown to stop the save loop
+	saveDone   chan struct{} // Closed when the save loop has exited
+	
+	// External change detection (see watcher.go)
+	knownFiles       map[string]fileStamp       // Last seen version of each watched file; guarded by writeMu
+	watching         bool                       // The initial scan has run; guarded by writeMu
+	profileConflicts map[string]ProfileConflict // External changes refused because of unsaved edits
+	watchStop        chan struct{}              // Closed on shutdown to stop the watcher
+	watchDone        chan struct{}              // Closed when the watcher has exited
+	
+	syncEnabled bool // Saves are committed to git (see sync.go); guarded by writeMu
+	
+	profileMerges map[string]*ProfileMerge // Merges waiting for their conflicts to be resolved (see merge.go)
+	keyClipboard  []ClipboardKey           // Keys copied with CopyKeys (see clipboard.go)
 }
 
-// NewApp creates a new App application struct
-func NewApp() *App {
-	app := &App{}
+// NewApp creates a new App application struct.
+// dataDir overrides where all data is stored; when empty the platform default is used.
+func NewApp(dataDir string) *App {
+	app := &App{
+		dirtyProfiles:     make(map[string]bool),
+		deletedProfiles:   make(map[string]bool),
+		profileLoadErrors: make(map[string]error),
+		saveSignal:        make(chan struct{}, 1),
+		saveStop:          make(chan struct{}),
+		saveDone:          make(chan struct{}),
+		knownFiles:        make(map[string]fileStamp),
+		profileConflicts:  make(map[string]ProfileConflict),
+		watchStop:         make(chan struct{}),
+		watchDone:         make(chan struct{}),
+		profileMerges:     make(map[string]*ProfileMerge),
+	}
+	
+	// Resolve the storage location and bring data over from the old location once
+	paths, err := resolvePaths(dataDir)
+	if err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+	app.paths = paths
+	app.migrateLegacyDir()
 	
 	// Try to load existing profile configuration
-	if err := app.LoadProfiles(); err != nil {
+	if err := app.loadProfiles(); err != nil {
 		fmt.Printf("Warning: Failed to load profiles, creating default: %v\n", err)
 		
 		// Try to load legacy config for migration
@@ -40,6 +90,7 @@ func NewApp() *App {
 		} else {
 			// Create fresh default profile
 			fmt.Println("Creating fresh default profile...")
+			app.diagnostics.Mode = "fresh"
 			defaultProfile := NewProfile("Default")
 			
 			app.profileManager = ProfileManager{
@@ -48,24 +99,50 @@ func NewApp() *App {
 				LastModified:  time.Now(),
 			}
 		}
+		app.markAllProfilesDirty()
 	}
 	
-	// Save the profile configuration
-	if err := app.SaveProfiles(); err != nil {
+	// Commit saves if git sync was turned on in an earlier session
+	app.loadSyncSettings()
+	
+	// Save anything created or repaired while loading
+	if err := app.writePendingProfiles(); err != nil {
 		fmt.Printf("Warning: Failed to save initial profiles: %v\n", err)
+	} else if app.loadedMonolithic {
+		app.retireMonolithicProfiles()
 	}
 	
+	// Start the background writer that coalesces later saves
+	app.startSaveLoop()
+	
+	// Pick up edits made to the profile files by other programs
+	app.startWatcher()
+	
 	return app
 }
 
 // startup is called when the app starts. The context is saved
 // so we can call the runtime methods
 func (a *App) startup(ctx context.Context) {
+	a.mu.Lock()
 	a.ctx = ctx
+	a.mu.Unlock()
+}
+
+// shutdown is called when the app is closing. Pending profile changes are flushed to disk.
+func (a *App) shutdown(ctx context.Context) {
+	a.stopWatcher()
+	a.stopSaveLoop()
+	if err := a.writePendingProfiles(); err != nil {
+		fmt.Printf("Warning: Failed to save profiles on shutdown: %v\n", err)
+	}
 }
 
 // GetCurrentLayout returns the current keyboard layout
 func (a *App) GetCurrentLayout() (string, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	
 	activeProfile := a.profileManager.GetActiveProfile()
 	if activeProfile == nil {
 		return "", fmt.Errorf("no active profile available")
@@ -81,6 +158,9 @@ func (a *App) GetCurrentLayout() (string, error) {
 
 // GetCurrentLayer returns the keys for the current layer and active modifiers
 func (a *App) GetCurrentLayer() (string, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	
 	activeProfile := a.profileManager.GetActiveProfile()
 	if activeProfile == nil {
 		return "", fmt.Errorf("no active profile available")
@@ -107,6 +187,9 @@ func (a *App) GetCurrentLayer() (string, error) {
 
 // SetCurrentLayer changes the active layer
 func (a *App) SetCurrentLayer(layerName string) error {
+	a.lock()
+	defer a.unlock()
+	
 	activeProfile := a.profileManager.GetActiveProfile()
 	if activeProfile == nil {
 		return fmt.Errorf("no active profile available")
@@ -120,15 +203,21 @@ func (a *App) SetCurrentLayer(layerName string) error {
 	if _, exists := currentLayout.Layers[layerName]; exists {
 		activeProfile.CurrentLayer = layerName
 		activeProfile.ModifiedAt = time.Now()
+		a.notifyLayerChanged(activeProfile, "layer")
 		// Save profiles after layer change
-		return a.SaveProfiles()
+		a.requestSave(activeProfile.ID)
+		return nil
 	}
 	
 	return fmt.Errorf("layer %s does not exist", layerName)
 }
 
-// GetAvailableLayers returns all available layer names
+// GetAvailableLayers returns the layers of the current layout in display order,
+// each with its display settings
 func (a *App) GetAvailableLayers() (string, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	
 	activeProfile := a.profileManager.GetActiveProfile()
 	if activeProfile == nil {
 		return "", fmt.Errorf("no active profile available")
@@ -139,7 +228,7 @@ func (a *App) GetAvailableLayers() (string, error) {
 		return "", fmt.Errorf("no current layout available in profile")
 	}
 	
-	layers := currentLayout.GetLayerNames()
+	layers := currentLayout.GetLayerDetails()
 	data, err := json.MarshalIndent(layers, "", "  ")
 	if err != nil {
 		return "", err
@@ -154,6 +243,9 @@ func (a *App) UpdateKey(keyData string) error {
 		return fmt.Errorf("invalid key data: %v", err)
 	}
 	
+	a.lock()
+	defer a.unlock()
+	
 	activeProfile := a.profileManager.GetActiveProfile()
 	if activeProfile == nil {
 		return fmt.Errorf("no active profile available")
@@ -164,10 +256,17 @@ func (a *App) UpdateKey(keyData string) error {
 		return fmt.Errorf("no current layout available in profile")
 	}
 	
+	// A color that differs from the key's category color is an explicit override
+	syncCategoryColor(&key, activeProfile)
+	// Overlay images sent in the description's old JSON format become legends
+	migrateOverlayLegends(&key)
+	
 	if currentLayout.UpdateKey(activeProfile.CurrentLayer, key) {
 		activeProfile.ModifiedAt = time.Now()
-		// Force immediate save
-		return a.SaveProfiles()
+		a.notifyKeyUpdated(activeProfile, activeProfile.CurrentLayer, nil, key)
+		// Queue a save; the background writer coalesces rapid edits
+		a.requestSave(activeProfile.ID)
+		return nil
 	}
 	
 	return fmt.Errorf("failed to update key %s", key.ID)
@@ -180,6 +279,9 @@ func (a *App) SetActiveModifiers(modifiersJSON string) error {
 		return fmt.Errorf("invalid modifiers data: %v", err)
 	}
 	
+	a.lock()
+	defer a.unlock()
+	
 	activeProfile := a.profileManager.GetActiveProfile()
 	if activeProfile == nil {
 		return fmt.Errorf("no active profile available")
@@ -187,12 +289,17 @@ func (a *App) SetActiveModifiers(modifiersJSON string) error {
 	
 	activeProfile.ActiveModifiers = modifiers
 	activeProfile.ModifiedAt = time.Now()
+	a.notifyLayerChanged(activeProfile, "modifiers")
 	// Save profiles after modifier change
-	return a.SaveProfiles()
+	a.requestSave(activeProfile.ID)
+	return nil
 }
 
 // GetActiveModifiers returns the currently active modifier keys
 func (a *App) GetActiveModifiers() (string, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	
 	activeProfile := a.profileManager.GetActiveProfile()
 	if activeProfile == nil {
 		return "", fmt.Errorf("no active profile available")
@@ -221,6 +328,9 @@ func (a *App) AddCustomLayer(layerName string) error {
 		return fmt.Errorf("layer name cannot be empty")
 	}
 	
+	a.lock()
+	defer a.unlock()
+	
 	activeProfile := a.profileManager.GetActiveProfile()
 	if activeProfile == nil {
 		return fmt.Errorf("no active profile available")
@@ -308,15 +418,17 @@ func (a *App) AddCustomLayer(layerName string) error {
 	} else {
 		fmt.Printf("ERROR: Layer '%s' was not found in storage after creation!\n", layerName)
 	}
+	a.notifyLayerChanged(activeProfile, "added")
 	// Save profiles after adding custom layer
-	if err := a.SaveProfiles(); err != nil {
-		fmt.Printf("Warning: Failed to save profiles: %v\n", err)
-	}
+	a.requestSave(activeProfile.ID)
 	return nil
 }
 
 // RemoveCustomLayer removes a custom layer
 func (a *App) RemoveCustomLayer(layerName string) error {
+	a.lock()
+	defer a.unlock()
+	
 	activeProfile := a.profileManager.GetActiveProfile()
 	if activeProfile == nil {
 		return fmt.Errorf("no active profile available")
@@ -327,16 +439,19 @@ func (a *App) RemoveCustomLayer(layerName string) error {
 		return fmt.Errorf("no current layout available in profile")
 	}
 	
+	if err := a.checkLayerNotInherited(activeProfile, currentLayout, layerName); err != nil {
+		return fmt.Errorf("cannot remove layer: %v", err)
+	}
+	
 	if currentLayout.RemoveCustomLayer(layerName) {
 		activeProfile.ModifiedAt = time.Now()
 		// If we removed the current layer, switch to base
 		if activeProfile.CurrentLayer == layerName {
 			activeProfile.CurrentLayer = "base"
 		}
+		a.notifyLayerChanged(activeProfile, "removed")
 		// Save profiles after removing custom layer
-		if err := a.SaveProfiles(); err != nil {
-			fmt.Printf("Warning: Failed to save profiles: %v\n", err)
-		}
+		a.requestSave(activeProfile.ID)
 		return nil
 	} else {
 		return fmt.Errorf("cannot remove layer %s (protected or doesn't exist)", layerName)
@@ -350,6 +465,9 @@ func (a *App) UpdateModifierKey(keyData string) error {
 		return fmt.Errorf("invalid key data: %v", err)
 	}
 	
+	a.lock()
+	defer a.unlock()
+	
 	activeProfile := a.profileManager.GetActiveProfile()
 	if activeProfile == nil {
 		return fmt.Errorf("no active profile available")
@@ -360,10 +478,17 @@ func (a *App) UpdateModifierKey(keyData string) error {
 		return fmt.Errorf("no current layout available in profile")
 	}
 	
+	// A color that differs from the key's category color is an explicit override
+	syncCategoryColor(&key, activeProfile)
+	// Overlay images sent in the description's old JSON format become legends
+	migrateOverlayLegends(&key)
+	
 	if currentLayout.UpdateModifierKeyByActiveModifiers(activeProfile.CurrentLayer, activeProfile.ActiveModifiers, key) {
 		activeProfile.ModifiedAt = time.Now()
-		// Force immediate save
-		return a.SaveProfiles()
+		a.notifyKeyUpdated(activeProfile, activeProfile.CurrentLayer, activeProfile.ActiveModifiers, key)
+		// Queue a save; the background writer coalesces rapid edits
+		a.requestSave(activeProfile.ID)
+		return nil
 	}
 	
 	return fmt.Errorf("failed to update key %s", key.ID)
@@ -390,6 +515,9 @@ func (a *App) UploadKeyImage(keyID string, imageData string) error {
 		return fmt.Errorf("invalid base64 image data: %v", err)
 	}
 	
+	a.lock()
+	defer a.unlock()
+	
 	// Find and update the key in the current modifier context
 	activeProfile := a.profileManager.GetActiveProfile()
 	if activeProfile == nil {
@@ -424,10 +552,9 @@ func (a *App) UploadKeyImage(keyID string, imageData string) error {
 	// Update the key in the layout using the proper method
 	if currentLayout.UpdateModifierKeyByActiveModifiers(activeProfile.CurrentLayer, activeProfile.ActiveModifiers, *targetKey) {
 		activeProfile.ModifiedAt = time.Now()
+		a.notifyKeyUpdated(activeProfile, activeProfile.CurrentLayer, activeProfile.ActiveModifiers, *targetKey)
 		// Save profiles after image upload
-		if err := a.SaveProfiles(); err != nil {
-			fmt.Printf("Warning: Failed to save profiles: %v\n", err)
-		}
+		a.requestSave(activeProfile.ID)
 		return nil
 	}
 	
@@ -436,6 +563,9 @@ func (a *App) UploadKeyImage(keyID string, imageData string) error {
 
 // RemoveKeyImage removes the image from a specific key
 func (a *App) RemoveKeyImage(keyID string) error {
+	a.lock()
+	defer a.unlock()
+	
 	activeProfile := a.profileManager.GetActiveProfile()
 	if activeProfile == nil {
 		return fmt.Errorf("no active profile available")
@@ -468,10 +598,9 @@ func (a *App) RemoveKeyImage(keyID string) error {
 	// Update the key in the layout
 	if currentLayout.UpdateModifierKeyByActiveModifiers(activeProfile.CurrentLayer, activeProfile.ActiveModifiers, *targetKey) {
 		activeProfile.ModifiedAt = time.Now()
+		a.notifyKeyUpdated(activeProfile, activeProfile.CurrentLayer, activeProfile.ActiveModifiers, *targetKey)
 		// Save profiles after image removal
-		if err := a.SaveProfiles(); err != nil {
-			fmt.Printf("Warning: Failed to save profiles: %v\n", err)
-		}
+		a.requestSave(activeProfile.ID)
 		return nil
 	}
 	
@@ -480,6 +609,9 @@ func (a *App) RemoveKeyImage(keyID string) error {
 
 // GetKeyImage returns the image data for a specific key
 func (a *App) GetKeyImage(keyID string) (string, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	
 	activeProfile := a.profileManager.GetActiveProfile()
 	if activeProfile == nil {
 		return "", fmt.Errorf("no active profile available")
@@ -505,6 +637,9 @@ func (a *App) GetKeyImage(keyID string) (string, error) {
 
 // ExportLayout exports the current layout with all images as a JSON file
 func (a *App) ExportLayout() (string, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	
 	activeProfile := a.profileManager.GetActiveProfile()
 	if activeProfile == nil {
 		return "", fmt.Errorf("no active profile available")
@@ -518,41 +653,21 @@ func (a *App) ExportLayout() (string, error) {
 	return currentLayout.ToJSON()
 }
 
-// ImportLayout imports a layout from JSON data
+// ImportLayout imports a layout from JSON data. The layout is validated first (see
+// layoutimport.go); if the name is already taken it is added as a copy.
 func (a *App) ImportLayout(jsonData string) error {
-	layout, err := FromJSON(jsonData)
-	if err != nil {
-		return fmt.Errorf("invalid layout data: %v", err)
-	}
-	
-	activeProfile := a.profileManager.GetActiveProfile()
-	if activeProfile == nil {
-		return fmt.Errorf("no active profile available")
-	}
+	a.lock()
+	defer a.unlock()
 	
-	// Add or replace the layout in the current profile
-	found := false
-	for i, existingLayout := range activeProfile.Layouts {
-		if existingLayout.Name == layout.Name {
-			activeProfile.Layouts[i] = *layout
-			found = true
-			break
-		}
-	}
-	
-	if !found {
-		activeProfile.Layouts = append(activeProfile.Layouts, *layout)
-	}
-	
-	// Switch to the imported layout
-	activeProfile.CurrentLayout = layout.Name
-	activeProfile.ModifiedAt = time.Now()
-	
-	return a.SaveProfiles()
+	_, err := a.importLayout(jsonData, "")
+	return err
 }
 
 // GetKeyboardType returns the current keyboard type for the active profile
 func (a *App) GetKeyboardType() (string, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	
 	activeProfile := a.profileManager.GetActiveProfile()
 	if activeProfile == nil {
 		return "", fmt.Errorf("no active profile available")
@@ -576,6 +691,9 @@ func (a *App) SetKeyboardType(keyboardType string) error {
 		return fmt.Errorf("invalid keyboard type: %s (must be 'corne' or 'tenkeyless')", keyboardType)
 	}
 	
+	a.lock()
+	defer a.unlock()
+	
 	activeProfile := a.profileManager.GetActiveProfile()
 	if activeProfile == nil {
 		return fmt.Errorf("no active profile available")
@@ -612,9 +730,11 @@ func (a *App) SetKeyboardType(keyboardType string) error {
 	if activeProfile.ActiveModifiers == nil {
 		activeProfile.ActiveModifiers = []string{}
 	}
+	a.notifyLayerChanged(activeProfile, "layout")
 	
 	// Save profiles after keyboard type change
-	return a.SaveProfiles()
+	a.requestSave(activeProfile.ID)
+	return nil
 }
 
 // GetAvailableKeyboardTypes returns all available keyboard types
@@ -629,6 +749,9 @@ func (a *App) GetAvailableKeyboardTypes() (string, error) {
 
 // DebugCurrentState returns debug info about current state
 func (a *App) DebugCurrentState() (string, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	
 	activeProfile := a.profileManager.GetActiveProfile()
 	if activeProfile == nil {
 		return "No active profile available", nil
@@ -679,6 +802,9 @@ func (a *App) DebugCurrentState() (string, error) {
 
 // GetConfig returns the entire profile manager configuration
 func (a *App) GetConfig() (string, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	
 	data, err := json.MarshalIndent(a.profileManager, "", "  ")
 	if err != nil {
 		return "", err
@@ -688,16 +814,11 @@ func (a *App) GetConfig() (string, error) {
 
 // getConfigFilePath returns the path to the configuration file
 func (a *App) getConfigFilePath() (string, error) {
-	// Get user's home directory
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return "", fmt.Errorf("failed to get home directory: %v", err)
+	if a.paths.ConfigDir == "" {
+		return "", fmt.Errorf("config directory could not be determined")
 	}
 	
-	// Create app config directory path
-	configDir := filepath.Join(homeDir, ".keyboard-cheatsheet")
-	
-	return filepath.Join(configDir, "config.json"), nil
+	return filepath.Join(a.paths.ConfigDir, "config.json"), nil
 }
 
 // ensureConfigDir creates the config directory if it doesn't exist
@@ -770,6 +891,9 @@ func (a *App) validateConfig(config *KeyboardConfig) error {
 
 // GetAllProfiles returns all available profiles
 func (a *App) GetAllProfiles() (string, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	
 	data, err := json.MarshalIndent(a.profileManager.Profiles, "", "  ")
 	if err != nil {
 		return "", err
@@ -779,6 +903,9 @@ func (a *App) GetAllProfiles() (string, error) {
 
 // GetActiveProfile returns the currently active profile
 func (a *App) GetActiveProfile() (string, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	
 	activeProfile := a.profileManager.GetActiveProfile()
 	if activeProfile == nil {
 		return "", fmt.Errorf("no active profile available")
@@ -793,13 +920,25 @@ func (a *App) GetActiveProfile() (string, error) {
 
 // SetActiveProfile switches to a different profile
 func (a *App) SetActiveProfile(profileID string) error {
+	a.lock()
+	defer a.unlock()
+	
+	// Profiles are loaded lazily; a profile that fails to load can't be activated
+	if profile := a.profileManager.GetProfile(profileID); profile != nil {
+		if err := a.ensureProfileLoaded(profile); err != nil {
+			return err
+		}
+	}
+	
 	err := a.profileManager.SetActiveProfile(profileID)
 	if err != nil {
 		return err
 	}
+	a.notifyProfileChanged(profileID, "activated")
 	
 	// Save profiles after switching active profile
-	return a.SaveProfiles()
+	a.requestSave()
+	return nil
 }
 
 // CreateNewProfile creates a new profile with the specified name
@@ -808,6 +947,9 @@ func (a *App) CreateNewProfile(name string) (string, error) {
 		return "", fmt.Errorf("profile name cannot be empty")
 	}
 	
+	a.lock()
+	defer a.unlock()
+	
 	// Check if profile name already exists
 	for _, profile := range a.profileManager.Profiles {
 		if profile.Name == name {
@@ -818,12 +960,10 @@ func (a *App) CreateNewProfile(name string) (string, error) {
 	// Create new profile
 	newProfile := NewProfile(name)
 	a.profileManager.AddProfile(newProfile)
+	a.notifyProfileChanged(newProfile.ID, "created")
 	
 	// Save profiles
-	err := a.SaveProfiles()
-	if err != nil {
-		return "", err
-	}
+	a.requestSave(newProfile.ID)
 	
 	// Return the new profile as JSON
 	return newProfile.ToJSON()
@@ -831,35 +971,88 @@ func (a *App) CreateNewProfile(name string) (string, error) {
 
 // UpdateProfileAppearance updates a profile's visual appearance
 func (a *App) UpdateProfileAppearance(profileID, name, backgroundColor, icon string) error {
+	a.lock()
+	defer a.unlock()
+	
 	profile := a.profileManager.GetProfile(profileID)
 	if profile == nil {
 		return fmt.Errorf("profile with ID %s not found", profileID)
 	}
 	
+	// The profile file is rewritten, so its layouts must be loaded first
+	if err := a.ensureProfileLoaded(profile); err != nil {
+		return err
+	}
+	// Loading may quarantine profiles, so look it up again
+	if profile = a.profileManager.GetProfile(profileID); profile == nil {
+		return fmt.Errorf("profile with ID %s not found", profileID)
+	}
+	
 	err := profile.UpdateProfileAppearance(name, backgroundColor, icon)
 	if err != nil {
 		return err
 	}
+	a.notifyProfileChanged(profileID, "updated")
 	
 	// Save profiles after updating appearance
-	return a.SaveProfiles()
+	a.requestSave(profileID)
+	return nil
 }
 
 // DeleteProfile removes a profile
 func (a *App) DeleteProfile(profileID string) error {
+	a.lock()
+	defer a.unlock()
+	
+	// Profiles inheriting from this one keep what they inherited
+	if a.profileManager.GetProfile(profileID) != nil && len(a.profileManager.Profiles) > 1 {
+		if err := a.detachChildren(profileID); err != nil {
+			return err
+		}
+	}
+	
 	err := a.profileManager.DeleteProfile(profileID)
 	if err != nil {
 		return err
 	}
 	
+	// The newly active profile may not have been loaded yet
+	if err := a.ensureActiveProfileLoaded(); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+	a.notifyProfileChanged(profileID, "deleted")
+	
 	// Save profiles after deletion
-	return a.SaveProfiles()
+	a.markProfileDeleted(profileID)
+	return nil
 }
 
 // Profile Storage Methods
 
 // LoadProfiles loads the profile configuration from disk
 func (a *App) LoadProfiles() error {
+	a.lock()
+	defer a.unlock()
+	
+	if err := a.loadProfiles(); err != nil {
+		return err
+	}
+	a.notifyProfileChanged(a.profileManager.ActiveProfile, "loaded")
+	return nil
+}
+
+// loadProfiles reads the profile index (or the single-file profiles.json written by
+// earlier versions) into the profile manager.
+// The caller must hold the write lock (or be constructing the App).
+func (a *App) loadProfiles() error {
+	indexPath, err := a.getIndexFilePath()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(indexPath); err == nil {
+		return a.loadProfileIndex(indexPath)
+	}
+	
 	profilePath, err := a.getProfileFilePath()
 	if err != nil {
 		return err
@@ -876,75 +1069,76 @@ func (a *App) LoadProfiles() error {
 		return fmt.Errorf("failed to read profiles file: %v", err)
 	}
 	
-	// Parse JSON
-	var profileManager ProfileManager
-	if err := json.Unmarshal(data, &profileManager); err != nil {
-		// If profiles are corrupted, backup and return error
-		backupPath := profilePath + ".backup"
-		os.Rename(profilePath, backupPath)
-		return fmt.Errorf("profiles file corrupted, backed up to %s: %v", backupPath, err)
+	// Parse the envelope first so one broken profile doesn't take the others down
+	var rawManager struct {
+		Profiles      []json.RawMessage `json:"profiles"`
+		ActiveProfile string            `json:"activeProfile"`
+		LastModified  time.Time         `json:"lastModified"`
+		Palette       []PaletteItem     `json:"palette"`
+	}
+	if err := json.Unmarshal(data, &rawManager); err != nil {
+		// The original file is left in place; a fresh profile is written next to it
+		a.recordMessage("profiles file %s could not be parsed and was left untouched: %v", profilePath, err)
+		return fmt.Errorf("profiles file corrupted: %v", err)
+	}
+	
+	profileManager := ProfileManager{
+		ActiveProfile: rawManager.ActiveProfile,
+		LastModified:  rawManager.LastModified,
+		Palette:       rawManager.Palette,
+	}
+	for i, raw := range rawManager.Profiles {
+		var profile Profile
+		if err := json.Unmarshal(raw, &profile); err != nil {
+			profileName := profile.Name
+			if profileName == "" {
+				profileName = fmt.Sprintf("profile #%d", i+1)
+			}
+			a.quarantineData(profile.ID, profileName, raw, err)
+			continue
+		}
+		profileManager.Profiles = append(profileManager.Profiles, profile)
 	}
 	
 	// Validate loaded profiles
+	repairedBefore := len(a.diagnostics.Repaired)
 	if err := a.validateProfiles(&profileManager); err != nil {
 		return fmt.Errorf("invalid profiles loaded: %v", err)
 	}
 	
+	if len(a.diagnostics.Repaired) > repairedBefore || len(profileManager.Profiles) < len(rawManager.Profiles) {
+		if _, err := a.backupFile(profilePath); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+	}
+	
 	a.profileManager = profileManager
+	a.profileLoadErrors = make(map[string]error)
+	a.loadedMonolithic = true
+	
+	// Everything needs writing in the per-profile layout
+	a.markAllProfilesDirty()
 	return nil
 }
 
-// SaveProfiles saves the current profile configuration to disk
+// SaveProfiles immediately writes the current profile configuration to disk,
+// bypassing the debounce of the background writer
 func (a *App) SaveProfiles() error {
-	// Ensure config directory exists
-	if err := a.ensureConfigDir(); err != nil {
-		return err
-	}
-	
-	profilePath, err := a.getProfileFilePath()
-	if err != nil {
-		return err
-	}
-	
-	// Update last modified timestamp
-	a.profileManager.LastModified = time.Now()
+	a.mu.Lock()
+	a.markAllProfilesDirty()
+	a.mu.Unlock()
 	
-	// Marshal profiles to JSON with proper formatting
-	data, err := json.MarshalIndent(a.profileManager, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal profiles: %v", err)
-	}
-	
-	// Create temporary file for atomic write
-	tempPath := profilePath + ".tmp"
-	
-	// Write to temporary file first
-	if err := os.WriteFile(tempPath, data, 0644); err != nil {
-		return fmt.Errorf("failed to write temporary profiles file: %v", err)
-	}
-	
-	// Atomic move to final location
-	if err := os.Rename(tempPath, profilePath); err != nil {
-		// Clean up temp file on failure
-		os.Remove(tempPath)
-		return fmt.Errorf("failed to move profiles to final location: %v", err)
-	}
-	
-	return nil
+	return a.writePendingProfiles()
 }
 
-// getProfileFilePath returns the path to the profile configuration file
+// getProfileFilePath returns the path to the single-file profile configuration used by earlier versions
 func (a *App) getProfileFilePath() (string, error) {
-	// Get user's home directory
-	homeDir, err := os.UserHomeDir()
+	configPath, err := a.getConfigFilePath()
 	if err != nil {
-		return "", fmt.Errorf("failed to get home directory: %v", err)
+		return "", err
 	}
 	
-	// Create app config directory path
-	configDir := filepath.Join(homeDir, ".keyboard-cheatsheet")
-	
-	return filepath.Join(configDir, "profiles.json"), nil
+	return filepath.Join(filepath.Dir(configPath), "profiles.json"), nil
 }
 
 // loadLegacyConfig loads the old config.json format for migration
@@ -983,62 +1177,38 @@ func (a *App) validateProfiles(pm *ProfileManager) error {
 		return fmt.Errorf("no profiles found")
 	}
 	
-	// Ensure active profile exists
-	found := false
-	for _, profile := range pm.Profiles {
-		if profile.ID == pm.ActiveProfile {
-			found = true
-			break
-		}
-	}
-	if !found {
-		// Reset to first available profile
-		pm.ActiveProfile = pm.Profiles[0].ID
-	}
-	
 	// Validate each profile
+	seen := make(map[string]bool)
 	for i := range pm.Profiles {
 		profile := &pm.Profiles[i]
 		
-		// Ensure profile has layouts
-		if len(profile.Layouts) == 0 {
-			return fmt.Errorf("profile %s has no layouts", profile.Name)
-		}
-		
-		// Ensure current layout exists
-		found := false
-		for _, layout := range profile.Layouts {
-			if layout.Name == profile.CurrentLayout {
-				found = true
-				break
-			}
-		}
-		if !found {
-			profile.CurrentLayout = profile.Layouts[0].Name
-		}
-		
-		// Ensure current layer exists in current layout
-		for _, layout := range profile.Layouts {
-			if layout.Name == profile.CurrentLayout {
-				if _, exists := layout.Layers[profile.CurrentLayer]; !exists {
-					profile.CurrentLayer = "base"
-				}
-				break
-			}
+		// Profile IDs name the per-profile files, so they must be unique and file-safe
+		if seen[profile.ID] || (profile.ID != "" && !isValidProfileID(profile.ID)) {
+			profile.ID = ""
 		}
 		
-		// Ensure basic fields are set
-		if profile.ID == "" {
-			profile.ID = fmt.Sprintf("profile_%d", time.Now().UnixNano())
-		}
-		if profile.Name == "" {
-			profile.Name = "Unnamed Profile"
-		}
-		if profile.BackgroundColor == "" {
-			profile.BackgroundColor = "#6366f1"
+		if err := a.validateProfile(profile); err != nil {
+			return err
 		}
+		seen[profile.ID] = true
+	}
+	
+	// Ensure active profile exists
+	if pm.GetProfile(pm.ActiveProfile) == nil {
+		// Reset to first available profile
+		pm.ActiveProfile = pm.Profiles[0].ID
 	}
 	
 	return nil
 }
 
+// validateProfile ensures a single loaded profile is usable, repairing what it can.
+// Repairs are recorded in the startup diagnostics.
+func (a *App) validateProfile(profile *Profile) error {
+	if profile == nil {
+		return fmt.Errorf("profile is nil")
+	}
+	
+	a.recordRepair(profile, repairProfile(profile))
+	return nil
+}
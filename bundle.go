@@ -0,0 +1,481 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// A profile bundle (.kbdshrtct) is a zip archive holding a whole profile:
+//
+//	manifest.json         format, version and the list of files below
+//	profile.json          the profile without its layouts
+//	layouts/<n>.json      one file per layout, in order
+//	images/<sha256>.<ext> every distinct image, referenced from keys by ImagePath
+//
+// Images are stored once however many keys use them. On import they are turned back
+// into inline data URLs, and the profile gets a new ID if its own is already taken.
+
+const (
+	bundleFormat    = "kbdshrtct-profile"
+	bundleVersion   = 1
+	bundleExtension = ".kbdshrtct"
+
+	bundleMaxFileSize  = 32 << 20  // Largest single file accepted from a bundle
+	bundleMaxTotalSize = 256 << 20 // Most data read from a bundle, all files together
+	bundleMaxFiles     = 10000     // Most files accepted in a bundle
+)
+
+// BundleManifest describes the contents of a profile bundle
+type BundleManifest struct {
+	Format      string        `json:"format"`
+	Version     int           `json:"version"`
+	CreatedAt   time.Time     `json:"createdAt"`
+	ProfileID   string        `json:"profileId"`
+	ProfileName string        `json:"profileName"`
+	Layouts     []string      `json:"layouts"` // Layout files, in profile order
+	Images      []BundleImage `json:"images"`
+}
+
+// BundleImage is an image stored in a bundle
+type BundleImage struct {
+	File      string `json:"file"`
+	MediaType string `json:"mediaType"`
+	Size      int    `json:"size"`
+	SHA256    string `json:"sha256"`
+}
+
+// BundleImportResult describes a profile imported from a bundle
+type BundleImportResult struct {
+	ProfileID    string   `json:"profileId"`
+	ProfileName  string   `json:"profileName"`
+	OriginalID   string   `json:"originalId"`   // ID in the bundle, if it had to be changed
+	OriginalName string   `json:"originalName"` // Name in the bundle, if it had to be changed
+	Repairs      []string `json:"repairs"`      // Problems in the bundle that were fixed
+}
+
+// bundleWriter collects a profile's files and images while building a bundle
+type bundleWriter struct {
+	manifest BundleManifest
+	files    map[string][]byte
+	order    []string
+	images   map[string]string // Data URL hash -> file name
+}
+
+// ExportProfile asks where to save and writes the profile as a bundle. Returns the
+// path written, or an empty string if the user cancelled.
+func (a *App) ExportProfile(profileID string) (string, error) {
+	a.mu.RLock()
+	ctx := a.ctx
+	var name string
+	if profile := a.profileManager.GetProfile(profileID); profile != nil {
+		name = profile.Name
+	}
+	a.mu.RUnlock()
+
+	if name == "" {
+		return "", fmt.Errorf("profile not found: %s", profileID)
+	}
+	if ctx == nil {
+		return "", fmt.Errorf("no window available for the save dialog")
+	}
+
+	path, err := runtime.SaveFileDialog(ctx, runtime.SaveDialogOptions{
+		Title:           "Export Profile",
+		DefaultFilename: sanitizeFileName(name) + bundleExtension,
+		Filters:         []runtime.FileFilter{{DisplayName: "Profile bundles (*" + bundleExtension + ")", Pattern: "*" + bundleExtension}},
+	})
+	if err != nil || path == "" {
+		return "", err
+	}
+
+	if err := a.ExportProfileToFile(profileID, path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// ExportProfileToFile writes the profile as a bundle to the given path
+func (a *App) ExportProfileToFile(profileID, path string) error {
+	a.lock()
+	profile := a.profileManager.GetProfile(profileID)
+	if profile == nil {
+		a.unlock()
+		return fmt.Errorf("profile not found: %s", profileID)
+	}
+	if err := a.ensureProfileLoaded(profile); err != nil {
+		a.unlock()
+		return err
+	}
+	// Loading may quarantine profiles, so look it up again
+	if profile = a.profileManager.GetProfile(profileID); profile == nil {
+		a.unlock()
+		return fmt.Errorf("profile not found: %s", profileID)
+	}
+	snapshot := profile.Clone()
+	a.unlock()
+
+	// The bundle holds the resolved layouts; the parent isn't part of it
+	snapshot.Parent = ""
+
+	data, err := buildProfileBundle(&snapshot)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write bundle: %v", err)
+	}
+	return nil
+}
+
+// ImportProfile adds the profile from a bundle. With an empty path the user is asked
+// to pick a file; an empty result means they cancelled.
+func (a *App) ImportProfile(path string) (string, error) {
+	if path == "" {
+		a.mu.RLock()
+		ctx := a.ctx
+		a.mu.RUnlock()
+		if ctx == nil {
+			return "", fmt.Errorf("no window available for the open dialog")
+		}
+
+		var err error
+		path, err = runtime.OpenFileDialog(ctx, runtime.OpenDialogOptions{
+			Title:   "Import Profile",
+			Filters: []runtime.FileFilter{{DisplayName: "Profile bundles (*" + bundleExtension + ")", Pattern: "*" + bundleExtension}},
+		})
+		if err != nil || path == "" {
+			return "", err
+		}
+	}
+
+	profile, err := readProfileBundle(path)
+	if err != nil {
+		return "", err
+	}
+
+	a.lock()
+	defer a.unlock()
+
+	result := a.addImportedProfile(profile)
+	result.Repairs = repairProfile(profile)
+	if result.Repairs == nil {
+		result.Repairs = []string{}
+	}
+
+	a.profileManager.AddProfile(*profile)
+	a.notifyProfileChanged(profile.ID, "imported")
+	a.requestSave(profile.ID)
+
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// addImportedProfile gives an incoming profile an unused ID and name and stamps it.
+// The caller must hold the write lock.
+func (a *App) addImportedProfile(profile *Profile) BundleImportResult {
+	result := BundleImportResult{}
+
+	if !isValidProfileID(profile.ID) || a.profileManager.GetProfile(profile.ID) != nil {
+		result.OriginalID = profile.ID
+		profile.ID = fmt.Sprintf("profile_%d", time.Now().UnixNano())
+	}
+
+	names := make(map[string]bool)
+	for _, existing := range a.profileManager.Profiles {
+		names[existing.Name] = true
+	}
+	if names[profile.Name] {
+		result.OriginalName = profile.Name
+		for n := 2; names[profile.Name]; n++ {
+			profile.Name = fmt.Sprintf("%s (%d)", result.OriginalName, n)
+		}
+	}
+
+	profile.ModifiedAt = time.Now()
+	result.ProfileID = profile.ID
+	result.ProfileName = profile.Name
+	return result
+}
+
+// buildProfileBundle returns the zip archive for a profile
+func buildProfileBundle(profile *Profile) ([]byte, error) {
+	bw := &bundleWriter{
+		manifest: BundleManifest{
+			Format:      bundleFormat,
+			Version:     bundleVersion,
+			CreatedAt:   time.Now(),
+			ProfileID:   profile.ID,
+			ProfileName: profile.Name,
+			Layouts:     []string{},
+			Images:      []BundleImage{},
+		},
+		files:  make(map[string][]byte),
+		images: make(map[string]string),
+	}
+
+	profile.Icon = bw.externalizeImage(profile.Icon)
+	for i := range profile.Palette {
+		profile.Palette[i].ImageData = bw.externalizeImage(profile.Palette[i].ImageData)
+	}
+	layouts := profile.Layouts
+	profile.Layouts = nil
+
+	for i := range layouts {
+		layout := &layouts[i]
+		rewriteLayoutImages(layout, bw.externalizeImage)
+
+		name := fmt.Sprintf("layouts/%d.json", i+1)
+		if err := bw.addJSON(name, layout); err != nil {
+			return nil, err
+		}
+		bw.manifest.Layouts = append(bw.manifest.Layouts, name)
+	}
+
+	if err := bw.addJSON("profile.json", profile); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	// The manifest goes first so tools can identify the file cheaply
+	manifest, err := json.MarshalIndent(bw.manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal manifest: %v", err)
+	}
+	entries := append([]string{"manifest.json"}, bw.order...)
+	bw.files["manifest.json"] = manifest
+
+	for _, name := range entries {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: bw.manifest.CreatedAt})
+		if err != nil {
+			return nil, fmt.Errorf("failed to add %s to bundle: %v", name, err)
+		}
+		if _, err := w.Write(bw.files[name]); err != nil {
+			return nil, fmt.Errorf("failed to add %s to bundle: %v", name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish bundle: %v", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// addJSON adds a JSON file to the bundle
+func (bw *bundleWriter) addJSON(name string, value interface{}) error {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %v", name, err)
+	}
+	bw.files[name] = data
+	bw.order = append(bw.order, name)
+	return nil
+}
+
+// externalizeImage stores a data URL image in the bundle once and returns its file
+// name; anything that isn't a decodable data URL is returned unchanged
+func (bw *bundleWriter) externalizeImage(dataURL string) string {
+	mediaType, data, ok := decodeDataURL(dataURL)
+	if !ok {
+		return dataURL
+	}
+
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	if name, exists := bw.images[hash]; exists {
+		return name
+	}
+
+	name := "images/" + hash + imageExtension(mediaType)
+	bw.images[hash] = name
+	bw.files[name] = data
+	bw.order = append(bw.order, name)
+	bw.manifest.Images = append(bw.manifest.Images, BundleImage{
+		File:      name,
+		MediaType: mediaType,
+		Size:      len(data),
+		SHA256:    hash,
+	})
+	return name
+}
+
+// readProfileBundle reads a bundle and returns its profile with images inlined again
+func readProfileBundle(bundlePath string) (*Profile, error) {
+	zr, err := zip.OpenReader(bundlePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bundle %s: %v", bundlePath, err)
+	}
+	defer zr.Close()
+
+	if len(zr.File) > bundleMaxFiles {
+		return nil, fmt.Errorf("bundle has too many files (%d)", len(zr.File))
+	}
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	// The manifest may list a file any number of times, so the budget counts every read
+	remaining := int64(bundleMaxTotalSize)
+	read := func(name string) ([]byte, error) {
+		f, exists := files[name]
+		if !exists {
+			return nil, fmt.Errorf("bundle is missing %s", name)
+		}
+		if f.UncompressedSize64 > bundleMaxFileSize {
+			return nil, fmt.Errorf("%s in bundle is too large", name)
+		}
+		if f.UncompressedSize64 > uint64(remaining) {
+			return nil, fmt.Errorf("bundle is too large")
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s from bundle: %v", name, err)
+		}
+		defer rc.Close()
+
+		// Don't trust the size in the header
+		data, err := io.ReadAll(io.LimitReader(rc, min(bundleMaxFileSize, remaining)+1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s from bundle: %v", name, err)
+		}
+		if len(data) > bundleMaxFileSize {
+			return nil, fmt.Errorf("%s in bundle is too large", name)
+		}
+		if int64(len(data)) > remaining {
+			return nil, fmt.Errorf("bundle is too large")
+		}
+		remaining -= int64(len(data))
+		return data, nil
+	}
+
+	data, err := read("manifest.json")
+	if err != nil {
+		return nil, err
+	}
+	var manifest BundleManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid bundle manifest: %v", err)
+	}
+	if manifest.Format != bundleFormat {
+		return nil, fmt.Errorf("not a profile bundle")
+	}
+	if manifest.Version > bundleVersion {
+		return nil, fmt.Errorf("bundle version %d is newer than this app supports (%d)", manifest.Version, bundleVersion)
+	}
+
+	images := make(map[string]string)
+	for _, image := range manifest.Images {
+		data, err := read(image.File)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(data)
+		if image.SHA256 != "" && hex.EncodeToString(sum[:]) != image.SHA256 {
+			return nil, fmt.Errorf("image %s in bundle is damaged", image.File)
+		}
+		if !strings.HasPrefix(image.MediaType, "image/") {
+			return nil, fmt.Errorf("image %s in bundle has unsupported type %q", image.File, image.MediaType)
+		}
+		images[image.File] = "data:" + image.MediaType + ";base64," + base64.StdEncoding.EncodeToString(data)
+	}
+
+	data, err = read("profile.json")
+	if err != nil {
+		return nil, err
+	}
+	var profile Profile
+	if err := json.Unmarshal(data, &profile); err != nil {
+		return nil, fmt.Errorf("invalid profile in bundle: %v", err)
+	}
+	inline := func(ref string) string {
+		if image, exists := images[ref]; exists {
+			return image
+		}
+		return ref
+	}
+	profile.Icon = inline(profile.Icon)
+	for i := range profile.Palette {
+		profile.Palette[i].ImageData = inline(profile.Palette[i].ImageData)
+	}
+	profile.Parent = ""
+
+	profile.Layouts = nil
+	for _, name := range manifest.Layouts {
+		data, err := read(name)
+		if err != nil {
+			return nil, err
+		}
+		var layout KeyboardLayout
+		if err := json.Unmarshal(data, &layout); err != nil {
+			return nil, fmt.Errorf("invalid layout %s in bundle: %v", name, err)
+		}
+
+		rewriteLayoutImages(&layout, inline)
+		profile.Layouts = append(profile.Layouts, layout)
+	}
+
+	return &profile, nil
+}
+
+// decodeDataURL splits a base64 data URL into its media type and bytes
+func decodeDataURL(dataURL string) (string, []byte, bool) {
+	if !strings.HasPrefix(dataURL, "data:") {
+		return "", nil, false
+	}
+	header, encoded, found := strings.Cut(dataURL[len("data:"):], ",")
+	if !found || !strings.HasSuffix(header, ";base64") {
+		return "", nil, false
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", nil, false
+	}
+	return strings.TrimSuffix(header, ";base64"), data, true
+}
+
+// imageExtension returns a file extension for an image media type
+func imageExtension(mediaType string) string {
+	switch mediaType {
+	case "image/png":
+		return ".png"
+	case "image/jpeg":
+		return ".jpg"
+	case "image/gif":
+		return ".gif"
+	case "image/webp":
+		return ".webp"
+	case "image/svg+xml":
+		return ".svg"
+	}
+	return ".bin"
+}
+
+// sanitizeFileName turns a profile name into something safe to use as a file name
+func sanitizeFileName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`<>:"/\|?*`, r) || r < 32 {
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.Trim(name, ". ")
+	if name == "" {
+		return "profile"
+	}
+	return name
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+)
+
+// testLayouts returns a profile's layouts as JSON, for comparing them across a round trip
+func testLayouts(t *testing.T, app *App, profileID string) string {
+	t.Helper()
+	app.lock()
+	defer app.unlock()
+	profile := app.profileManager.GetProfile(profileID)
+	if profile == nil {
+		t.Fatalf("profile %s not found", profileID)
+	}
+	if err := app.ensureProfileLoaded(profile); err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(app.profileManager.GetProfile(profileID).Layouts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestBundleRoundTrip(t *testing.T) {
+	app := NewApp(t.TempDir())
+	t.Cleanup(func() { app.shutdown(nil) })
+	if err := app.UploadKeyImage("L00", testImage); err != nil {
+		t.Fatalf("UploadKeyImage: %v", err)
+	}
+	setTestLabel(t, app, "L01", "Q")
+	profileID := testProfileID(app)
+	want := testLayouts(t, app, profileID)
+
+	bundlePath := filepath.Join(t.TempDir(), "profile"+bundleExtension)
+	if err := app.ExportProfileToFile(profileID, bundlePath); err != nil {
+		t.Fatalf("ExportProfileToFile: %v", err)
+	}
+
+	importInto := func(app *App) BundleImportResult {
+		t.Helper()
+		data, err := app.ImportProfile(bundlePath)
+		if err != nil {
+			t.Fatalf("ImportProfile: %v", err)
+		}
+		var result BundleImportResult
+		if err := json.Unmarshal([]byte(data), &result); err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	// Into the app it came from: the ID and name are taken
+	result := importInto(app)
+	if result.ProfileID == profileID || result.OriginalID != profileID {
+		t.Errorf("imported as %s (originally %s), want a new ID in place of %s", result.ProfileID, result.OriginalID, profileID)
+	}
+	if result.OriginalName == "" || result.ProfileName == result.OriginalName {
+		t.Errorf("imported as %q (originally %q), want a new name", result.ProfileName, result.OriginalName)
+	}
+	if got := testLayouts(t, app, result.ProfileID); got != want {
+		t.Errorf("layouts changed in the round trip:\n got %s\nwant %s", got, want)
+	}
+
+	// Into another app: nothing is taken
+	other := NewApp(t.TempDir())
+	t.Cleanup(func() { other.shutdown(nil) })
+	result = importInto(other)
+	if result.ProfileID != profileID || result.OriginalID != "" {
+		t.Errorf("imported as %s (originally %q), want the bundle's ID", result.ProfileID, result.OriginalID)
+	}
+	if got := testLayouts(t, other, result.ProfileID); got != want {
+		t.Errorf("layouts changed in the round trip:\n got %s\nwant %s", got, want)
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Keys can belong to one of the categories of the profile's color schemes. With
+// color by category on, a key without a color of its own takes its category's scheme
+// color and follows it when the scheme changes (Key.CategoryColor); a key whose color
+// was set explicitly keeps it.
+
+// keyCategories are the built-in categories, in display order
+var keyCategories = []string{"letters", "numbers", "symbols", "function", "modifiers", "navigation"}
+
+// KeyCategory is a category with its scheme color
+type KeyCategory struct {
+	Name  string `json:"name"`
+	Color string `json:"color"`
+}
+
+var functionKeyLabel = regexp.MustCompile(`^[Ff]([1-9]|1[0-9]|2[0-4])$`)
+
+// modifierLabels and navigationLabels are matched ignoring case
+var modifierLabels = map[string]bool{
+	"ctrl": true, "control": true, "shift": true, "alt": true, "option": true, "opt": true,
+	"gui": true, "cmd": true, "command": true, "win": true, "super": true, "meta": true,
+	"hyper": true, "fn": true, "caps": true, "capslock": true, "caps lock": true, "altgr": true,
+	"⌘": true, "⌥": true, "⇧": true, "⌃": true,
+}
+
+var navigationLabels = map[string]bool{
+	"up": true, "down": true, "left": true, "right": true, "home": true, "end": true,
+	"pgup": true, "pgdn": true, "page up": true, "page down": true, "pageup": true, "pagedown": true,
+	"ins": true, "insert": true, "del": true, "delete": true,
+	"←": true, "↑": true, "→": true, "↓": true, "⇞": true, "⇟": true, "↖": true, "↘": true,
+}
+
+// keyTypeCategories classify keys by their type when the label doesn't tell
+var keyTypeCategories = map[string]string{
+	"function": "function",
+	"modifier": "modifiers",
+	"nav":      "navigation",
+	"arrow":    "navigation",
+}
+
+// classifyKey guesses a key's category from its label, then its type. Keys that fit
+// no category, such as commands ("Copy") or Enter and Space, get "".
+func classifyKey(key Key) string {
+	label := strings.TrimSpace(key.Label)
+	lower := strings.ToLower(label)
+	first, size := utf8.DecodeRuneInString(label)
+
+	switch {
+	case label == "":
+	case size == len(label) && unicode.IsLetter(first):
+		return "letters"
+	case isAll(label, unicode.IsDigit):
+		return "numbers"
+	case functionKeyLabel.MatchString(label):
+		return "function"
+	case modifierLabels[lower]:
+		return "modifiers"
+	case navigationLabels[lower]:
+		return "navigation"
+	case isAll(label, func(r rune) bool { return unicode.IsPunct(r) || unicode.IsSymbol(r) }):
+		return "symbols"
+	}
+	return keyTypeCategories[key.KeyType]
+}
+
+// isAll reports whether every rune of s satisfies f
+func isAll(s string, f func(rune) bool) bool {
+	for _, r := range s {
+		if !f(r) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// isKnownCategory reports whether a category is built in or has a scheme color
+func isKnownCategory(schemes map[string]string, category string) bool {
+	if _, exists := schemes[category]; exists {
+		return true
+	}
+	for _, name := range keyCategories {
+		if name == category {
+			return true
+		}
+	}
+	return false
+}
+
+// applyCategoryColor sets the color of a key that follows its category. A key with
+// its own color is left alone unless it has none yet (blank), in which case it
+// starts following its category.
+func applyCategoryColor(key *Key, schemes map[string]string, enabled bool) bool {
+	color, hasColor := schemes[key.Category]
+	follows := key.CategoryColor || key.Color == "" || strings.EqualFold(key.Color, blankKeyColor)
+
+	switch {
+	case !follows:
+		return false
+	case enabled && key.Category != "" && hasColor:
+		changed := key.Color != color || !key.CategoryColor
+		key.Color, key.CategoryColor = color, true
+		return changed
+	case key.CategoryColor:
+		// Color by category is off or the key lost its category: back to blank
+		key.Color, key.CategoryColor = blankKeyColor, false
+		return true
+	}
+	return false
+}
+
+// syncCategoryColor keeps a key edited as a whole consistent with its category: a
+// color that differs from the category's scheme color is an explicit override.
+func syncCategoryColor(key *Key, profile *Profile) {
+	if key.CategoryColor && key.Color != profile.ColorSchemes[key.Category] {
+		if key.Color == "" || strings.EqualFold(key.Color, blankKeyColor) {
+			// The color was cleared, so it follows the category again
+			applyCategoryColor(key, profile.ColorSchemes, profile.ColorByCategory)
+			return
+		}
+		key.CategoryColor = false
+	}
+	if !key.CategoryColor {
+		applyCategoryColor(key, profile.ColorSchemes, profile.ColorByCategory)
+	}
+}
+
+// eachLayoutKey calls fn for every key of a layout, in its layers and combinations
+func eachLayoutKey(layout *KeyboardLayout, fn func(key *Key)) {
+	for _, keys := range layout.Layers {
+		for i := range keys {
+			fn(&keys[i])
+		}
+	}
+	for _, combos := range layout.ModifierMaps {
+		for _, keys := range combos {
+			for i := range keys {
+				fn(&keys[i])
+			}
+		}
+	}
+}
+
+// recolorProfileKeys applies category colors to every loaded layout of a profile and
+// returns how many keys changed
+func recolorProfileKeys(profile *Profile) int {
+	changed := 0
+	for i := range profile.Layouts {
+		layout := &profile.Layouts[i]
+		layoutChanged := false
+		eachLayoutKey(layout, func(key *Key) {
+			if applyCategoryColor(key, profile.ColorSchemes, profile.ColorByCategory) {
+				changed++
+				layoutChanged = true
+			}
+		})
+		if layoutChanged {
+			layout.ModifiedAt = time.Now()
+		}
+	}
+	return changed
+}
+
+// GetKeyCategories returns the categories of the active profile with their scheme
+// colors: the built-in ones first, then any other schemes
+func (a *App) GetKeyCategories() (string, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	activeProfile := a.profileManager.GetActiveProfile()
+	if activeProfile == nil {
+		return "", fmt.Errorf("no active profile available")
+	}
+
+	categories := []KeyCategory{}
+	for _, name := range keyCategories {
+		categories = append(categories, KeyCategory{Name: name, Color: activeProfile.ColorSchemes[name]})
+	}
+	for _, name := range unionKeys(activeProfile.ColorSchemes, nil) {
+		if !isKnownCategory(nil, name) {
+			categories = append(categories, KeyCategory{Name: name, Color: activeProfile.ColorSchemes[name]})
+		}
+	}
+
+	data, err := json.MarshalIndent(categories, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal categories: %v", err)
+	}
+	return string(data), nil
+}
+
+// ClassifyKeys guesses the category of every key in the current layout from its
+// label and returns how many keys changed. Keys that already have a category keep
+// it unless overwrite is set.
+func (a *App) ClassifyKeys(overwrite bool) (int, error) {
+	a.lock()
+	defer a.unlock()
+
+	activeProfile, currentLayout, err := a.activeLayout()
+	if err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	eachLayoutKey(currentLayout, func(key *Key) {
+		if key.Category != "" && !overwrite {
+			return
+		}
+		if category := classifyKey(*key); category != key.Category {
+			key.Category = category
+			applyCategoryColor(key, activeProfile.ColorSchemes, activeProfile.ColorByCategory)
+			changed++
+		}
+	})
+
+	if changed > 0 {
+		currentLayout.ModifiedAt = time.Now()
+		activeProfile.ModifiedAt = time.Now()
+		a.notifyLayerChanged(activeProfile, "keys")
+		a.requestSave(activeProfile.ID)
+	}
+	return changed, nil
+}
+
+// SetColorByCategory turns color by category on or off for the active profile.
+// Turning it off returns keys that followed their category to blank.
+func (a *App) SetColorByCategory(enabled bool) error {
+	a.lock()
+	defer a.unlock()
+
+	activeProfile := a.profileManager.GetActiveProfile()
+	if activeProfile == nil {
+		return fmt.Errorf("no active profile available")
+	}
+
+	activeProfile.ColorByCategory = enabled
+	recolorProfileKeys(activeProfile)
+	activeProfile.ModifiedAt = time.Now()
+	a.notifyProfileChanged(activeProfile.ID, "colors")
+	a.notifyLayerChanged(activeProfile, "keys")
+	a.requestSave(activeProfile.ID)
+	return nil
+}
+
+// UpdateColorScheme changes a category's scheme color in the active profile and
+// recolors the keys that follow it, leaving keys with their own color alone
+func (a *App) UpdateColorScheme(category, color string) error {
+	category = strings.TrimSpace(category)
+	if category == "" {
+		return fmt.Errorf("category name cannot be empty")
+	}
+	if !isValidHexColor(color) {
+		return fmt.Errorf("invalid color: %s", color)
+	}
+
+	a.lock()
+	defer a.unlock()
+
+	activeProfile := a.profileManager.GetActiveProfile()
+	if activeProfile == nil {
+		return fmt.Errorf("no active profile available")
+	}
+
+	if activeProfile.ColorSchemes == nil {
+		activeProfile.ColorSchemes = make(map[string]string)
+	}
+	activeProfile.ColorSchemes[category] = color
+	recolorProfileKeys(activeProfile)
+	activeProfile.ModifiedAt = time.Now()
+	a.notifyProfileChanged(activeProfile.ID, "colors")
+	a.notifyLayerChanged(activeProfile, "keys")
+	a.requestSave(activeProfile.ID)
+	return nil
+}
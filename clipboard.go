@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// The key clipboard holds copied keys in memory so they can be pasted onto keys of
+// any layer, combination, layout or profile. It lasts until the app exits.
+
+// clipboardFields are the parts of a key that can be pasted
+var clipboardFields = []string{"label", "image", "color", "description", "legends", "tags"}
+
+// KeyContext locates a list of keys. Empty fields default to the active profile, its
+// current layout and current layer; Modifiers picks a combination of the layer.
+type KeyContext struct {
+	ProfileID string   `json:"profileId,omitempty"`
+	Layout    string   `json:"layout,omitempty"`
+	Layer     string   `json:"layer,omitempty"`
+	Modifiers []string `json:"modifiers,omitempty"`
+}
+
+// ClipboardKey is a copied key and where it was copied from
+type ClipboardKey struct {
+	Source   KeyContext `json:"source"`
+	Key      Key        `json:"key"`
+	CopiedAt time.Time  `json:"copiedAt"`
+}
+
+// CopyKeysRequest is the argument of CopyKeys
+type CopyKeysRequest struct {
+	KeyContext
+	KeyIDs []string `json:"keyIds"`
+}
+
+// PasteKeysRequest is the argument of PasteKeys. One copied key is pasted onto every
+// target; several are pasted onto the targets in order, so the counts must match.
+type PasteKeysRequest struct {
+	KeyContext
+	KeyIDs []string `json:"keyIds"`
+	Fields []string `json:"fields"` // "label", "image", "color", "description", "legends" and/or "tags"; empty pastes all
+}
+
+// CopyKeys replaces the clipboard with copies of the given keys and returns it.
+// requestJSON is a CopyKeysRequest.
+func (a *App) CopyKeys(requestJSON string) (string, error) {
+	var request CopyKeysRequest
+	if err := json.Unmarshal([]byte(requestJSON), &request); err != nil {
+		return "", fmt.Errorf("invalid copy request: %v", err)
+	}
+	if len(request.KeyIDs) == 0 {
+		return "", fmt.Errorf("no keys to copy")
+	}
+
+	a.lock()
+	defer a.unlock()
+
+	location, _, _, keys, err := a.resolveKeyContext(request.KeyContext, false)
+	if err != nil {
+		return "", err
+	}
+	copied := make([]ClipboardKey, 0, len(request.KeyIDs))
+	now := time.Now()
+	for _, keyID := range request.KeyIDs {
+		key := findKey(keys, keyID)
+		if key == nil {
+			return "", fmt.Errorf("key %s not found", keyID)
+		}
+		copied = append(copied, ClipboardKey{Source: location, Key: key.Clone(), CopiedAt: now})
+	}
+
+	a.keyClipboard = copied
+	return marshalClipboard(copied)
+}
+
+// GetKeyClipboard returns the copied keys
+func (a *App) GetKeyClipboard() (string, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return marshalClipboard(a.keyClipboard)
+}
+
+// ClearKeyClipboard empties the clipboard
+func (a *App) ClearKeyClipboard() {
+	a.lock()
+	defer a.unlock()
+
+	a.keyClipboard = nil
+}
+
+// PasteKeys pastes the copied keys onto other keys and returns how many were changed.
+// requestJSON is a PasteKeysRequest. Nothing is changed if any target is missing.
+func (a *App) PasteKeys(requestJSON string) (int, error) {
+	var request PasteKeysRequest
+	if err := json.Unmarshal([]byte(requestJSON), &request); err != nil {
+		return 0, fmt.Errorf("invalid paste request: %v", err)
+	}
+	fields := make(map[string]bool)
+	for _, field := range clipboardFields {
+		fields[field] = len(request.Fields) == 0
+	}
+	for _, field := range request.Fields {
+		if _, known := fields[field]; !known {
+			return 0, fmt.Errorf("unknown field %q, expected one of %s", field, strings.Join(clipboardFields, ", "))
+		}
+		fields[field] = true
+	}
+
+	a.lock()
+	defer a.unlock()
+
+	copied := a.keyClipboard
+	switch {
+	case len(copied) == 0:
+		return 0, fmt.Errorf("clipboard is empty")
+	case len(request.KeyIDs) == 0:
+		return 0, fmt.Errorf("no keys to paste onto")
+	case len(copied) > 1 && len(copied) != len(request.KeyIDs):
+		return 0, fmt.Errorf("%d keys were copied but %d targets given", len(copied), len(request.KeyIDs))
+	}
+
+	location, profile, layout, keys, err := a.resolveKeyContext(request.KeyContext, false)
+	if err != nil {
+		return 0, err
+	}
+	for _, keyID := range request.KeyIDs {
+		if findKey(keys, keyID) == nil {
+			return 0, fmt.Errorf("key %s not found", keyID)
+		}
+	}
+
+	// Every target exists, so a combination that was never edited can be stored now
+	keys = layout.keysFor(location.Layer, comboName(location.Modifiers), true)
+	targets := make([]*Key, 0, len(request.KeyIDs))
+	for _, keyID := range request.KeyIDs {
+		targets = append(targets, findKey(keys, keyID))
+	}
+
+	for i, target := range targets {
+		source := copied[0].Key
+		if len(copied) > 1 {
+			source = copied[i].Key
+		}
+		pasteKeyFields(target, source, fields)
+	}
+
+	layout.ModifiedAt = time.Now()
+	profile.ModifiedAt = time.Now()
+	a.notifyProfileChanged(profile.ID, "pasted")
+	if profile.ID == a.profileManager.ActiveProfile && layout.Name == profile.CurrentLayout {
+		a.notifyLayerChanged(profile, "keys")
+	}
+	a.requestSave(profile.ID)
+	return len(targets), nil
+}
+
+// activeKeyContext locates the keys the keyboard shows: the current layer of the active
+// profile's current layout, in the active modifier combination
+func (a *App) activeKeyContext() KeyContext {
+	location := KeyContext{ProfileID: a.profileManager.ActiveProfile}
+	if activeProfile := a.profileManager.GetActiveProfile(); activeProfile != nil {
+		location.Modifiers = cloneStrings(activeProfile.ActiveModifiers)
+	}
+	return location
+}
+
+// resolveKeyContext fills in a location's defaults and returns it with the profile,
+// layout and keys it refers to. A modifier combination that was never edited resolves
+// to blank keys, as the keyboard shows it; when they are resolved for an edit, they are
+// stored in the layout first (see keysFor). The caller must hold the write lock, as
+// the profile may have to be loaded; the read lock does when edit is false and the
+// profile is the active one, which is always loaded.
+func (a *App) resolveKeyContext(location KeyContext, edit bool) (KeyContext, *Profile, *KeyboardLayout, []Key, error) {
+	if location.ProfileID == "" {
+		location.ProfileID = a.profileManager.ActiveProfile
+	}
+	profile := a.profileManager.GetProfile(location.ProfileID)
+	if profile == nil {
+		return location, nil, nil, nil, fmt.Errorf("profile not found: %s", location.ProfileID)
+	}
+	if err := a.ensureProfileLoaded(profile); err != nil {
+		return location, nil, nil, nil, err
+	}
+	// Loading may quarantine profiles, so look it up again
+	if profile = a.profileManager.GetProfile(location.ProfileID); profile == nil {
+		return location, nil, nil, nil, fmt.Errorf("profile not found: %s", location.ProfileID)
+	}
+
+	if location.Layout == "" {
+		location.Layout = profile.CurrentLayout
+	}
+	layout := findLayout(profile.Layouts, location.Layout)
+	if layout == nil {
+		return location, nil, nil, nil, fmt.Errorf("layout not found: %s", location.Layout)
+	}
+	if location.Layer == "" {
+		location.Layer = profile.CurrentLayer
+	}
+	if _, exists := layout.Layers[location.Layer]; !exists {
+		return location, nil, nil, nil, fmt.Errorf("layer %s does not exist", location.Layer)
+	}
+
+	keys := layout.keysFor(location.Layer, comboName(location.Modifiers), edit)
+	return location, profile, layout, keys, nil
+}
+
+// pasteKeyFields copies the chosen fields of a copied key onto another key
+func pasteKeyFields(target *Key, source Key, fields map[string]bool) {
+	if fields["label"] {
+		target.Label = source.Label
+	}
+	if fields["image"] {
+		target.ImageData, target.ImagePath = source.ImageData, source.ImagePath
+	}
+	if fields["color"] {
+		target.Color, target.CategoryColor = source.Color, false
+	}
+	if fields["description"] {
+		target.Description = source.Description
+	}
+	if fields["legends"] {
+		target.Legends = cloneLegends(source.Legends)
+	}
+	if fields["tags"] {
+		target.Tags = cloneStrings(source.Tags)
+	}
+}
+
+// marshalClipboard returns the clipboard as JSON, an empty list when nothing is copied
+func marshalClipboard(copied []ClipboardKey) (string, error) {
+	if copied == nil {
+		copied = []ClipboardKey{}
+	}
+	data, err := json.MarshalIndent(copied, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal clipboard: %v", err)
+	}
+	return string(data), nil
+}
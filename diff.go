@@ -0,0 +1,629 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ProfileChange is a single difference between two versions of a profile
+type ProfileChange struct {
+	Kind      string      `json:"kind"`                // "added", "removed", "modified" or "moved" (keys whose position alone changed)
+	Scope     string      `json:"scope"`               // "profile", "state", "layout", "layer", "combo" or "key"
+	Layout    string      `json:"layout,omitempty"`    // Layout the change is in
+	Layer     string      `json:"layer,omitempty"`     // Layer the change is in
+	Modifiers string      `json:"modifiers,omitempty"` // Modifier combination, e.g. "ctrl+shift"
+	KeyID     string      `json:"keyId,omitempty"`     // Key that changed
+	Fields    []string    `json:"fields,omitempty"`    // JSON names of the modified fields
+	Old       interface{} `json:"old,omitempty"`       // Previous value; for keys, the changed fields by JSON name (see keyFieldValues)
+	New       interface{} `json:"new,omitempty"`       // New value; for keys, the changed fields by JSON name
+
+	oldKey, newKey *Key // Both versions of a changed key, for Details
+}
+
+// LayoutDiff is the result of comparing two layouts or two profiles
+type LayoutDiff struct {
+	Changes []ProfileChange `json:"changes"`
+	Counts  map[string]int  `json:"counts"`  // Number of changes of each kind
+	Summary string          `json:"summary"` // Readable summary, one change per line
+}
+
+// positionFields are the key fields that only say where a key is drawn
+var positionFields = map[string]bool{"customX": true, "customY": true, "isCustomPosition": true}
+
+// DiffLayouts compares two layouts, given as layout JSON as exported by ExportLayout,
+// key by key across layers and modifier combinations
+func (a *App) DiffLayouts(layoutA, layoutB string) (string, error) {
+	old, err := FromJSON(layoutA)
+	if err != nil {
+		return "", fmt.Errorf("invalid first layout: %v", err)
+	}
+	new, err := FromJSON(layoutB)
+	if err != nil {
+		return "", fmt.Errorf("invalid second layout: %v", err)
+	}
+
+	return newLayoutDiff(diffLayouts(old, new)).ToJSON()
+}
+
+// DiffProfiles compares the layouts and settings of two profiles. Which layout, layer
+// and modifiers each has active is left out.
+func (a *App) DiffProfiles(profileA, profileB string) (string, error) {
+	a.lock()
+	var snapshots []Profile
+	for _, profileID := range []string{profileA, profileB} {
+		profile := a.profileManager.GetProfile(profileID)
+		if profile == nil {
+			a.unlock()
+			return "", fmt.Errorf("profile not found: %s", profileID)
+		}
+		if err := a.ensureProfileLoaded(profile); err != nil {
+			a.unlock()
+			return "", err
+		}
+	}
+	// Loading may quarantine profiles, so take the snapshots once both are loaded
+	for _, profileID := range []string{profileA, profileB} {
+		profile := a.profileManager.GetProfile(profileID)
+		if profile == nil {
+			a.unlock()
+			return "", fmt.Errorf("profile not found: %s", profileID)
+		}
+		snapshots = append(snapshots, profile.Clone())
+	}
+	a.unlock()
+
+	var changes []ProfileChange
+	for _, change := range diffProfiles(&snapshots[0], &snapshots[1]) {
+		if change.Scope != "state" {
+			changes = append(changes, change)
+		}
+	}
+	return newLayoutDiff(changes).ToJSON()
+}
+
+// newLayoutDiff counts and summarizes a list of changes
+func newLayoutDiff(changes []ProfileChange) *LayoutDiff {
+	diff := &LayoutDiff{
+		Changes: changes,
+		Counts:  make(map[string]int),
+		Summary: formatChanges(changes),
+	}
+	if diff.Changes == nil {
+		diff.Changes = []ProfileChange{}
+	}
+	for _, change := range changes {
+		diff.Counts[change.Kind]++
+	}
+	return diff
+}
+
+// ToJSON converts the diff to JSON
+func (d *LayoutDiff) ToJSON() (string, error) {
+	data, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// diffProfiles lists what changed between two versions of a profile. Timestamps are
+// ignored; which layout, layer and modifiers are active is reported with scope "state".
+func diffProfiles(old, new *Profile) []ProfileChange {
+	var changes []ProfileChange
+
+	property := func(scope, field string, oldValue, newValue interface{}) {
+		if !reflect.DeepEqual(oldValue, newValue) {
+			changes = append(changes, ProfileChange{Kind: "modified", Scope: scope, Fields: []string{field}, Old: oldValue, New: newValue})
+		}
+	}
+	property("profile", "name", old.Name, new.Name)
+	property("profile", "icon", imageDigest(old.Icon), imageDigest(new.Icon))
+	property("profile", "backgroundColor", old.BackgroundColor, new.BackgroundColor)
+	property("profile", "description", old.Description, new.Description)
+	for _, name := range unionKeys(old.ColorSchemes, new.ColorSchemes) {
+		property("profile", "colorSchemes."+name, old.ColorSchemes[name], new.ColorSchemes[name])
+	}
+	property("profile", "colorByCategory", old.ColorByCategory, new.ColorByCategory)
+	if len(old.SavedFilters) > 0 || len(new.SavedFilters) > 0 {
+		property("profile", "savedFilters", old.SavedFilters, new.SavedFilters)
+	}
+	property("state", "currentLayout", old.CurrentLayout, new.CurrentLayout)
+	property("state", "currentLayer", old.CurrentLayer, new.CurrentLayer)
+	property("state", "activeModifiers", emptyIfNil(old.ActiveModifiers), emptyIfNil(new.ActiveModifiers))
+
+	oldLayouts := make(map[string]*KeyboardLayout)
+	for i := range old.Layouts {
+		oldLayouts[old.Layouts[i].Name] = &old.Layouts[i]
+	}
+	newLayouts := make(map[string]bool)
+	for i := range new.Layouts {
+		layout := &new.Layouts[i]
+		newLayouts[layout.Name] = true
+
+		previous, exists := oldLayouts[layout.Name]
+		if !exists {
+			changes = append(changes, ProfileChange{Kind: "added", Scope: "layout", Layout: layout.Name})
+			continue
+		}
+		changes = append(changes, diffLayouts(previous, layout)...)
+	}
+	for _, layout := range old.Layouts {
+		if !newLayouts[layout.Name] {
+			changes = append(changes, ProfileChange{Kind: "removed", Scope: "layout", Layout: layout.Name})
+		}
+	}
+
+	return changes
+}
+
+// diffLayouts lists what changed between two versions of a layout
+func diffLayouts(old, new *KeyboardLayout) []ProfileChange {
+	var changes []ProfileChange
+
+	if old.Description != new.Description {
+		changes = append(changes, ProfileChange{Kind: "modified", Scope: "layout", Layout: new.Name, Fields: []string{"description"}, Old: old.Description, New: new.Description})
+	}
+	// Reordering only counts when the layers are the same; adding or removing one is reported below
+	if layers := unionKeys(old.Layers, new.Layers); len(layers) == len(old.Layers) && len(layers) == len(new.Layers) {
+		if oldOrder, newOrder := old.GetLayerNames(), new.GetLayerNames(); !reflect.DeepEqual(oldOrder, newOrder) {
+			changes = append(changes, ProfileChange{Kind: "modified", Scope: "layout", Layout: new.Name, Fields: []string{"layerOrder"}, Old: oldOrder, New: newOrder})
+		}
+	}
+
+	for _, layer := range unionKeys(old.Layers, new.Layers) {
+		oldKeys, inOld := old.Layers[layer]
+		newKeys, inNew := new.Layers[layer]
+		switch {
+		case !inOld:
+			changes = append(changes, ProfileChange{Kind: "added", Scope: "layer", Layout: new.Name, Layer: layer})
+			continue
+		case !inNew:
+			changes = append(changes, ProfileChange{Kind: "removed", Scope: "layer", Layout: new.Name, Layer: layer})
+			continue
+		}
+		if oldInfo, newInfo := old.GetLayerInfo(layer), new.GetLayerInfo(layer); oldInfo != newInfo {
+			changes = append(changes, ProfileChange{Kind: "modified", Scope: "layer", Layout: new.Name, Layer: layer, Fields: layerInfoFields(oldInfo, newInfo), Old: oldInfo, New: newInfo})
+		}
+		changes = append(changes, diffKeys(oldKeys, newKeys, new.Name, layer, "")...)
+
+		oldCombos, newCombos := old.ModifierMaps[layer], new.ModifierMaps[layer]
+		for _, combo := range unionKeys(oldCombos, newCombos) {
+			oldComboKeys, inOld := oldCombos[combo]
+			newComboKeys, inNew := newCombos[combo]
+			switch {
+			case !inOld:
+				changes = append(changes, ProfileChange{Kind: "added", Scope: "combo", Layout: new.Name, Layer: layer, Modifiers: combo})
+			case !inNew:
+				changes = append(changes, ProfileChange{Kind: "removed", Scope: "combo", Layout: new.Name, Layer: layer, Modifiers: combo})
+			default:
+				changes = append(changes, diffKeys(oldComboKeys, newComboKeys, new.Name, layer, combo)...)
+			}
+		}
+	}
+
+	return changes
+}
+
+// diffKeys lists added, removed and modified keys, matched by ID
+func diffKeys(old, new []Key, layout, layer, modifiers string) []ProfileChange {
+	var changes []ProfileChange
+
+	oldByID := make(map[string]Key, len(old))
+	for _, key := range old {
+		oldByID[key.ID] = key
+	}
+	newIDs := make(map[string]bool, len(new))
+	for _, key := range new {
+		newIDs[key.ID] = true
+
+		change := ProfileChange{Scope: "key", Layout: layout, Layer: layer, Modifiers: modifiers, KeyID: key.ID}
+		previous, exists := oldByID[key.ID]
+		if !exists {
+			change.Kind = "added"
+			change.New = keyFieldValues(key, changedKeyFields(Key{}, key))
+			changes = append(changes, change)
+			continue
+		}
+		if fields := changedKeyFields(previous, key); len(fields) > 0 {
+			change.Kind = "modified"
+			if onlyPositionChanged(fields) {
+				change.Kind = "moved"
+			}
+			change.Fields = fields
+			change.Old, change.New = keyFieldValues(previous, fields), keyFieldValues(key, fields)
+			change.oldKey, change.newKey = &previous, &key
+			changes = append(changes, change)
+		}
+	}
+	for _, key := range old {
+		if !newIDs[key.ID] {
+			changes = append(changes, ProfileChange{Kind: "removed", Scope: "key", Layout: layout, Layer: layer, Modifiers: modifiers, KeyID: key.ID,
+				Old: keyFieldValues(key, changedKeyFields(Key{}, key))})
+		}
+	}
+
+	return changes
+}
+
+// changedKeyFields returns the JSON names of the fields that differ between two keys
+func changedKeyFields(old, new Key) []string {
+	var fields []string
+
+	oldValue, newValue := reflect.ValueOf(old), reflect.ValueOf(new)
+	keyType := oldValue.Type()
+	for i := 0; i < keyType.NumField(); i++ {
+		field := keyType.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		a, b := oldValue.Field(i).Interface(), newValue.Field(i).Interface()
+		kind := field.Type.Kind()
+		if (kind == reflect.Slice || kind == reflect.Map) && oldValue.Field(i).Len() == 0 && newValue.Field(i).Len() == 0 {
+			continue // nil and empty are the same on disk for our purposes
+		}
+		if !reflect.DeepEqual(a, b) {
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if name == "" {
+				name = field.Name
+			}
+			fields = append(fields, name)
+		}
+	}
+
+	return fields
+}
+
+// keyFieldValues returns the given fields of a key by JSON name, for reporting a change.
+// Images are replaced by their digest, so a change stays small however large its images
+// are.
+func keyFieldValues(key Key, fields []string) map[string]interface{} {
+	values := make(map[string]interface{}, len(fields))
+	keyValue := reflect.ValueOf(key)
+	for _, field := range fields {
+		for i := 0; i < keyValue.NumField(); i++ {
+			if name := strings.Split(keyValue.Type().Field(i).Tag.Get("json"), ",")[0]; name == field {
+				values[field] = keyValue.Field(i).Interface()
+			}
+		}
+	}
+
+	if _, exists := values["imageData"]; exists {
+		values["imageData"] = imageDigest(key.ImageData)
+	}
+	if _, exists := values["legends"]; exists {
+		legends := make(map[string]Legend, len(key.Legends))
+		for slot, legend := range key.Legends {
+			legend.ImageData = imageDigest(legend.ImageData)
+			legends[slot] = legend
+		}
+		values["legends"] = legends
+	}
+	return values
+}
+
+// imageDigest stands in for an inline image in a change: "sha256:" and the hash of the
+// data URL, or empty for no image
+func imageDigest(image string) string {
+	if image == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(image))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// onlyPositionChanged reports whether all the changed fields are position fields
+func onlyPositionChanged(fields []string) bool {
+	for _, field := range fields {
+		if !positionFields[field] {
+			return false
+		}
+	}
+	return true
+}
+
+// Describe returns a one-line description of the change, e.g. "Update key R04 on raise/ctrl"
+func (c ProfileChange) Describe() string {
+	location := c.Layer
+	if c.Modifiers != "" {
+		location += "/" + c.Modifiers
+	}
+
+	switch c.Scope {
+	case "key":
+		switch c.Kind {
+		case "added":
+			return fmt.Sprintf("Add key %s on %s", c.KeyID, location)
+		case "removed":
+			return fmt.Sprintf("Remove key %s from %s", c.KeyID, location)
+		case "moved":
+			return fmt.Sprintf("Move key %s on %s", c.KeyID, location)
+		default:
+			return fmt.Sprintf("Update key %s on %s", c.KeyID, location)
+		}
+	case "combo":
+		if c.Kind == "added" {
+			return fmt.Sprintf("Add combination %s", location)
+		}
+		return fmt.Sprintf("Remove combination %s", location)
+	case "layer":
+		switch c.Kind {
+		case "added":
+			return fmt.Sprintf("Add layer %s to %s", c.Layer, c.Layout)
+		case "removed":
+			return fmt.Sprintf("Remove layer %s from %s", c.Layer, c.Layout)
+		default:
+			return fmt.Sprintf("Update %s of layer %s in %s", strings.Join(c.Fields, ", "), c.Layer, c.Layout)
+		}
+	case "layout":
+		switch c.Kind {
+		case "added":
+			return fmt.Sprintf("Add layout %s", c.Layout)
+		case "removed":
+			return fmt.Sprintf("Remove layout %s", c.Layout)
+		default:
+			return fmt.Sprintf("Update %s of layout %s", strings.Join(c.Fields, ", "), c.Layout)
+		}
+	case "profile":
+		switch c.Kind {
+		case "added":
+			return fmt.Sprintf("Add profile %v", c.New)
+		case "removed":
+			return fmt.Sprintf("Remove profile %v", c.Old)
+		}
+		if len(c.Fields) == 1 && c.Fields[0] == "name" {
+			return fmt.Sprintf("Rename profile %v to %v", c.Old, c.New)
+		}
+		return fmt.Sprintf("Update profile %s", strings.Join(c.Fields, ", "))
+	default:
+		return fmt.Sprintf("Change %s to %v", strings.Join(c.Fields, ", "), c.New)
+	}
+}
+
+// Details describes what a modified or moved key changed, e.g.
+// `label "Copy" -> "Paste", position (0, 0) -> (120, 40)`. Other changes have no details.
+func (c ProfileChange) Details() string {
+	if c.Scope == "layout" && c.Kind == "modified" {
+		if oldOrder, isOrder := c.Old.([]string); isOrder {
+			return fmt.Sprintf("%s -> %s", strings.Join(oldOrder, ", "), strings.Join(c.New.([]string), ", "))
+		}
+		return fmt.Sprintf("%q -> %q", c.Old, c.New)
+	}
+	if oldInfo, isInfo := c.Old.(LayerInfo); isInfo && c.Scope == "layer" {
+		return layerInfoDetails(oldInfo, c.New.(LayerInfo), c.Fields)
+	}
+	if c.Scope != "key" || c.oldKey == nil || c.newKey == nil {
+		return ""
+	}
+	old, new := *c.oldKey, *c.newKey
+
+	var details []string
+	imageDone, positionDone := false, false
+	for _, field := range c.Fields {
+		switch {
+		case field == "label":
+			details = append(details, fmt.Sprintf("label %q -> %q", old.Label, new.Label))
+		case field == "description":
+			details = append(details, fmt.Sprintf("description %q -> %q", old.Description, new.Description))
+		case field == "color":
+			details = append(details, fmt.Sprintf("color %s -> %s", orNone(old.Color), orNone(new.Color)))
+		case field == "imageData" || field == "imagePath":
+			if imageDone {
+				continue
+			}
+			imageDone = true
+			hadImage, hasImage := old.ImageData != "" || old.ImagePath != "", new.ImageData != "" || new.ImagePath != ""
+			switch {
+			case !hadImage:
+				details = append(details, "image added")
+			case !hasImage:
+				details = append(details, "image removed")
+			default:
+				details = append(details, "image changed")
+			}
+		case field == "legends":
+			details = append(details, legendChanges(old.Legends, new.Legends)...)
+		case positionFields[field]:
+			if positionDone {
+				continue
+			}
+			positionDone = true
+			details = append(details, fmt.Sprintf("position %s -> %s", keyPosition(old), keyPosition(new)))
+		default:
+			oldValue, newValue := reflect.ValueOf(old), reflect.ValueOf(new)
+			for i := 0; i < oldValue.NumField(); i++ {
+				if strings.Split(oldValue.Type().Field(i).Tag.Get("json"), ",")[0] == field {
+					details = append(details, fmt.Sprintf("%s %v -> %v", field, oldValue.Field(i).Interface(), newValue.Field(i).Interface()))
+				}
+			}
+		}
+	}
+	return strings.Join(details, ", ")
+}
+
+// legendChanges describes how the legends of a key changed, slot by slot
+func legendChanges(old, new map[string]Legend) []string {
+	var details []string
+	for _, slot := range legendSlotsOf(old, new) {
+		before, after := old[slot], new[slot]
+		switch {
+		case before == after:
+		case before.isEmpty():
+			details = append(details, fmt.Sprintf("%s legend added", slot))
+		case after.isEmpty():
+			details = append(details, fmt.Sprintf("%s legend removed", slot))
+		case before.Text != after.Text:
+			details = append(details, fmt.Sprintf("%s legend %q -> %q", slot, before.Text, after.Text))
+		default:
+			details = append(details, fmt.Sprintf("%s legend changed", slot))
+		}
+	}
+	return details
+}
+
+// keyPosition describes where a key is drawn
+func keyPosition(key Key) string {
+	if !key.IsCustomPosition {
+		return fmt.Sprintf("row %d col %d", key.Row, key.Col)
+	}
+	return fmt.Sprintf("(%g, %g)", key.CustomX, key.CustomY)
+}
+
+// orNone shows an empty value as "none"
+func orNone(value string) string {
+	if value == "" {
+		return "none"
+	}
+	return value
+}
+
+// formatChanges writes a readable summary of changes: a line with the counts, then
+// one line per change, grouped under the layout it is in
+func formatChanges(changes []ProfileChange) string {
+	if len(changes) == 0 {
+		return "No differences"
+	}
+
+	counts := make(map[string]int)
+	for _, change := range changes {
+		counts[change.Kind]++
+	}
+	var totals []string
+	for _, kind := range []string{"added", "removed", "modified", "moved"} {
+		if counts[kind] > 0 {
+			totals = append(totals, fmt.Sprintf("%d %s", counts[kind], kind))
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(strings.Join(totals, ", "))
+	b.WriteString("\n")
+
+	layout := ""
+	for _, change := range changes {
+		line := change.Describe()
+		if details := change.Details(); details != "" {
+			line += ": " + details
+		}
+
+		// Whole layouts and profile settings aren't grouped
+		if change.Scope == "profile" || (change.Scope == "layout" && change.Kind != "modified") {
+			layout = ""
+			b.WriteString(line + "\n")
+			continue
+		}
+		if change.Layout != layout {
+			layout = change.Layout
+			b.WriteString(layout + ":\n")
+		}
+		b.WriteString("  " + line + "\n")
+	}
+	return b.String()
+}
+
+// summarizeChanges describes a set of changes to one profile in a single line.
+// View state changes are left out; the result is empty if nothing else changed.
+func summarizeChanges(profileName string, changes []ProfileChange) string {
+	var content []ProfileChange
+	for _, change := range changes {
+		if change.Scope != "state" {
+			content = append(content, change)
+		}
+	}
+
+	switch len(content) {
+	case 0:
+		return ""
+	case 1:
+		return content[0].Describe()
+	}
+
+	// Several key edits in one place read better as a count
+	first := content[0]
+	sameLocation := true
+	for _, change := range content {
+		if change.Scope != "key" || change.Layout != first.Layout || change.Layer != first.Layer || change.Modifiers != first.Modifiers {
+			sameLocation = false
+			break
+		}
+	}
+	if sameLocation {
+		location := first.Layer
+		if first.Modifiers != "" {
+			location += "/" + first.Modifiers
+		}
+		return fmt.Sprintf("Update %d keys on %s", len(content), location)
+	}
+
+	return fmt.Sprintf("Update %d items in %s", len(content), profileName)
+}
+
+// unionKeys returns the keys of two maps, sorted
+func unionKeys[V any](a, b map[string]V) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	keys := make([]string, 0, len(a)+len(b))
+	for _, m := range []map[string]V{a, b} {
+		for key := range m {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// emptyIfNil treats a nil slice as empty so the two compare equal
+func emptyIfNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+// layerInfoFields lists the JSON names of the layer settings that differ
+func layerInfoFields(old, new LayerInfo) []string {
+	var fields []string
+	oldValue, newValue := reflect.ValueOf(old), reflect.ValueOf(new)
+	for i := 0; i < oldValue.NumField(); i++ {
+		if oldValue.Field(i).Interface() != newValue.Field(i).Interface() {
+			name, _, _ := strings.Cut(oldValue.Type().Field(i).Tag.Get("json"), ",")
+			fields = append(fields, name)
+		}
+	}
+	return fields
+}
+
+// layerInfoDetails describes changed layer settings, e.g. `color none -> #ff0000, icon added`
+func layerInfoDetails(old, new LayerInfo, fields []string) string {
+	var details []string
+	for _, field := range fields {
+		switch field {
+		case "displayName":
+			details = append(details, fmt.Sprintf("name %q -> %q", old.DisplayName, new.DisplayName))
+		case "color":
+			details = append(details, fmt.Sprintf("color %s -> %s", orNone(old.Color), orNone(new.Color)))
+		case "icon":
+			switch {
+			case old.Icon == "":
+				details = append(details, "icon added")
+			case new.Icon == "":
+				details = append(details, "icon removed")
+			default:
+				details = append(details, "icon changed")
+			}
+		case "description":
+			details = append(details, fmt.Sprintf("description %q -> %q", old.Description, new.Description))
+		case "activationHint":
+			details = append(details, fmt.Sprintf("activation hint %q -> %q", old.ActivationHint, new.ActivationHint))
+		case "protected":
+			details = append(details, fmt.Sprintf("protected %t -> %t", old.Protected, new.Protected))
+		}
+	}
+	return strings.Join(details, ", ")
+}
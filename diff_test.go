@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffKeysReportsChangedFields(t *testing.T) {
+	old := []Key{
+		{ID: "L00", Label: "Esc", ImageData: testImage, Color: "#e0e0e0"},
+		{ID: "L01", Label: "Q", Legends: map[string]Legend{"topRight": {ImageData: testImage}}},
+	}
+	new := []Key{
+		{ID: "L00", Label: "Tab", ImageData: "data:image/png;base64,AAAA", Color: "#e0e0e0"},
+		{ID: "L02", Label: "W", ImageData: testImage},
+	}
+
+	changes := diffKeys(old, new, "Corne", "base", "")
+	data, err := json.Marshal(changes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "base64") {
+		t.Errorf("changes hold inline images: %s", data)
+	}
+
+	byKey := make(map[string]ProfileChange)
+	for _, change := range changes {
+		byKey[change.KeyID] = change
+	}
+	modified := byKey["L00"]
+	if want := []string{"label", "imageData"}; !reflect.DeepEqual(modified.Fields, want) {
+		t.Errorf("fields = %v, want %v", modified.Fields, want)
+	}
+	oldValues, newValues := modified.Old.(map[string]interface{}), modified.New.(map[string]interface{})
+	if len(oldValues) != 2 || oldValues["label"] != "Esc" || newValues["label"] != "Tab" {
+		t.Errorf("old %v, new %v; want only the changed fields", oldValues, newValues)
+	}
+	if oldImage, _ := oldValues["imageData"].(string); !strings.HasPrefix(oldImage, "sha256:") || oldImage == newValues["imageData"] {
+		t.Errorf("image digests %v and %v, want two different digests", oldValues["imageData"], newValues["imageData"])
+	}
+	if want := `label "Esc" -> "Tab", image changed`; modified.Details() != want {
+		t.Errorf("details = %q, want %q", modified.Details(), want)
+	}
+
+	if added := byKey["L02"]; added.Kind != "added" || added.New.(map[string]interface{})["label"] != "W" {
+		t.Errorf("L02 = %+v, want it added with its label", added)
+	}
+	if removed := byKey["L01"]; removed.Kind != "removed" || removed.Old.(map[string]interface{})["legends"] == nil {
+		t.Errorf("L01 = %+v, want it removed with its legends", removed)
+	}
+}
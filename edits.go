@@ -0,0 +1,262 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A key edit batch changes many keys of the current layout at once. Every edit is
+// checked against a copy of the layout first, so a batch is applied completely or
+// not at all, and saved once.
+
+// KeyEdit is a single change in a batch
+type KeyEdit struct {
+	Op        string   `json:"op"`                  // "set", "clear", "recolor" or "move"
+	Layer     string   `json:"layer,omitempty"`     // Defaults to the current layer
+	Modifiers []string `json:"modifiers,omitempty"` // Modifier combination; empty for the layer itself
+	KeyID     string   `json:"keyId"`
+	Field     string   `json:"field,omitempty"` // Field to set or clear; clear without a field clears the label, description and image
+	Value     string   `json:"value,omitempty"` // New value for set, new color for recolor
+	X         float64  `json:"x,omitempty"`     // New position for move
+	Y         float64  `json:"y,omitempty"`
+}
+
+// KeyEditBatch is a list of edits to apply together
+type KeyEditBatch struct {
+	Edits []KeyEdit `json:"edits"`
+}
+
+// KeyEditResult reports an applied batch
+type KeyEditResult struct {
+	Applied int `json:"applied"` // Number of edits applied
+	Keys    int `json:"keys"`    // Number of distinct keys changed
+}
+
+// editableKeyFields are the fields set and clear accept
+var editableKeyFields = map[string]bool{
+	"label":       true,
+	"description": true,
+	"color":       true,
+	"imageData":   true,
+	"imagePath":   true,
+}
+
+// ApplyKeyEdits applies a batch of key edits to the current layout. batchJSON is a
+// KeyEditBatch. If any edit is invalid nothing is changed, and the error lists every
+// invalid edit.
+func (a *App) ApplyKeyEdits(batchJSON string) (string, error) {
+	var batch KeyEditBatch
+	if err := json.Unmarshal([]byte(batchJSON), &batch); err != nil {
+		return "", fmt.Errorf("invalid edit batch: %v", err)
+	}
+	if len(batch.Edits) == 0 {
+		return "", fmt.Errorf("edit batch is empty")
+	}
+
+	a.lock()
+	defer a.unlock()
+
+	activeProfile, currentLayout, err := a.activeLayout()
+	if err != nil {
+		return "", err
+	}
+
+	edited := currentLayout.Clone()
+	changed, err := applyKeyEdits(&edited, activeProfile.CurrentLayer, batch.Edits)
+	if err != nil {
+		return "", err
+	}
+
+	*currentLayout = edited
+	currentLayout.ModifiedAt = time.Now()
+	activeProfile.ModifiedAt = time.Now()
+	for _, ref := range changed {
+		if key := findKey(currentLayout.keysFor(ref.layer, ref.combo, false), ref.keyID); key != nil {
+			a.notifyKeyUpdated(activeProfile, ref.layer, ref.modifiers, *key)
+		}
+	}
+	a.requestSave(activeProfile.ID)
+
+	result := KeyEditResult{Applied: len(batch.Edits), Keys: len(changed)}
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal edit result: %v", err)
+	}
+	return string(data), nil
+}
+
+// keyRef identifies a key within a layout
+type keyRef struct {
+	layer     string
+	combo     string
+	modifiers []string
+	keyID     string
+}
+
+// applyKeyEdits applies edits to a layout in order and returns the keys they changed,
+// in the order first changed. On error the layout is left partly edited, so callers
+// pass a copy.
+func applyKeyEdits(layout *KeyboardLayout, currentLayer string, edits []KeyEdit) ([]keyRef, error) {
+	var problems []string
+	var changed []keyRef
+	seen := make(map[string]bool)
+
+	for i, edit := range edits {
+		layer := edit.Layer
+		if layer == "" {
+			layer = currentLayer
+		}
+		ref := keyRef{layer: layer, combo: comboName(edit.Modifiers), keyID: edit.KeyID}
+		location := layer
+		if ref.combo != "" {
+			location += "/" + ref.combo
+		}
+
+		key, err := layout.findEditableKey(ref)
+		if err == nil {
+			err = applyKeyEdit(key, edit)
+		}
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("edit %d (%s on %s): %v", i+1, edit.KeyID, location, err))
+			continue
+		}
+
+		if id := location + "/" + ref.keyID; !seen[id] {
+			seen[id] = true
+			ref.modifiers = cloneStrings(key.Modifiers)
+			changed = append(changed, ref)
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("no edits applied: %s", strings.Join(problems, "; "))
+	}
+	return changed, nil
+}
+
+// findEditableKey finds the key an edit refers to
+func (kl *KeyboardLayout) findEditableKey(ref keyRef) (*Key, error) {
+	keys := kl.keysFor(ref.layer, ref.combo, true)
+	if keys == nil {
+		return nil, fmt.Errorf("layer %s does not exist", ref.layer)
+	}
+	if key := findKey(keys, ref.keyID); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("key not found")
+}
+
+// keysFor returns the keys of a layer, or of one of its modifier combinations, or nil
+// if the layer doesn't exist. A combination that was never edited has no keys stored;
+// it is returned as blank keys laid out like the layer's, as the keyboard shows it.
+// With store those are added to the layout first, so changes to them are kept.
+func (kl *KeyboardLayout) keysFor(layer, combo string, store bool) []Key {
+	baseKeys, exists := kl.Layers[layer]
+	if !exists || combo == "" {
+		return baseKeys
+	}
+	if keys, exists := kl.ModifierMaps[layer][combo]; exists {
+		return keys
+	}
+
+	keys := blankComboKeys(baseKeys, combo)
+	if store {
+		if kl.ModifierMaps == nil {
+			kl.ModifierMaps = make(map[string]map[string][]Key)
+		}
+		if kl.ModifierMaps[layer] == nil {
+			kl.ModifierMaps[layer] = make(map[string][]Key)
+		}
+		kl.ModifierMaps[layer][combo] = keys
+	}
+	return keys
+}
+
+// findKey returns the key with the given ID
+func findKey(keys []Key, keyID string) *Key {
+	for i := range keys {
+		if keys[i].ID == keyID {
+			return &keys[i]
+		}
+	}
+	return nil
+}
+
+// applyKeyEdit applies one edit to a key
+func applyKeyEdit(key *Key, edit KeyEdit) error {
+	switch edit.Op {
+	case "set":
+		if !editableKeyFields[edit.Field] {
+			return fmt.Errorf("unknown field %q", edit.Field)
+		}
+		return setKeyField(key, edit.Field, edit.Value)
+	case "clear":
+		if edit.Field == "" {
+			key.Label, key.Description, key.ImageData, key.ImagePath = "", "", "", ""
+			return nil
+		}
+		if !editableKeyFields[edit.Field] {
+			return fmt.Errorf("unknown field %q", edit.Field)
+		}
+		return setKeyField(key, edit.Field, "")
+	case "recolor":
+		if edit.Value == "" {
+			return fmt.Errorf("recolor needs a color")
+		}
+		return setKeyField(key, "color", edit.Value)
+	case "move":
+		if edit.X < 0 || edit.Y < 0 {
+			return fmt.Errorf("position (%g, %g) is negative", edit.X, edit.Y)
+		}
+		key.CustomX, key.CustomY, key.IsCustomPosition = edit.X, edit.Y, true
+		return nil
+	default:
+		return fmt.Errorf("unknown operation %q", edit.Op)
+	}
+}
+
+// setKeyField sets one of the editable fields of a key, validating colors and images
+func setKeyField(key *Key, field, value string) error {
+	switch field {
+	case "label":
+		key.Label = value
+	case "description":
+		key.Description = value
+	case "color":
+		if value != "" && !isValidHexColor(value) {
+			return fmt.Errorf("invalid color %q", value)
+		}
+		key.Color, key.CategoryColor = value, false
+	case "imageData":
+		if value != "" && !isValidBase64Image(value) {
+			return fmt.Errorf("invalid image data")
+		}
+		key.ImageData = value
+	case "imagePath":
+		key.ImagePath = value
+	}
+	return nil
+}
+
+// comboName returns the name a set of modifiers is stored under in ModifierMaps:
+// ctrl, shift, alt and gui in that order, then other modifiers alphabetically
+func comboName(modifiers []string) string {
+	sorted := cloneStrings(modifiers)
+	modOrder := map[string]int{"ctrl": 0, "shift": 1, "alt": 2, "gui": 3}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		orderI, builtinI := modOrder[sorted[i]]
+		orderJ, builtinJ := modOrder[sorted[j]]
+		switch {
+		case builtinI && builtinJ:
+			return orderI < orderJ
+		case builtinI != builtinJ:
+			return builtinI
+		default:
+			return sorted[i] < sorted[j]
+		}
+	})
+	return strings.Join(sorted, "+")
+}
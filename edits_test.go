@@ -0,0 +1,135 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestComboName(t *testing.T) {
+	tests := []struct {
+		modifiers []string
+		want      string
+	}{
+		{nil, ""},
+		{[]string{"shift"}, "shift"},
+		{[]string{"gui", "ctrl"}, "ctrl+gui"},
+		{[]string{"alt", "shift", "gui", "ctrl"}, "ctrl+shift+alt+gui"},
+		{[]string{"hyper", "shift"}, "shift+hyper"},
+		{[]string{"meh", "hyper", "alt"}, "alt+hyper+meh"},
+	}
+	for _, test := range tests {
+		if got := comboName(test.modifiers); got != test.want {
+			t.Errorf("comboName(%v) = %q, want %q", test.modifiers, got, test.want)
+		}
+	}
+}
+
+func TestComboNameLeavesInputAlone(t *testing.T) {
+	modifiers := []string{"gui", "ctrl"}
+	comboName(modifiers)
+	if modifiers[0] != "gui" || modifiers[1] != "ctrl" {
+		t.Errorf("comboName reordered its argument: %v", modifiers)
+	}
+}
+
+func TestApplyKeyEdits(t *testing.T) {
+	tests := []struct {
+		name    string
+		edits   []KeyEdit
+		wantErr string // Empty if the batch applies
+		want    map[string]string
+	}{
+		{
+			name: "all valid",
+			edits: []KeyEdit{
+				{Op: "set", KeyID: "L00", Field: "label", Value: "Esc"},
+				{Op: "recolor", KeyID: "L01", Value: "#ff0000"},
+				{Op: "set", KeyID: "L00", Field: "description", Value: "Escape"},
+			},
+			want: map[string]string{"L00": "Esc", "L01": ""},
+		},
+		{
+			name: "unknown key",
+			edits: []KeyEdit{
+				{Op: "set", KeyID: "L00", Field: "label", Value: "Esc"},
+				{Op: "set", KeyID: "NOPE", Field: "label", Value: "x"},
+			},
+			wantErr: "edit 2 (NOPE on base)",
+		},
+		{
+			name: "invalid color and unknown field",
+			edits: []KeyEdit{
+				{Op: "recolor", KeyID: "L00", Value: "red"},
+				{Op: "set", KeyID: "L01", Field: "bogus", Value: "x"},
+			},
+			wantErr: "edit 1 (L00 on base): invalid color \"red\"; edit 2 (L01 on base): unknown field",
+		},
+		{
+			name: "missing layer",
+			edits: []KeyEdit{
+				{Op: "set", KeyID: "L00", Field: "label", Value: "Esc"},
+				{Op: "set", Layer: "nope", KeyID: "L00", Field: "label", Value: "x"},
+			},
+			wantErr: "layer nope does not exist",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			layout := DefaultCorneLayout()
+			edited := layout.Clone()
+			changed, err := applyKeyEdits(&edited, "base", test.edits)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("error = %v, want one containing %q", err, test.wantErr)
+				}
+				if changed != nil {
+					t.Errorf("failed batch reported changes: %v", changed)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyKeyEdits: %v", err)
+			}
+			if len(changed) != len(test.want) {
+				t.Errorf("changed %d keys, want %d", len(changed), len(test.want))
+			}
+			for keyID, label := range test.want {
+				if key := findKey(edited.Layers["base"], keyID); key == nil || key.Label != label {
+					t.Errorf("%s = %+v, want label %q", keyID, key, label)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyKeyEditsIsAllOrNothing(t *testing.T) {
+	app := NewApp(t.TempDir())
+	t.Cleanup(func() { app.shutdown(nil) })
+
+	valid := `{"op":"set","keyId":"L00","field":"label","value":"Esc"}`
+	comboEdit := `{"op":"set","modifiers":["gui","ctrl"],"keyId":"L01","field":"label","value":"Lock"}`
+	invalid := `{"op":"set","keyId":"NOPE","field":"label","value":"x"}`
+	if _, err := app.ApplyKeyEdits(`{"edits":[` + valid + `,` + comboEdit + `,` + invalid + `]}`); err == nil {
+		t.Fatal("batch with an unknown key applied")
+	}
+	if got := testKey(t, app, "L00").Label; got != "" {
+		t.Errorf("failed batch changed L00 to %q", got)
+	}
+
+	if _, err := app.ApplyKeyEdits(`{"edits":[` + valid + `,` + comboEdit + `]}`); err != nil {
+		t.Fatalf("ApplyKeyEdits: %v", err)
+	}
+	if got := testKey(t, app, "L00").Label; got != "Esc" {
+		t.Errorf("L00 = %q, want Esc", got)
+	}
+
+	// Modifiers given in any order edit the combination stored under comboName
+	app.mu.RLock()
+	defer app.mu.RUnlock()
+	activeProfile := app.profileManager.GetActiveProfile()
+	layout := activeProfile.GetCurrentLayout()
+	if key := findKey(layout.ModifierMaps[activeProfile.CurrentLayer]["ctrl+gui"], "L01"); key == nil || key.Label != "Lock" {
+		t.Errorf("ctrl+gui L01 = %+v, want label Lock", key)
+	}
+}
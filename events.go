@@ -0,0 +1,120 @@
+package main
+
+import (
+	"time"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// Event names emitted to the frontend through the Wails runtime
+const (
+	EventProfileChanged  = "profile:changed"  // Profile list, active profile or profile appearance changed
+	EventLayerChanged    = "layer:changed"    // Current layer, layer set or active modifiers changed
+	EventKeyUpdated      = "key:updated"      // A single key was modified
+	EventSaveFailed      = "save:error"       // The background writer failed to persist profiles
+	EventProfileConflict = "profile:conflict" // A profile changed on disk while it had unsaved edits
+)
+
+// ProfileChangedEvent is the payload of EventProfileChanged
+type ProfileChangedEvent struct {
+	ProfileID     string `json:"profileId"`     // Profile that changed
+	ActiveProfile string `json:"activeProfile"` // Active profile after the change
+	Reason        string `json:"reason"`        // e.g. "created", "deleted", "activated"
+}
+
+// LayerChangedEvent is the payload of EventLayerChanged
+type LayerChangedEvent struct {
+	ProfileID       string   `json:"profileId"`
+	Layout          string   `json:"layout"`
+	Layer           string   `json:"layer"`
+	ActiveModifiers []string `json:"activeModifiers"`
+	Reason          string   `json:"reason"` // e.g. "layer", "modifiers", "added", "removed"
+}
+
+// KeyUpdatedEvent is the payload of EventKeyUpdated
+type KeyUpdatedEvent struct {
+	ProfileID string   `json:"profileId"`
+	Layout    string   `json:"layout"`
+	Layer     string   `json:"layer"`
+	Modifiers []string `json:"modifiers"` // Modifier combination the key belongs to (empty for the layer itself)
+	Key       Key      `json:"key"`
+}
+
+// SaveFailedEvent is the payload of EventSaveFailed
+type SaveFailedEvent struct {
+	Error string    `json:"error"`
+	Time  time.Time `json:"time"`
+}
+
+// pendingEvent is an event queued while the state lock is held
+type pendingEvent struct {
+	name    string
+	payload interface{}
+}
+
+// lock acquires the state lock for a mutation
+func (a *App) lock() {
+	a.mu.Lock()
+}
+
+// unlock releases the state lock and emits the events queued while it was held.
+// Events are emitted after unlocking so that listeners may call back into the App.
+func (a *App) unlock() {
+	events := a.pendingEvents
+	a.pendingEvents = nil
+	a.mu.Unlock()
+
+	for _, event := range events {
+		a.emit(event.name, event.payload)
+	}
+}
+
+// notify queues an event for emission once the state lock is released.
+// The caller must hold the write lock and pass a payload that doesn't share
+// memory with the profile state.
+func (a *App) notify(name string, payload interface{}) {
+	a.pendingEvents = append(a.pendingEvents, pendingEvent{name: name, payload: payload})
+}
+
+// emit sends an event to the frontend if the runtime is available
+func (a *App) emit(name string, payload interface{}) {
+	a.mu.RLock()
+	ctx := a.ctx
+	a.mu.RUnlock()
+
+	if ctx == nil {
+		return
+	}
+	runtime.EventsEmit(ctx, name, payload)
+}
+
+// notifyProfileChanged queues a profile:changed event
+func (a *App) notifyProfileChanged(profileID, reason string) {
+	a.notify(EventProfileChanged, ProfileChangedEvent{
+		ProfileID:     profileID,
+		ActiveProfile: a.profileManager.ActiveProfile,
+		Reason:        reason,
+	})
+}
+
+// notifyLayerChanged queues a layer:changed event for the given profile
+func (a *App) notifyLayerChanged(profile *Profile, reason string) {
+	a.notify(EventLayerChanged, LayerChangedEvent{
+		ProfileID:       profile.ID,
+		Layout:          profile.CurrentLayout,
+		Layer:           profile.CurrentLayer,
+		ActiveModifiers: cloneStrings(profile.ActiveModifiers),
+		Reason:          reason,
+	})
+}
+
+// notifyKeyUpdated queues a key:updated event for a key in the given context
+func (a *App) notifyKeyUpdated(profile *Profile, layer string, modifiers []string, key Key) {
+	a.notify(EventKeyUpdated, KeyUpdatedEvent{
+		ProfileID: profile.ID,
+		Layout:    profile.CurrentLayout,
+		Layer:     layer,
+		Modifiers: cloneStrings(modifiers),
+		Key:       key.Clone(),
+	})
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// FindReplaceRequest describes a search over key labels and descriptions, and what to
+// replace the matches with
+type FindReplaceRequest struct {
+	Find          string    `json:"find"`
+	Replace       string    `json:"replace"`
+	Regex         bool      `json:"regex"`         // Find is a regular expression; Replace may use $1 and ${name}
+	CaseSensitive bool      `json:"caseSensitive"` // Searches ignore case by default
+	Fields        []string  `json:"fields"`        // "label" and/or "description"; empty searches both
+	Scope         FindScope `json:"scope"`
+}
+
+// FindScope limits a search. Empty fields don't limit it.
+type FindScope struct {
+	ProfileID string `json:"profileId"` // Defaults to the active profile
+	Layout    string `json:"layout"`
+	Layer     string `json:"layer"`
+	Combo     string `json:"combo"` // A modifier combination such as "ctrl+shift", or "none" for keys without modifiers
+	KeyType   string `json:"keyType"`
+}
+
+// FindMatch is a key field that matches a search
+type FindMatch struct {
+	ProfileID string `json:"profileId"`
+	Layout    string `json:"layout"`
+	Layer     string `json:"layer"`
+	Combo     string `json:"combo,omitempty"` // Empty for keys without modifiers
+	KeyID     string `json:"keyId"`
+	Field     string `json:"field"`
+	Old       string `json:"old"`
+	New       string `json:"new"`
+}
+
+// FindReplaceResult lists the matches of a search and whether they were replaced
+type FindReplaceResult struct {
+	Matches []FindMatch `json:"matches"`
+	Applied bool        `json:"applied"`
+}
+
+// PreviewFindReplace lists the key fields a find and replace would change, with
+// their new values, without changing anything. requestJSON is a FindReplaceRequest.
+func (a *App) PreviewFindReplace(requestJSON string) (string, error) {
+	return a.findReplace(requestJSON, false)
+}
+
+// ApplyFindReplace replaces the matches of a search and returns them.
+// requestJSON is a FindReplaceRequest.
+func (a *App) ApplyFindReplace(requestJSON string) (string, error) {
+	return a.findReplace(requestJSON, true)
+}
+
+// findReplace runs a search on the requested profile, replacing the matches if apply is set
+func (a *App) findReplace(requestJSON string, apply bool) (string, error) {
+	var request FindReplaceRequest
+	if err := json.Unmarshal([]byte(requestJSON), &request); err != nil {
+		return "", fmt.Errorf("invalid find and replace request: %v", err)
+	}
+	pattern, err := request.compile()
+	if err != nil {
+		return "", err
+	}
+	fields := map[string]bool{}
+	for _, field := range request.Fields {
+		if field != "label" && field != "description" {
+			return "", fmt.Errorf("unknown field %q, expected label or description", field)
+		}
+		fields[field] = true
+	}
+	if len(fields) == 0 {
+		fields = map[string]bool{"label": true, "description": true}
+	}
+
+	a.lock()
+	defer a.unlock()
+
+	profileID := request.Scope.ProfileID
+	if profileID == "" {
+		profileID = a.profileManager.ActiveProfile
+	}
+	profile := a.profileManager.GetProfile(profileID)
+	if profile == nil {
+		return "", fmt.Errorf("profile not found: %s", profileID)
+	}
+	if err := a.ensureProfileLoaded(profile); err != nil {
+		return "", err
+	}
+	// Loading may quarantine profiles, so look it up again
+	if profile = a.profileManager.GetProfile(profileID); profile == nil {
+		return "", fmt.Errorf("profile not found: %s", profileID)
+	}
+
+	result := FindReplaceResult{Matches: []FindMatch{}, Applied: apply}
+	replaced := false
+	replace := func(value string) string {
+		if request.Regex {
+			return pattern.ReplaceAllString(value, request.Replace)
+		}
+		return pattern.ReplaceAllLiteralString(value, request.Replace)
+	}
+
+	for i := range profile.Layouts {
+		layout := &profile.Layouts[i]
+		if request.Scope.Layout != "" && layout.Name != request.Scope.Layout {
+			continue
+		}
+		changed := false
+		request.Scope.eachKey(layout, func(layer, combo string, key *Key) {
+			for _, field := range []string{"label", "description"} {
+				value := &key.Label
+				if field == "description" {
+					value = &key.Description
+				}
+				if !fields[field] || !pattern.MatchString(*value) {
+					continue
+				}
+				match := FindMatch{
+					ProfileID: profileID,
+					Layout:    layout.Name,
+					Layer:     layer,
+					Combo:     combo,
+					KeyID:     key.ID,
+					Field:     field,
+					Old:       *value,
+					New:       replace(*value),
+				}
+				result.Matches = append(result.Matches, match)
+				if apply && match.New != match.Old {
+					*value = match.New
+					changed = true
+				}
+			}
+		})
+		if changed {
+			layout.ModifiedAt = time.Now()
+			replaced = true
+		}
+	}
+
+	if replaced {
+		profile.ModifiedAt = time.Now()
+		a.notifyProfileChanged(profileID, "replaced")
+		if profileID == a.profileManager.ActiveProfile {
+			a.notifyLayerChanged(profile, "keys")
+		}
+		a.requestSave(profileID)
+	}
+
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal find and replace result: %v", err)
+	}
+	return string(data), nil
+}
+
+// compile turns the search into a regular expression
+func (r FindReplaceRequest) compile() (*regexp.Regexp, error) {
+	if r.Find == "" {
+		return nil, fmt.Errorf("search text cannot be empty")
+	}
+	expr := r.Find
+	if !r.Regex {
+		expr = regexp.QuoteMeta(expr)
+	}
+	if !r.CaseSensitive {
+		expr = "(?i)" + expr
+	}
+	pattern, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression: %v", err)
+	}
+	return pattern, nil
+}
+
+// eachKey calls fn for every key of a layout within the scope, layer by layer in
+// display order, each layer's own keys before its modifier combinations
+func (s FindScope) eachKey(layout *KeyboardLayout, fn func(layer, combo string, key *Key)) {
+	combo := s.Combo
+	if combo != "" && combo != "none" {
+		combo = comboName(strings.Split(combo, "+"))
+	}
+	visit := func(layer, comboKey string, keys []Key) {
+		for i := range keys {
+			if s.KeyType == "" || keys[i].KeyType == s.KeyType {
+				fn(layer, comboKey, &keys[i])
+			}
+		}
+	}
+
+	for _, layer := range layout.GetLayerNames() {
+		if s.Layer != "" && layer != s.Layer {
+			continue
+		}
+		if combo == "" || combo == "none" {
+			visit(layer, "", layout.Layers[layer])
+		}
+		if combo == "none" {
+			continue
+		}
+		combos := layout.ModifierMaps[layer]
+		for _, name := range unionKeys(combos, nil) {
+			if combo == "" || name == combo {
+				visit(layer, name, combos[name])
+			}
+		}
+	}
+}
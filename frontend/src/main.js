@@ -28,15 +28,32 @@ import {
     CreateNewProfile,
     UpdateProfileAppearance,
     DeleteProfile,
+    GetStartupDiagnostics,
+    ResolveProfileConflict,
+    ExportProfile,
+    ImportProfile,
+    DuplicateProfile,
+    SaveProfileAsTemplate,
+    GetProfileTemplates,
+    CreateProfileFromTemplate,
+    CreateChildProfile,
+    GetPalette,
+    AddPaletteItem,
+    UpdatePaletteItem,
+    DeletePaletteItem,
+    SetPaletteItemFavorite,
+    ImportPaletteItems,
 } from '../wailsjs/go/main/App';
+import { EventsOn } from '../wailsjs/runtime/runtime';
 
 let currentKeys = [];
 let currentLayer = 'base';
 let currentKeyboardType = 'corne'; // 'corne' or 'tenkeyless'
 let availableLayers = [];
+let layerDetails = {};
 let activeModifiers = [];
 let availableModifiers = [];
-let keyPaletteHistory = []; // Persistent library of custom key designs
+let keyPaletteHistory = []; // Library of custom key designs, kept by the backend in the shared palette
 let showOnlyUnusedKeys = false; // Track whether to show only unused keys
 
 // Profile state
@@ -83,6 +100,9 @@ async function initializeApp() {
 
         console.log('App initialized successfully');
 
+        await reportStartupDiagnostics();
+        watchExternalChanges();
+
     } catch (error) {
         console.error('Failed to initialize app:', error);
         // Show error to user
@@ -105,13 +125,80 @@ async function loadKeyboardType() {
     }
 }
 
+// Tell the user if their profiles had to be repaired or quarantined while loading
+async function reportStartupDiagnostics() {
+    try {
+        const diagnostics = JSON.parse(await GetStartupDiagnostics());
+        if (diagnostics.mode === 'normal') {
+            return;
+        }
+
+        console.warn('Startup diagnostics:', diagnostics);
+        const lines = [];
+        (diagnostics.repaired || []).forEach(repair => {
+            lines.push(`Repaired "${repair.profileName}": ${repair.changes.join('; ')}`);
+        });
+        (diagnostics.quarantined || []).forEach(entry => {
+            lines.push(`Could not load "${entry.profileName}" (${entry.reason}). Original kept at ${entry.path}`);
+        });
+        (diagnostics.unavailable || []).forEach(entry => {
+            lines.push(`Could not read "${entry.profileName}" (${entry.error}). It stays in the profile list and loads once its file can be read`);
+        });
+        (diagnostics.messages || []).forEach(message => lines.push(message));
+
+        if (lines.length > 0) {
+            alert(`Some profile data needed attention while loading:\n\n${lines.join('\n')}`);
+        }
+    } catch (error) {
+        console.error('Failed to load startup diagnostics:', error);
+    }
+}
+
+// Refresh when profile files are edited outside the app, and ask what to do when
+// such an edit collides with unsaved changes
+function watchExternalChanges() {
+    EventsOn('profile:changed', async event => {
+        if (event.reason !== 'external') {
+            return;
+        }
+        try {
+            await Promise.all([
+                loadProfiles(),
+                loadKeyboardType(),
+                loadLayers(),
+                loadActiveModifiers(),
+                loadCurrentLayer()
+            ]);
+            renderApp();
+            renderKeyboard();
+            renderLayerSelector();
+            renderModifierPanel();
+        } catch (error) {
+            console.error('Failed to reload externally changed profiles:', error);
+        }
+    });
+
+    EventsOn('profile:conflict', async conflict => {
+        const change = conflict.deleted ? 'was deleted' : 'was changed';
+        const keepLocal = confirm(`Profile "${conflict.profileName}" ${change} on disk while you had unsaved edits.\n\nOK keeps your edits and overwrites the file. Cancel discards your edits and loads the file.`);
+        try {
+            await ResolveProfileConflict(conflict.profileId, keepLocal ? 'local' : 'external');
+        } catch (error) {
+            console.error('Failed to resolve profile conflict:', error);
+        }
+    });
+}
+
 async function loadLayers() {
     try {
         const layersJson = await GetAvailableLayers();
-        availableLayers = JSON.parse(layersJson);
+        const layers = JSON.parse(layersJson);
+        availableLayers = layers.map(layer => layer.name);
+        layerDetails = Object.fromEntries(layers.map(layer => [layer.name, layer]));
     } catch (error) {
         console.error('Failed to load layers:', error);
         availableLayers = ['base'];
+        layerDetails = {};
     }
 }
 
@@ -548,6 +635,7 @@ function renderApp() {
                 
                 <div class="profile-actions">
                     <button type="button" id="add-new-profile-btn" class="btn-primary">+ Add New Profile</button>
+                    <button type="button" id="import-profile-btn" class="btn-secondary">Import Profile...</button>
                 </div>
             </div>
         </div>
@@ -568,6 +656,12 @@ function renderApp() {
                         <label for="profile-name-input">Profile Name:</label>
                         <input type="text" id="profile-name-input" name="name" required placeholder="e.g., Gaming, Work, VS Code">
                     </div>
+                    <div class="form-group">
+                        <label for="profile-template-select">Start From:</label>
+                        <select id="profile-template-select">
+                            <option value="">Blank (Corne + Tenkeyless)</option>
+                        </select>
+                    </div>
                     <div class="form-group">
                         <label for="profile-color-input">Background Color:</label>
                         <div class="color-input-wrapper">
@@ -624,6 +718,9 @@ function renderApp() {
                     </div>
                     <div class="form-actions">
                         <button type="button" id="delete-profile-btn" class="btn-danger" style="margin-right: auto;">Delete Profile</button>
+                        <button type="button" id="duplicate-profile-btn" class="btn-secondary">Duplicate</button>
+                        <button type="button" id="save-template-btn" class="btn-secondary">Save as Template</button>
+                        <button type="button" id="export-profile-btn" class="btn-secondary">Export...</button>
                         <button type="button" id="cancel-edit-profile">Cancel</button>
                         <button type="submit">Save Changes</button>
                     </div>
@@ -1584,24 +1681,9 @@ function renderAllCorneKeys(keys) {
             keyContent = `<span class=\"key-placeholder\"></span>`;
         }
         
-        // Extract extra data from description
-        let extraData = {};
-        if (key.description) {
-            try {
-                extraData = JSON.parse(key.description);
-            } catch (e) {
-                extraData = { userDescription: key.description };
-            }
-        }
-        
-        // Add overlay images
-        let overlayImages = '';
-        if (extraData.secondaryImageData) {
-            overlayImages += `<img class=\"key-secondary-image\" src=\"${extraData.secondaryImageData}\" alt=\"Secondary image\" />`;
-        }
-        if (extraData.tertiaryImageData) {
-            overlayImages += `<img class=\"key-tertiary-image\" src=\"${extraData.tertiaryImageData}\" alt=\"Tertiary image\" />`;
-        }
+        // Extra data kept in the description, and the key's legends
+        const extraData = keyExtraData(key);
+        const overlayImages = renderKeyLegends(key);
         
         // Calculate position based on row, col, and side with proper spacing
         const keyWidth = 80;  // 4rem keys
@@ -1715,24 +1797,9 @@ function renderAllTenkeylessKeys(keys) {
             keyContent = `<span class="key-placeholder"></span>`;
         }
         
-        // Extract extra data from description
-        let extraData = {};
-        if (key.description) {
-            try {
-                extraData = JSON.parse(key.description);
-            } catch (e) {
-                extraData = { userDescription: key.description };
-            }
-        }
-        
-        // Add overlay images
-        let overlayImages = '';
-        if (extraData.secondaryImageData) {
-            overlayImages += `<img class="key-secondary-image" src="${extraData.secondaryImageData}" alt="Secondary image" />`;
-        }
-        if (extraData.tertiaryImageData) {
-            overlayImages += `<img class="key-tertiary-image" src="${extraData.tertiaryImageData}" alt="Tertiary image" />`;
-        }
+        // Extra data kept in the description, and the key's legends
+        const extraData = keyExtraData(key);
+        const overlayImages = renderKeyLegends(key);
         
         // Calculate position based on row and col - proper tenkeyless spacing scaled for 4rem keys
         const keyWidth = 80;  // Scaled up from 60px for 4rem keys
@@ -1957,27 +2024,9 @@ function renderKeyGrid(keys, side) {
             keyContent = `<span class="key-placeholder"></span>`;
         }
         
-        // Extract extra data from description
-        let extraData = {};
-        if (key.description) {
-            try {
-                extraData = JSON.parse(key.description);
-            } catch (e) {
-                // Not JSON, treat as plain text description
-                extraData = { userDescription: key.description };
-            }
-        }
-        
-        // Add overlay images
-        let overlayImages = '';
-        // Check for secondary image (top-right)
-        if (extraData.secondaryImageData) {
-            overlayImages += `<img class="key-secondary-image" src="${extraData.secondaryImageData}" alt="Secondary image" />`;
-        }
-        // Check for tertiary image (bottom-right)
-        if (extraData.tertiaryImageData) {
-            overlayImages += `<img class="key-tertiary-image" src="${extraData.tertiaryImageData}" alt="Tertiary image" />`;
-        }
+        // Extra data kept in the description, and the key's legends
+        const extraData = keyExtraData(key);
+        const overlayImages = renderKeyLegends(key);
         
         const left = position.x;
         const top = position.y;
@@ -2032,27 +2081,9 @@ function renderKeyGrid(keys, side) {
             keyContent = `<span class="key-placeholder"></span>`;
         }
         
-        // Extract extra data from description
-        let extraData = {};
-        if (key.description) {
-            try {
-                extraData = JSON.parse(key.description);
-            } catch (e) {
-                // Not JSON, treat as plain text description
-                extraData = { userDescription: key.description };
-            }
-        }
-        
-        // Add overlay images
-        let overlayImages = '';
-        // Check for secondary image (top-right)
-        if (extraData.secondaryImageData) {
-            overlayImages += `<img class="key-secondary-image" src="${extraData.secondaryImageData}" alt="Secondary image" />`;
-        }
-        // Check for tertiary image (bottom-right)
-        if (extraData.tertiaryImageData) {
-            overlayImages += `<img class="key-tertiary-image" src="${extraData.tertiaryImageData}" alt="Tertiary image" />`;
-        }
+        // Extra data kept in the description, and the key's legends
+        const extraData = keyExtraData(key);
+        const overlayImages = renderKeyLegends(key);
         
         const left = thumbPos.x;
         const top = thumbPos.y;
@@ -2112,9 +2143,10 @@ function renderLayerSelector() {
     container.innerHTML = `
         <label for="layer-select">Layer:</label>
         <select id="layer-select">
-            ${availableLayers.map(layer => 
-                `<option value="${layer}" ${layer === currentLayer ? 'selected' : ''}>${layer}</option>`
-            ).join('')}
+            ${availableLayers.map(layer => {
+                const details = layerDetails[layer] || {};
+                return `<option value="${escapeHtml(layer)}" title="${escapeHtml(details.activationHint || '')}" ${layer === currentLayer ? 'selected' : ''}>${escapeHtml(details.displayName || layer)}</option>`;
+            }).join('')}
         </select>
     `;
     
@@ -2494,19 +2526,9 @@ function addKeyClickHandlers() {
 function showKeyEditor(key) {
     const modal = document.getElementById('key-editor-modal');
     
-    // Extract extra data from description
-    let extraData = {};
-    let userDescription = '';
-    if (key.description) {
-        try {
-            extraData = JSON.parse(key.description);
-            userDescription = extraData.userDescription || '';
-        } catch (e) {
-            // Not JSON, treat as plain text description
-            userDescription = key.description;
-            extraData = {};
-        }
-    }
+    // Extract extra data from description and legends
+    const extraData = keyExtraData(key);
+    const userDescription = extraData.userDescription || '';
     
     // Populate form fields with current values
     document.getElementById('key-label-input').value = key.label || '';
@@ -2618,14 +2640,8 @@ function addCurrentKeyToPalette() {
     }
     
     // Parse existing description and add current form data
-    let extraData = {};
-    try {
-        if (tempKey.description) {
-            extraData = JSON.parse(tempKey.description);
-        }
-    } catch (e) {
-        extraData = {};
-    }
+    // Palette designs keep the overlay images in the description
+    const extraData = keyExtraData(tempKey);
     
     // Add current description from form
     const userDescription = document.getElementById('key-description-input').value || '';
@@ -2657,8 +2673,7 @@ function deleteFromKeyPaletteHistory(designId) {
     const index = keyPaletteHistory.findIndex(design => design.id === designId);
     if (index !== -1) {
         keyPaletteHistory.splice(index, 1);
-        // Update localStorage
-        localStorage.setItem('keyPaletteHistory', JSON.stringify(keyPaletteHistory));
+        DeletePaletteItem('', designId).catch(error => console.error('Failed to delete palette item:', error));
         console.log('Removed design from palette history:', designId);
         // Refresh persistent palette
         applyPaletteFilters();
@@ -2708,42 +2723,48 @@ function addToKeyPaletteHistory(key) {
     );
     
     if (!existingDesign) {
-        keyPaletteHistory.push(design);
-        // Save to localStorage for persistence
-        localStorage.setItem('keyPaletteHistory', JSON.stringify(keyPaletteHistory));
-        console.log('Added design to palette history:', design.id);
-        
-        // Refresh persistent palette
-        renderPersistentPalette();
+        AddPaletteItem('', JSON.stringify(design)).then(savedJson => {
+            const saved = JSON.parse(savedJson);
+            keyPaletteHistory.push(saved);
+            console.log('Added design to palette history:', saved.id);
+            
+            // Refresh persistent palette
+            renderPersistentPalette();
+        }).catch(error => console.error('Failed to add palette item:', error));
     }
 }
 
-function loadKeyPaletteHistory() {
+async function loadKeyPaletteHistory() {
     try {
+        // Earlier versions kept the palette in localStorage; move it to the backend once
         const saved = localStorage.getItem('keyPaletteHistory');
         if (saved) {
-            keyPaletteHistory = JSON.parse(saved);
-            
-            // Ensure all items have the required fields with default values
-            keyPaletteHistory = keyPaletteHistory.map(item => ({
-                id: item.id || `design_${Date.now()}_${Math.random().toString(36).substr(2, 9)}`,
-                imageData: item.imageData || null,
-                label: item.label || '',
-                color: item.color || '#ffffff',
-                description: item.description || '{}',
-                timestamp: item.timestamp || Date.now(),
-                sourceLayer: item.sourceLayer || 'base',
-                sourceLayerKeysCount: item.sourceLayerKeysCount || 0,
-                sourceModifiers: item.sourceModifiers || [],
-                sourceKeyboardType: item.sourceKeyboardType || 'corne',
-                // New fields with defaults
-                favorite: typeof item.favorite === 'boolean' ? item.favorite : false,
-                keyType: item.keyType || 'normal',
-                usageCount: typeof item.usageCount === 'number' ? item.usageCount : 0
-            }));
-            
-            console.log('Loaded palette history:', keyPaletteHistory.length, 'designs');
+            const added = await ImportPaletteItems('', saved);
+            localStorage.removeItem('keyPaletteHistory');
+            console.log('Moved', added, 'palette designs from local storage');
         }
+        
+        keyPaletteHistory = JSON.parse(await GetPalette(''));
+        // Ensure all items have the required fields with default values
+        keyPaletteHistory = keyPaletteHistory.map(item => ({
+            id: item.id || `design_${Date.now()}_${Math.random().toString(36).substr(2, 9)}`,
+            imageData: item.imageData || null,
+            label: item.label || '',
+            color: item.color || '#ffffff',
+            description: item.description || '{}',
+            timestamp: item.timestamp || Date.now(),
+            sourceLayer: item.sourceLayer || 'base',
+            sourceLayerKeysCount: item.sourceLayerKeysCount || 0,
+            sourceModifiers: item.sourceModifiers || [],
+            sourceKeyboardType: item.sourceKeyboardType || 'corne',
+            // New fields with defaults
+            favorite: typeof item.favorite === 'boolean' ? item.favorite : false,
+            keyType: item.keyType || 'normal',
+            usageCount: typeof item.usageCount === 'number' ? item.usageCount : 0,
+            tags: item.tags || []
+        }));
+        
+        console.log('Loaded palette history:', keyPaletteHistory.length, 'designs');
     } catch (error) {
         console.error('Failed to load palette history:', error);
         keyPaletteHistory = [];
@@ -2768,16 +2789,15 @@ function createNewCustomKey() {
     };
     
     // Add to palette history
-    keyPaletteHistory.push(newKeyDesign);
-    
-    // Save to localStorage for persistence
-    localStorage.setItem('keyPaletteHistory', JSON.stringify(keyPaletteHistory));
-    
-    // Refresh persistent palette
-    applyPaletteFilters();
-    
-    // Show a message to the user
-    console.log('Added new custom key to palette');
+    AddPaletteItem('', JSON.stringify(newKeyDesign)).then(savedJson => {
+        keyPaletteHistory.push(JSON.parse(savedJson));
+        
+        // Refresh persistent palette
+        applyPaletteFilters();
+        
+        // Show a message to the user
+        console.log('Added new custom key to palette');
+    }).catch(error => console.error('Failed to add custom key to palette:', error));
 }
 
 function setupPersistentPalette() {
@@ -3115,25 +3135,24 @@ function isKeyUsedInLayout(paletteKeyDesign) {
         }
         
         // Check secondary/tertiary images
-        let keyExtraData = {};
+        const keyExtras = keyExtraData(key);
         let paletteExtraData = {};
         
         try {
-            if (key.description) keyExtraData = JSON.parse(key.description);
             if (paletteKeyDesign.description) paletteExtraData = JSON.parse(paletteKeyDesign.description);
         } catch (e) {
             // Ignore parsing errors
         }
         
         // Compare secondary images
-        if (keyExtraData.secondaryImageData && paletteExtraData.secondaryImageData &&
-            keyExtraData.secondaryImageData === paletteExtraData.secondaryImageData) {
+        if (keyExtras.secondaryImageData && paletteExtraData.secondaryImageData &&
+            keyExtras.secondaryImageData === paletteExtraData.secondaryImageData) {
             return true;
         }
         
         // Compare tertiary images
-        if (keyExtraData.tertiaryImageData && paletteExtraData.tertiaryImageData &&
-            keyExtraData.tertiaryImageData === paletteExtraData.tertiaryImageData) {
+        if (keyExtras.tertiaryImageData && paletteExtraData.tertiaryImageData &&
+            keyExtras.tertiaryImageData === paletteExtraData.tertiaryImageData) {
             return true;
         }
         
@@ -3474,8 +3493,7 @@ function togglePaletteItemFavorite(itemId) {
     // Toggle favorite status
     item.favorite = !item.favorite;
     
-    // Save to localStorage
-    localStorage.setItem('keyPaletteHistory', JSON.stringify(keyPaletteHistory));
+    SetPaletteItemFavorite('', itemId, item.favorite).catch(error => console.error('Failed to update palette favorite:', error));
     
     // Re-render the palette
     applyPaletteFilters();
@@ -3947,44 +3965,32 @@ async function saveKeyEdit() {
                 // Note: Color change alone doesn't make a key "custom" for the palette
             }
             
-            // Parse existing description to extract extra data
-            let extraData = {};
-            
-            // Try to parse existing description for extra data (preserving secondary/tertiary images)
-            if (key.description) {
-                try {
-                    const parsed = JSON.parse(key.description);
-                    // Keep existing extra data
-                    extraData = parsed;
-                } catch (e) {
-                    // Old format, just text description - start fresh
-                    extraData = {};
-                }
-            }
+            // Older versions kept the description as JSON, with the overlay images
+            const extraData = keyExtraData(key);
             
             // Update user description if changed
             if (newUserDescription !== (extraData.userDescription || '')) {
-                extraData.userDescription = newUserDescription;
                 hasChanges = true;
             }
+            key.description = newUserDescription;
             
-            // Handle secondary image
+            // Handle secondary image (top-right legend)
             if (modal.dataset.pendingSecondaryImageData) {
-                extraData.secondaryImageData = modal.dataset.pendingSecondaryImageData;
+                setKeyLegendImage(key, SECONDARY_LEGEND_SLOT, modal.dataset.pendingSecondaryImageData);
                 hasChanges = true;
             }
             if (modal.dataset.removeSecondary === 'true') {
-                delete extraData.secondaryImageData;
+                setKeyLegendImage(key, SECONDARY_LEGEND_SLOT, '');
                 hasChanges = true;
             }
             
-            // Handle tertiary image
+            // Handle tertiary image (bottom-right legend)
             if (modal.dataset.pendingTertiaryImageData) {
-                extraData.tertiaryImageData = modal.dataset.pendingTertiaryImageData;
+                setKeyLegendImage(key, TERTIARY_LEGEND_SLOT, modal.dataset.pendingTertiaryImageData);
                 hasChanges = true;
             }
             if (modal.dataset.removeTertiary === 'true') {
-                delete extraData.tertiaryImageData;
+                setKeyLegendImage(key, TERTIARY_LEGEND_SLOT, '');
                 hasChanges = true;
             }
             
@@ -3998,9 +4004,6 @@ async function saveKeyEdit() {
                 hasChanges = true;
             }
             
-            // Store as JSON in description field
-            key.description = JSON.stringify(extraData);
-            
             console.log('Updating key with data:', key);
             
             // Update the key (this handles both base layer and modifier combinations)
@@ -4093,9 +4096,8 @@ async function savePaletteKeyEdit() {
         // Update the key in the palette history
         const index = keyPaletteHistory.findIndex(item => item.id === keyData.id);
         if (index !== -1) {
+            await UpdatePaletteItem('', JSON.stringify(keyData));
             keyPaletteHistory[index] = keyData;
-            // Save to localStorage for persistence
-            localStorage.setItem('keyPaletteHistory', JSON.stringify(keyPaletteHistory));
             console.log('Palette key updated successfully');
         } else {
             throw new Error(`Key with ID ${keyData.id} not found in palette history`);
@@ -4148,6 +4150,72 @@ async function addCustomLayer() {
 }
 
 
+// Legend slots on a keycap, as in the backend's legendSlots
+const LEGEND_SLOTS = ['topLeft', 'top', 'topRight', 'left', 'center', 'right', 'bottomLeft', 'bottom', 'bottomRight', 'front'];
+
+// The key editor's secondary and tertiary images are the legends in these slots
+const SECONDARY_LEGEND_SLOT = 'topRight';
+const TERTIARY_LEGEND_SLOT = 'bottomRight';
+
+// keyExtraData returns a key's description as extra data, with the secondary and
+// tertiary images taken from its legends. Older versions stored the description as
+// JSON with the images in it; palette designs still do.
+function keyExtraData(key) {
+    let extraData = {};
+    if (key.description) {
+        try {
+            const parsed = JSON.parse(key.description);
+            extraData = parsed && typeof parsed === 'object' ? parsed : { userDescription: key.description };
+        } catch (e) {
+            extraData = { userDescription: key.description };
+        }
+    }
+    
+    const legends = key.legends || {};
+    if (legends[SECONDARY_LEGEND_SLOT] && legends[SECONDARY_LEGEND_SLOT].imageData) {
+        extraData.secondaryImageData = legends[SECONDARY_LEGEND_SLOT].imageData;
+    }
+    if (legends[TERTIARY_LEGEND_SLOT] && legends[TERTIARY_LEGEND_SLOT].imageData) {
+        extraData.tertiaryImageData = legends[TERTIARY_LEGEND_SLOT].imageData;
+    }
+    return extraData;
+}
+
+// setKeyLegendImage sets or, with empty image data, removes the image of a legend
+function setKeyLegendImage(key, slot, imageData) {
+    const legends = { ...(key.legends || {}) };
+    const legend = { ...(legends[slot] || {}), imageData: imageData || undefined };
+    if (legend.text || legend.imageData) {
+        legends[slot] = legend;
+    } else {
+        delete legends[slot];
+    }
+    key.legends = legends;
+}
+
+// renderKeyLegends returns the HTML for a key's legends: images in the corners keep
+// the secondary and tertiary image styles, text legends are placed by slot
+function renderKeyLegends(key) {
+    const legends = key.legends || {};
+    let html = '';
+    LEGEND_SLOTS.forEach(slot => {
+        const legend = legends[slot] || {};
+        if (legend.imageData && legend.imageData.startsWith('data:image/')) {
+            let imageClass = `key-legend-image key-legend-${slot}`;
+            if (slot === SECONDARY_LEGEND_SLOT) {
+                imageClass = 'key-secondary-image';
+            } else if (slot === TERTIARY_LEGEND_SLOT) {
+                imageClass = 'key-tertiary-image';
+            }
+            html += `<img class="${imageClass}" src="${legend.imageData}" alt="${escapeHtml(legend.text || slot + ' legend')}" />`;
+        } else if (legend.text) {
+            const style = legend.color ? ` style="color: ${escapeHtml(legend.color)}"` : '';
+            html += `<span class="key-legend key-legend-${slot}"${style}>${escapeHtml(legend.text)}</span>`;
+        }
+    });
+    return html;
+}
+
 function escapeHtml(text) {
     const div = document.createElement('div');
     div.textContent = text;
@@ -4198,8 +4266,32 @@ function setupProfileManagement() {
     addNewProfileBtn.onclick = () => {
         profileModal.style.display = 'none';
         addProfileModal.style.display = 'block';
+        loadTemplateOptions();
     };
     
+    // Import profile bundle handler
+    const importProfileBtn = document.getElementById('import-profile-btn');
+    if (importProfileBtn) {
+        importProfileBtn.onclick = async () => {
+            try {
+                const resultJson = await ImportProfile('');
+                if (!resultJson) return; // Cancelled
+                
+                const result = JSON.parse(resultJson);
+                await loadProfiles();
+                updateProfileSelectorButton();
+                renderProfilesGrid();
+                
+                if (result.originalName) {
+                    alert(`Imported "${result.originalName}" as "${result.profileName}".`);
+                }
+            } catch (error) {
+                console.error('Failed to import profile:', error);
+                alert('Failed to import profile: ' + error);
+            }
+        };
+    }
+    
     // Cancel add profile handler
     cancelAddProfile.onclick = () => {
         addProfileModal.style.display = 'none';
@@ -4409,6 +4501,39 @@ async function switchToProfile(profileId) {
     }
 }
 
+// Fill the "Start From" list in the new profile dialog with the saved templates
+async function loadTemplateOptions() {
+    const select = document.getElementById('profile-template-select');
+    if (!select) return;
+    
+    select.innerHTML = '<option value="">Blank (Corne + Tenkeyless)</option>';
+    try {
+        const templates = JSON.parse(await GetProfileTemplates());
+        templates.forEach(template => {
+            const option = document.createElement('option');
+            option.value = template.id;
+            option.textContent = `${template.name} (${template.layouts.join(', ')})`;
+            option.title = template.description || '';
+            select.appendChild(option);
+        });
+    } catch (error) {
+        console.error('Failed to load profile templates:', error);
+    }
+    
+    // Existing profiles can be inherited from; edits in the new profile override them
+    if (profiles.length > 0) {
+        const group = document.createElement('optgroup');
+        group.label = 'Inherit from profile';
+        profiles.forEach(profile => {
+            const option = document.createElement('option');
+            option.value = `inherit:${profile.id}`;
+            option.textContent = profile.name;
+            group.appendChild(option);
+        });
+        select.appendChild(group);
+    }
+}
+
 async function createNewProfile() {
     const nameInput = document.getElementById('profile-name-input');
     const colorInput = document.getElementById('profile-color-input');
@@ -4434,8 +4559,17 @@ async function createNewProfile() {
             iconData = imgElement.src;
         }
         
-        // Create the profile
-        const newProfileJson = await CreateNewProfile(name);
+        // Create the profile, from a template or inheriting from a profile if one was chosen
+        const templateSelect = document.getElementById('profile-template-select');
+        const templateId = templateSelect ? templateSelect.value : '';
+        let newProfileJson;
+        if (templateId.startsWith('inherit:')) {
+            newProfileJson = await CreateChildProfile(templateId.slice('inherit:'.length), name);
+        } else if (templateId) {
+            newProfileJson = await CreateProfileFromTemplate(templateId, name);
+        } else {
+            newProfileJson = await CreateNewProfile(name);
+        }
         const newProfile = JSON.parse(newProfileJson);
         
         // Update the profile's appearance with icon
@@ -4644,6 +4778,64 @@ function openProfileEditor(profileId) {
     document.getElementById('profile-management-modal').style.display = 'none';
     document.getElementById('edit-profile-modal').style.display = 'block';
     
+    // Setup duplicate and template handlers now that modal is open
+    const duplicateBtn = document.getElementById('duplicate-profile-btn');
+    if (duplicateBtn) {
+        duplicateBtn.onclick = async () => {
+            if (!currentEditingProfileId) return;
+            const profile = profiles.find(p => p.id === currentEditingProfileId);
+            const newName = prompt('Name for the copy:', profile ? `${profile.name} Copy` : '');
+            if (!newName || !newName.trim()) return;
+            
+            try {
+                await DuplicateProfile(currentEditingProfileId, newName.trim());
+                await loadProfiles();
+                updateProfileSelectorButton();
+                document.getElementById('edit-profile-modal').style.display = 'none';
+                document.getElementById('profile-management-modal').style.display = 'block';
+                renderProfilesGrid();
+            } catch (error) {
+                console.error('Failed to duplicate profile:', error);
+                alert('Failed to duplicate profile: ' + error);
+            }
+        };
+    }
+    
+    const saveTemplateBtn = document.getElementById('save-template-btn');
+    if (saveTemplateBtn) {
+        saveTemplateBtn.onclick = async () => {
+            if (!currentEditingProfileId) return;
+            const profile = profiles.find(p => p.id === currentEditingProfileId);
+            const templateName = prompt('Template name:', profile ? profile.name : '');
+            if (!templateName || !templateName.trim()) return;
+            
+            try {
+                await SaveProfileAsTemplate(currentEditingProfileId, templateName.trim(), '');
+                alert(`Saved template "${templateName.trim()}". Choose it under "Start From" when creating a profile.`);
+            } catch (error) {
+                console.error('Failed to save template:', error);
+                alert('Failed to save template: ' + error);
+            }
+        };
+    }
+    
+    // Setup export handler now that modal is open
+    const exportBtn = document.getElementById('export-profile-btn');
+    if (exportBtn) {
+        exportBtn.onclick = async () => {
+            if (!currentEditingProfileId) return;
+            try {
+                const path = await ExportProfile(currentEditingProfileId);
+                if (path) {
+                    console.log('Exported profile to', path);
+                }
+            } catch (error) {
+                console.error('Failed to export profile:', error);
+                alert('Failed to export profile: ' + error);
+            }
+        };
+    }
+    
     // Setup delete handler now that modal is open
     const deleteBtn = document.getElementById('delete-profile-btn');
     if (deleteBtn) {
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"image/png"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The built-in icon library: SVG icons compiled into the app (icons/), searchable by
+// keyword and rendered to PNG at key size in a chosen color, so common actions don't
+// need an uploaded image.
+
+//go:embed icons/icons.json icons/*.svg
+var iconFiles embed.FS
+
+// Icon sizes in pixels; keys are drawn at 80px
+const (
+	defaultIconSize = 64
+	maxIconSize     = 512
+)
+
+// defaultIconColor is used when no color is given
+const defaultIconColor = "#333333"
+
+// IconInfo describes an icon in the library
+type IconInfo struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	Category string   `json:"category"`
+	Keywords []string `json:"keywords"`
+}
+
+var (
+	iconIndexOnce sync.Once
+	iconIndex     []IconInfo
+	iconIndexErr  error
+)
+
+// loadIconIndex reads the list of icons once
+func loadIconIndex() ([]IconInfo, error) {
+	iconIndexOnce.Do(func() {
+		data, err := iconFiles.ReadFile("icons/icons.json")
+		if err != nil {
+			iconIndexErr = fmt.Errorf("failed to read icon index: %v", err)
+			return
+		}
+		if err := json.Unmarshal(data, &iconIndex); err != nil {
+			iconIndexErr = fmt.Errorf("failed to parse icon index: %v", err)
+		}
+	})
+	return iconIndex, iconIndexErr
+}
+
+// findIcon returns the icon with the given ID
+func findIcon(iconID string) (*IconInfo, error) {
+	icons, err := loadIconIndex()
+	if err != nil {
+		return nil, err
+	}
+	for i := range icons {
+		if icons[i].ID == iconID {
+			return &icons[i], nil
+		}
+	}
+	return nil, fmt.Errorf("icon not found: %s", iconID)
+}
+
+// iconMatch ranks how well an icon matches one search word: 0 for its ID or name,
+// 1 for the start of a word in them, 2 for a keyword or category, -1 for no match
+func iconMatch(icon IconInfo, word string) int {
+	name := strings.ToLower(icon.Name)
+	if icon.ID == word || name == word {
+		return 0
+	}
+	for _, part := range strings.FieldsFunc(icon.ID+" "+name, func(r rune) bool { return r == '-' || r == ' ' }) {
+		if strings.HasPrefix(part, word) {
+			return 1
+		}
+	}
+	for _, keyword := range append([]string{icon.Category}, icon.Keywords...) {
+		if strings.Contains(strings.ToLower(keyword), word) {
+			return 2
+		}
+	}
+	return -1
+}
+
+// searchIcons returns the icons matching every word of the query, best matches
+// first; an empty query returns all icons by name
+func searchIcons(icons []IconInfo, query string) []IconInfo {
+	words := strings.Fields(strings.ToLower(query))
+	type result struct {
+		icon  IconInfo
+		score int
+	}
+	var results []result
+	for _, icon := range icons {
+		score := 0
+		for _, word := range words {
+			match := iconMatch(icon, word)
+			if match < 0 {
+				score = -1
+				break
+			}
+			score += match
+		}
+		if score >= 0 {
+			results = append(results, result{icon, score})
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].score != results[j].score {
+			return results[i].score < results[j].score
+		}
+		return results[i].icon.Name < results[j].icon.Name
+	})
+
+	matches := make([]IconInfo, len(results))
+	for i, r := range results {
+		matches[i] = r.icon
+	}
+	return matches
+}
+
+// renderIcon renders a library icon as a PNG data URL
+func renderIcon(iconID, hexColor string, size int) (string, error) {
+	if _, err := findIcon(iconID); err != nil {
+		return "", err
+	}
+	if hexColor == "" {
+		hexColor = defaultIconColor
+	}
+	if !isValidHexColor(hexColor) {
+		return "", fmt.Errorf("invalid color: %s", hexColor)
+	}
+	if size == 0 {
+		size = defaultIconSize
+	}
+	if size < 8 || size > maxIconSize {
+		return "", fmt.Errorf("icon size must be between 8 and %d pixels", maxIconSize)
+	}
+
+	data, err := iconFiles.ReadFile("icons/" + iconID + ".svg")
+	if err != nil {
+		return "", fmt.Errorf("failed to read icon %s: %v", iconID, err)
+	}
+	icon, err := parseSVG(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse icon %s: %v", iconID, err)
+	}
+
+	rgb, _ := strconv.ParseUint(hexColor[1:], 16, 32)
+	img := rasterizeIcon(icon, size, color.NRGBA{R: uint8(rgb >> 16), G: uint8(rgb >> 8), B: uint8(rgb), A: 255})
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return "", fmt.Errorf("failed to encode icon %s: %v", iconID, err)
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// SearchIcons returns the library icons matching a query, matched against their
+// IDs, names, categories and keywords
+func (a *App) SearchIcons(query string) (string, error) {
+	icons, err := loadIconIndex()
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.MarshalIndent(searchIcons(icons, query), "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal icons: %v", err)
+	}
+	return string(data), nil
+}
+
+// GetIconSVG returns the SVG source of a library icon, for previews
+func (a *App) GetIconSVG(iconID string) (string, error) {
+	if _, err := findIcon(iconID); err != nil {
+		return "", err
+	}
+	data, err := iconFiles.ReadFile("icons/" + iconID + ".svg")
+	if err != nil {
+		return "", fmt.Errorf("failed to read icon %s: %v", iconID, err)
+	}
+	return string(data), nil
+}
+
+// RenderIcon renders a library icon as a PNG data URL. An empty color and a size of
+// 0 use the defaults.
+func (a *App) RenderIcon(iconID, color string, size int) (string, error) {
+	return renderIcon(iconID, color, size)
+}
+
+// SetKeyIcon puts a library icon on a key in the current modifier context, like
+// UploadKeyImage with the icon rendered at key size in the given color
+func (a *App) SetKeyIcon(keyID, iconID, color string) error {
+	imageData, err := renderIcon(iconID, color, defaultIconSize)
+	if err != nil {
+		return err
+	}
+	return a.UploadKeyImage(keyID, imageData)
+}
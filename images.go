@@ -0,0 +1,194 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Images are kept inline, as data URLs, everywhere in memory, but profile files only
+// reference them: when a profile is written each image is stored once in the images
+// directory, named by its SHA-256, and the profile holds images/<sha256>.<ext> in its
+// place. References are turned back into data URLs when the profile is loaded, so
+// profiles written by earlier versions, with inline images, load as they are and move
+// their images out on the next save.
+
+// storedImageRefPattern matches the references profile files use for stored images.
+// Profile files may be edited or synced, so nothing else is looked up on disk.
+var storedImageRefPattern = regexp.MustCompile(`^images/[0-9a-f]{64}\.(png|jpg|gif|webp|svg)$`)
+
+// imageMediaTypes maps the extensions of stored images back to their media types
+var imageMediaTypes = map[string]string{
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+	".svg":  "image/svg+xml",
+}
+
+// rewriteProfileImages replaces every image a profile holds with what rewrite returns
+// for it: its icon, its palette items, and the key, legend and layer icon images of
+// its layouts
+func rewriteProfileImages(profile *Profile, rewrite func(image string) string) {
+	profile.Icon = rewrite(profile.Icon)
+	for i := range profile.Palette {
+		profile.Palette[i].ImageData = rewrite(profile.Palette[i].ImageData)
+	}
+	for i := range profile.Layouts {
+		rewriteLayoutImages(&profile.Layouts[i], rewrite)
+	}
+}
+
+// rewriteLayoutImages replaces the key, legend and layer icon images of a layout with
+// what rewrite returns for them
+func rewriteLayoutImages(layout *KeyboardLayout, rewrite func(image string) string) {
+	rewriteKeys := func(keys []Key) {
+		for i := range keys {
+			keys[i].ImageData, keys[i].ImagePath = rewriteKeyImage(keys[i].ImageData, keys[i].ImagePath, rewrite)
+			for slot, legend := range keys[i].Legends {
+				legend.ImageData, legend.ImagePath = rewriteKeyImage(legend.ImageData, legend.ImagePath, rewrite)
+				keys[i].Legends[slot] = legend
+			}
+		}
+	}
+
+	for _, keys := range layout.Layers {
+		rewriteKeys(keys)
+	}
+	for _, combos := range layout.ModifierMaps {
+		for _, keys := range combos {
+			rewriteKeys(keys)
+		}
+	}
+	for layerName, info := range layout.LayerInfo {
+		info.Icon = rewrite(info.Icon)
+		layout.LayerInfo[layerName] = info
+	}
+}
+
+// rewriteKeyImage rewrites the image of a key or legend. Keys hold inline images in
+// ImageData and references in ImagePath, so a rewritten image moves to the field its
+// new form belongs in.
+func rewriteKeyImage(data, path string, rewrite func(image string) string) (string, string) {
+	image := data
+	if image == "" {
+		image = path
+	}
+	if image == "" {
+		return data, path
+	}
+
+	switch rewritten := rewrite(image); {
+	case rewritten == image:
+		return data, path
+	case strings.HasPrefix(rewritten, "data:"):
+		return rewritten, ""
+	default:
+		return "", rewritten
+	}
+}
+
+// storeImage adds a data URL image to images, keyed by the reference a profile file
+// holds for it, and returns that reference. Anything that isn't a decodable data URL of
+// a known image type is returned unchanged, and stays inline.
+func storeImage(dataURL string, images map[string][]byte) string {
+	mediaType, data, ok := decodeDataURL(dataURL)
+	if !ok || imageMediaTypes[imageExtension(mediaType)] != mediaType {
+		return dataURL
+	}
+
+	sum := sha256.Sum256(data)
+	ref := "images/" + hex.EncodeToString(sum[:]) + imageExtension(mediaType)
+	images[ref] = data
+	return ref
+}
+
+// imageFilePaths returns where a stored image may be found: the images directory, then
+// the copy kept in the configuration directory for sync (see copyImagesForSync)
+func (a *App) imageFilePaths(ref string) []string {
+	name := strings.TrimPrefix(ref, "images/")
+	paths := []string{filepath.Join(a.paths.ImagesDir, name)}
+	if synced := filepath.Join(a.paths.ConfigDir, "images", name); synced != paths[0] {
+		paths = append(paths, synced)
+	}
+	return paths
+}
+
+// loadStoredImages turns a freshly parsed profile's image references back into data
+// URLs. A reference whose image is missing is kept, so it isn't lost when the profile
+// is written again.
+func (a *App) loadStoredImages(profile *Profile) {
+	missing := 0
+	rewriteProfileImages(profile, func(image string) string {
+		if !storedImageRefPattern.MatchString(image) {
+			return image
+		}
+		for _, path := range a.imageFilePaths(image) {
+			if data, err := os.ReadFile(path); err == nil {
+				return "data:" + imageMediaTypes[filepath.Ext(path)] + ";base64," + base64.StdEncoding.EncodeToString(data)
+			}
+		}
+		missing++
+		return image
+	})
+	if missing > 0 {
+		fmt.Printf("Warning: %d image(s) of profile %s are missing from %s\n", missing, profile.Name, a.paths.ImagesDir)
+	}
+}
+
+// writeStoredImages writes images to the images directory. Images are named by their
+// content, so one that already exists is left alone.
+func (a *App) writeStoredImages(images map[string][]byte) error {
+	if len(images) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(a.paths.ImagesDir, 0755); err != nil {
+		return fmt.Errorf("failed to create images directory %s: %v", a.paths.ImagesDir, err)
+	}
+	for ref, data := range images {
+		path := a.imageFilePaths(ref)[0]
+		if _, err := os.Stat(path); err == nil {
+			continue
+		}
+		if err := writeFileAtomic(path, data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyImagesForSync copies images missing from the configuration directory's images
+// directory into it, so they are committed with the profiles that reference them.
+// Nothing is copied when the two are the same directory. The caller must hold writeMu.
+func (a *App) copyImagesForSync() error {
+	syncedDir := filepath.Join(a.paths.ConfigDir, "images")
+	if syncedDir == a.paths.ImagesDir {
+		return nil
+	}
+	entries, err := os.ReadDir(a.paths.ImagesDir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read images directory: %v", err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !storedImageRefPattern.MatchString("images/"+entry.Name()) {
+			continue
+		}
+		target := filepath.Join(syncedDir, entry.Name())
+		if _, err := os.Stat(target); err == nil {
+			continue
+		}
+		if err := copyPath(filepath.Join(a.paths.ImagesDir, entry.Name()), target); err != nil {
+			return fmt.Errorf("failed to copy image %s for sync: %v", entry.Name(), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testImage is a 1x1 PNG
+const testImage = "data:image/png;base64,iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mNk+M9QDwADhgGAWjR9awAAAABJRU5ErkJggg=="
+
+func TestImagesAreStoredOutsideProfileFiles(t *testing.T) {
+	dataDir := t.TempDir()
+	app := NewApp(dataDir)
+	if err := app.UploadKeyImage("L00", testImage); err != nil {
+		t.Fatalf("UploadKeyImage: %v", err)
+	}
+	app.shutdown(nil)
+	profileID := testProfileID(app)
+
+	profilePath, err := app.getProfileDataPath(profileID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(profilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "base64,") {
+		t.Error("profile file holds the image inline")
+	}
+
+	images, err := filepath.Glob(filepath.Join(app.paths.ImagesDir, "*.png"))
+	if err != nil || len(images) != 1 {
+		t.Fatalf("images directory holds %v, want one image", images)
+	}
+	if !strings.Contains(string(data), `"images/`+filepath.Base(images[0])+`"`) {
+		t.Errorf("profile file doesn't reference %s", filepath.Base(images[0]))
+	}
+
+	reopened := NewApp(dataDir)
+	t.Cleanup(func() { reopened.shutdown(nil) })
+	if key := testKey(t, reopened, "L00"); key.ImageData != testImage || key.ImagePath != "" {
+		t.Errorf("image not loaded back: data %q, path %q", key.ImageData, key.ImagePath)
+	}
+}
+
+func TestMissingStoredImageKeepsReference(t *testing.T) {
+	app := &App{paths: Paths{ConfigDir: t.TempDir(), ImagesDir: t.TempDir()}}
+	ref := "images/" + strings.Repeat("a", 64) + ".png"
+
+	profile := &Profile{Layouts: []KeyboardLayout{{Layers: map[string][]Key{"base": {{ID: "L00", ImagePath: ref}}}}}}
+	app.loadStoredImages(profile)
+	if key := profile.Layouts[0].Layers["base"][0]; key.ImagePath != ref || key.ImageData != "" {
+		t.Errorf("missing image changed the key to data %q, path %q", key.ImageData, key.ImagePath)
+	}
+
+	// Only references in the stored form are looked up
+	profile.Layouts[0].Layers["base"][0].ImagePath = "images/../../etc/passwd"
+	app.loadStoredImages(profile)
+	if key := profile.Layouts[0].Layers["base"][0]; key.ImageData != "" {
+		t.Errorf("arbitrary path was read: %q", key.ImageData)
+	}
+}
@@ -0,0 +1,529 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// A profile with a parent inherits the parent's layouts. In memory a loaded child
+// always holds the resolved layouts, so everything that reads or edits layouts works
+// on it unchanged; its file only holds the overrides, the keys, layers, combinations
+// and layouts that differ from the parent. requestSave recomputes the overrides of an
+// edited child and re-resolves the children of an edited parent.
+//
+// Overrides can add or change things but not remove them, so layers a child inherits
+// can't be removed from it.
+
+// maxInheritanceDepth bounds how many ancestors a profile may have
+const maxInheritanceDepth = 16
+
+// CreateChildProfile creates a profile that inherits its layouts from parentID
+func (a *App) CreateChildProfile(parentID, name string) (string, error) {
+	a.lock()
+	defer a.unlock()
+
+	if err := a.checkNewProfileName(name); err != nil {
+		return "", err
+	}
+
+	parent := a.profileManager.GetProfile(parentID)
+	if parent == nil {
+		return "", fmt.Errorf("profile not found: %s", parentID)
+	}
+	if err := a.ensureProfileLoaded(parent); err != nil {
+		return "", err
+	}
+	// Loading may quarantine profiles, so look it up again
+	if parent = a.profileManager.GetProfile(parentID); parent == nil {
+		return "", fmt.Errorf("profile not found: %s", parentID)
+	}
+	if a.inheritanceDepth(parentID) >= maxInheritanceDepth {
+		return "", fmt.Errorf("profile %s is nested too deeply to inherit from", parent.Name)
+	}
+
+	child := parent.Clone()
+	child.ID = fmt.Sprintf("profile_%d", time.Now().UnixNano())
+	child.Name = name
+	child.Icon = ""
+	child.Description = ""
+	child.Parent = parentID
+	child.overrides = nil
+	child.CreatedAt = time.Now()
+	child.ModifiedAt = child.CreatedAt
+
+	a.profileManager.AddProfile(child)
+	a.notifyProfileChanged(child.ID, "created")
+	a.requestSave(child.ID)
+
+	return child.ToJSON()
+}
+
+// SetProfileParent makes a profile inherit from parentID. Its current layouts become
+// overrides on top of the parent's. An empty parentID detaches the profile, which
+// keeps its resolved layouts as its own.
+func (a *App) SetProfileParent(profileID, parentID string) error {
+	a.lock()
+	defer a.unlock()
+
+	profile := a.profileManager.GetProfile(profileID)
+	if profile == nil {
+		return fmt.Errorf("profile not found: %s", profileID)
+	}
+	if err := a.ensureProfileLoaded(profile); err != nil {
+		return err
+	}
+	// Loading may quarantine profiles, so look it up again
+	if profile = a.profileManager.GetProfile(profileID); profile == nil {
+		return fmt.Errorf("profile not found: %s", profileID)
+	}
+	if profile.Parent == parentID {
+		return nil
+	}
+
+	if parentID == "" {
+		profile.Parent = ""
+		profile.overrides = nil
+	} else {
+		parent := a.profileManager.GetProfile(parentID)
+		if parent == nil {
+			return fmt.Errorf("profile not found: %s", parentID)
+		}
+		if parentID == profileID || a.inheritsFrom(parentID, profileID) {
+			return fmt.Errorf("profile %s can't inherit from %s: it would inherit from itself", profile.Name, parent.Name)
+		}
+		if a.inheritanceDepth(parentID)+a.descendantDepth(profileID, 0) >= maxInheritanceDepth {
+			return fmt.Errorf("profile %s is nested too deeply to inherit from", parent.Name)
+		}
+		if err := a.ensureProfileLoaded(parent); err != nil {
+			return err
+		}
+		// Loading may quarantine profiles, so look both up again
+		profile, parent = a.profileManager.GetProfile(profileID), a.profileManager.GetProfile(parentID)
+		if profile == nil || parent == nil {
+			return fmt.Errorf("profile was removed while loading")
+		}
+
+		profile.Parent = parentID
+		profile.Layouts = resolveLayouts(parent.Layouts, profile.Layouts)
+		repairProfile(profile)
+	}
+
+	profile.ModifiedAt = time.Now()
+	a.notifyProfileChanged(profileID, "parent")
+	a.notifyLayerChanged(profile, "layout")
+	a.requestSave(profileID)
+	return nil
+}
+
+// GetProfileOverrides returns what a profile changes relative to its parent, as a
+// list of changes in the form diffProfiles uses
+func (a *App) GetProfileOverrides(profileID string) (string, error) {
+	a.lock()
+	defer a.unlock()
+
+	profile, parent, err := a.loadWithParent(profileID)
+	if err != nil {
+		return "", err
+	}
+
+	changes := []ProfileChange{}
+	for i := range profile.Layouts {
+		layout := &profile.Layouts[i]
+		inherited := findLayout(parent.Layouts, layout.Name)
+		if inherited == nil {
+			changes = append(changes, ProfileChange{Kind: "added", Scope: "layout", Layout: layout.Name})
+			continue
+		}
+		changes = append(changes, diffLayouts(inherited, layout)...)
+	}
+
+	data, err := json.MarshalIndent(changes, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// ResetKeyOverride sets a key back to the value inherited from the parent.
+// modifiers is the combination (e.g. "ctrl+shift"), or empty for the layer's own keys.
+func (a *App) ResetKeyOverride(profileID, layoutName, layer, modifiers, keyID string) error {
+	a.lock()
+	defer a.unlock()
+
+	profile, parent, err := a.loadWithParent(profileID)
+	if err != nil {
+		return err
+	}
+
+	layout := findLayout(profile.Layouts, layoutName)
+	if layout == nil {
+		return fmt.Errorf("layout not found: %s", layoutName)
+	}
+	inheritedLayout := findLayout(parent.Layouts, layoutName)
+	if inheritedLayout == nil {
+		return fmt.Errorf("layout %s is not inherited from %s", layoutName, parent.Name)
+	}
+
+	var key, inherited *Key
+	if modifiers == "" {
+		key = layout.GetKeyByID(layer, keyID)
+		inherited = inheritedLayout.GetKeyByID(layer, keyID)
+	} else {
+		key = layout.GetModifierKeyByID(layer, modifiers, keyID)
+		inherited = inheritedLayout.GetModifierKeyByID(layer, modifiers, keyID)
+	}
+	if key == nil {
+		return fmt.Errorf("key not found: %s", keyID)
+	}
+	if inherited == nil {
+		return fmt.Errorf("key %s is not inherited from %s", keyID, parent.Name)
+	}
+
+	*key = inherited.Clone()
+	profile.ModifiedAt = time.Now()
+	a.notifyProfileChanged(profileID, "override-reset")
+	a.requestSave(profileID)
+	return nil
+}
+
+// ResetProfileOverrides drops all of a profile's overrides, so it matches its parent
+func (a *App) ResetProfileOverrides(profileID string) error {
+	a.lock()
+	defer a.unlock()
+
+	profile, parent, err := a.loadWithParent(profileID)
+	if err != nil {
+		return err
+	}
+
+	profile.Layouts = cloneLayouts(parent.Layouts)
+	repairProfile(profile)
+	profile.ModifiedAt = time.Now()
+	a.notifyProfileChanged(profileID, "override-reset")
+	a.notifyLayerChanged(profile, "layout")
+	a.requestSave(profileID)
+	return nil
+}
+
+// loadWithParent loads a profile that has a parent, and the parent.
+// The caller must hold the write lock.
+func (a *App) loadWithParent(profileID string) (*Profile, *Profile, error) {
+	profile := a.profileManager.GetProfile(profileID)
+	if profile == nil {
+		return nil, nil, fmt.Errorf("profile not found: %s", profileID)
+	}
+	if err := a.ensureProfileLoaded(profile); err != nil {
+		return nil, nil, err
+	}
+	// Loading may quarantine profiles, so look it up again
+	profile = a.profileManager.GetProfile(profileID)
+	if profile == nil {
+		return nil, nil, fmt.Errorf("profile not found: %s", profileID)
+	}
+	if profile.Parent == "" {
+		return nil, nil, fmt.Errorf("profile %s doesn't inherit from another profile", profile.Name)
+	}
+
+	// A loaded child's parent is loaded too
+	parent := a.profileManager.GetProfile(profile.Parent)
+	if parent == nil || !parent.IsLoaded() {
+		return nil, nil, fmt.Errorf("parent profile of %s is not available", profile.Name)
+	}
+	return profile, parent, nil
+}
+
+// resolveInheritedLayouts turns the layouts read from a child's file, which are its
+// overrides, into resolved layouts, loading the parent first. A profile whose parent
+// is gone or would make it inherit from itself is detached and keeps its overrides as
+// its layouts. The caller must hold the write lock.
+func (a *App) resolveInheritedLayouts(profile *Profile) error {
+	profile.overrides = nil
+	if profile.Parent == "" {
+		return nil
+	}
+	profile.overrides = profile.Layouts
+
+	parent := a.profileManager.GetProfile(profile.Parent)
+	switch {
+	case parent == nil:
+		a.recordMessage("Parent of profile %s not found, it no longer inherits", profile.Name)
+	case profile.Parent == profile.ID || a.inheritsFrom(profile.Parent, profile.ID):
+		a.recordMessage("Profile %s inherited from itself, it no longer inherits", profile.Name)
+	default:
+		parentID := parent.ID
+		if err := a.ensureProfileLoaded(parent); err != nil {
+			if a.profileManager.GetProfile(parentID) != nil {
+				return fmt.Errorf("failed to load parent profile: %v", err)
+			}
+			// The parent was quarantined
+			a.recordMessage("Parent of profile %s could not be loaded, it no longer inherits", profile.Name)
+			break
+		}
+		parent = a.profileManager.GetProfile(parentID)
+		profile.Layouts = resolveLayouts(parent.Layouts, profile.overrides)
+		return nil
+	}
+
+	profile.Parent = ""
+	profile.overrides = nil
+	a.requestSave(profile.ID)
+	return nil
+}
+
+// updateInheritance brings inheritance up to date after a profile was edited: the
+// profile's overrides are recomputed and its children re-resolved.
+// The caller must hold the write lock.
+func (a *App) updateInheritance(profileID string) {
+	profile := a.profileManager.GetProfile(profileID)
+	if profile == nil || !profile.IsLoaded() {
+		return
+	}
+	if profile.Parent != "" {
+		if parent := a.profileManager.GetProfile(profile.Parent); parent != nil && parent.IsLoaded() {
+			profile.overrides = computeOverrides(profile.Layouts, parent.Layouts)
+		}
+	}
+	a.resolveChildren(profileID, 0)
+}
+
+// resolveChildren re-resolves the loaded profiles inheriting from a profile, and
+// theirs in turn. Children that aren't loaded yet resolve when they are.
+// The caller must hold the write lock.
+func (a *App) resolveChildren(parentID string, depth int) {
+	if depth >= maxInheritanceDepth {
+		return
+	}
+	parent := a.profileManager.GetProfile(parentID)
+	if parent == nil || !parent.IsLoaded() {
+		return
+	}
+
+	for i := range a.profileManager.Profiles {
+		child := &a.profileManager.Profiles[i]
+		if child.Parent != parentID || child.ID == parentID || !child.IsLoaded() {
+			continue
+		}
+		child.Layouts = resolveLayouts(parent.Layouts, child.overrides)
+		repairProfile(child)
+		a.notifyProfileChanged(child.ID, "inherited")
+		a.resolveChildren(child.ID, depth+1)
+	}
+}
+
+// detachChildren makes the profiles inheriting from a profile keep their resolved
+// layouts as their own, before the profile is deleted. The caller must hold the write lock.
+func (a *App) detachChildren(parentID string) error {
+	var childIDs []string
+	for _, profile := range a.profileManager.Profiles {
+		if profile.Parent == parentID {
+			childIDs = append(childIDs, profile.ID)
+		}
+	}
+
+	for _, childID := range childIDs {
+		child := a.profileManager.GetProfile(childID)
+		if child == nil {
+			continue
+		}
+		if err := a.ensureProfileLoaded(child); err != nil {
+			return fmt.Errorf("failed to detach profile %s: %v", child.Name, err)
+		}
+		child = a.profileManager.GetProfile(childID)
+		if child == nil {
+			continue
+		}
+		child.Parent = ""
+		child.overrides = nil
+		a.notifyProfileChanged(childID, "parent")
+		a.requestSave(childID)
+	}
+	return nil
+}
+
+// inheritsFrom reports whether ancestorID is among a profile's ancestors. Chains
+// deeper than maxInheritanceDepth count as inheriting, which stops cycles.
+// The caller must hold the lock.
+func (a *App) inheritsFrom(profileID, ancestorID string) bool {
+	for depth := 0; depth <= maxInheritanceDepth; depth++ {
+		profile := a.profileManager.GetProfile(profileID)
+		if profile == nil || profile.Parent == "" {
+			return false
+		}
+		if profile.Parent == ancestorID {
+			return true
+		}
+		profileID = profile.Parent
+	}
+	return true
+}
+
+// inheritanceDepth returns how many ancestors a profile has.
+// The caller must hold the lock.
+func (a *App) inheritanceDepth(profileID string) int {
+	depth := 0
+	for depth <= maxInheritanceDepth {
+		profile := a.profileManager.GetProfile(profileID)
+		if profile == nil || profile.Parent == "" {
+			break
+		}
+		profileID = profile.Parent
+		depth++
+	}
+	return depth
+}
+
+// descendantDepth returns how many generations of profiles inherit from a profile.
+// The caller must hold the lock.
+func (a *App) descendantDepth(profileID string, depth int) int {
+	if depth > maxInheritanceDepth {
+		return depth
+	}
+	deepest := 0
+	for _, profile := range a.profileManager.Profiles {
+		if profile.Parent == profileID && profile.ID != profileID {
+			if d := 1 + a.descendantDepth(profile.ID, depth+1); d > deepest {
+				deepest = d
+			}
+		}
+	}
+	return deepest
+}
+
+// resolveLayouts applies a child's overrides to its parent's layouts. Overridden
+// keys replace the parent's, new keys, layers and combinations are added, an
+// overridden layer order replaces the parent's, and layouts the parent doesn't have
+// are appended.
+func resolveLayouts(parent, overrides []KeyboardLayout) []KeyboardLayout {
+	resolved := cloneLayouts(parent)
+	if resolved == nil {
+		resolved = []KeyboardLayout{}
+	}
+
+	for i := range overrides {
+		override := &overrides[i]
+		layout := findLayout(resolved, override.Name)
+		if layout == nil {
+			resolved = append(resolved, override.Clone())
+			continue
+		}
+
+		inheritedModified := layout.ModifiedAt
+		if layout.Layers == nil {
+			layout.Layers = make(map[string][]Key)
+		}
+		mergeLayout(layout, override)
+		layout.ModifiedAt = inheritedModified
+		if override.ModifiedAt.After(inheritedModified) {
+			layout.ModifiedAt = override.ModifiedAt
+		}
+	}
+
+	return resolved
+}
+
+// computeOverrides returns the parts of a child's layouts that differ from its
+// parent's: changed and added keys, added layers and combinations, and whole layouts
+// the parent doesn't have. Layouts without differences are left out.
+func computeOverrides(layouts, parent []KeyboardLayout) []KeyboardLayout {
+	overrides := []KeyboardLayout{}
+
+	for i := range layouts {
+		layout := &layouts[i]
+		inherited := findLayout(parent, layout.Name)
+		if inherited == nil {
+			overrides = append(overrides, layout.Clone())
+			continue
+		}
+
+		sparse := KeyboardLayout{
+			Name:         layout.Name,
+			Layers:       make(map[string][]Key),
+			ModifierMaps: make(map[string]map[string][]Key),
+			CreatedAt:    layout.CreatedAt,
+			ModifiedAt:   layout.ModifiedAt,
+		}
+		changed := false
+		if layout.Description != inherited.Description {
+			sparse.Description = layout.Description
+			changed = true
+		}
+		if order := layout.GetLayerNames(); !reflect.DeepEqual(order, inherited.GetLayerNames()) {
+			sparse.LayerOrder = order
+			changed = true
+		}
+		// A setting cleared in the child is kept as an empty entry so it still overrides
+		for _, layerName := range unionKeys(layout.LayerInfo, inherited.LayerInfo) {
+			if info := layout.LayerInfo[layerName]; info != inherited.LayerInfo[layerName] {
+				if sparse.LayerInfo == nil {
+					sparse.LayerInfo = make(map[string]LayerInfo)
+				}
+				sparse.LayerInfo[layerName] = info
+				changed = true
+			}
+		}
+
+		for layerName, keys := range layout.Layers {
+			inheritedKeys, inheritedLayer := inherited.Layers[layerName]
+			if !inheritedLayer {
+				sparse.Layers[layerName] = cloneKeys(keys)
+				changed = true
+			} else if overridden := overriddenKeys(keys, inheritedKeys); len(overridden) > 0 {
+				sparse.Layers[layerName] = overridden
+				changed = true
+			}
+		}
+
+		for layerName, combos := range layout.ModifierMaps {
+			inheritedCombos := inherited.ModifierMaps[layerName]
+			for combo, keys := range combos {
+				inheritedKeys, inheritedCombo := inheritedCombos[combo]
+				var overridden []Key
+				if !inheritedCombo {
+					overridden = cloneKeys(keys)
+				} else if overridden = overriddenKeys(keys, inheritedKeys); len(overridden) == 0 {
+					continue
+				}
+				if sparse.ModifierMaps[layerName] == nil {
+					sparse.ModifierMaps[layerName] = make(map[string][]Key)
+				}
+				sparse.ModifierMaps[layerName][combo] = overridden
+				changed = true
+			}
+		}
+
+		if changed {
+			overrides = append(overrides, sparse)
+		}
+	}
+
+	return overrides
+}
+
+// overriddenKeys returns the keys that differ from, or are missing in, the inherited keys
+func overriddenKeys(keys, inherited []Key) []Key {
+	index := make(map[string]int, len(inherited))
+	for i, key := range inherited {
+		index[key.ID] = i
+	}
+
+	var overridden []Key
+	for _, key := range keys {
+		if i, exists := index[key.ID]; exists && len(changedKeyFields(inherited[i], key)) == 0 {
+			continue
+		}
+		overridden = append(overridden, key.Clone())
+	}
+	return overridden
+}
+
+// findLayout returns the layout with the given name, or nil
+func findLayout(layouts []KeyboardLayout, name string) *KeyboardLayout {
+	for i := range layouts {
+		if layouts[i].Name == name {
+			return &layouts[i]
+		}
+	}
+	return nil
+}
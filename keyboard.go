@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"sort"
 	"strings"
 	"time"
 )
@@ -10,7 +11,7 @@ import (
 type Key struct {
 	ID               string   `json:"id"`               // e.g., "L00", "R25"
 	Label            string   `json:"label"`            // Fallback text if no image
-	ImagePath        string   `json:"imagePath"`        // Path to uploaded image file
+	ImagePath        string   `json:"imagePath"`        // Reference to a stored image, used in profile files and bundles
 	ImageData        string   `json:"imageData"`        // Base64 encoded image data
 	Description      string   `json:"description"`      // Tooltip/detailed info
 	Color            string   `json:"color"`            // Hex color code
@@ -23,6 +24,10 @@ type Key struct {
 	CustomX          float64  `json:"customX"`          // Custom X position (pixels)
 	CustomY          float64  `json:"customY"`          // Custom Y position (pixels)
 	IsCustomPosition bool     `json:"isCustomPosition"` // Whether using custom positioning
+	Category         string   `json:"category,omitempty"`      // e.g. "letters", "modifiers" (see categories.go)
+	CategoryColor    bool     `json:"categoryColor,omitempty"` // Color follows the category's scheme color
+	Legends          map[string]Legend `json:"legends,omitempty"` // Extra legends by slot, e.g. "topLeft", "front" (see legends.go)
+	Tags             []string `json:"tags,omitempty"`          // Free-form tags such as "git" (see tags.go)
 }
 
 // ModifierCombination represents a combination of modifier keys
@@ -37,6 +42,8 @@ type KeyboardLayout struct {
 	Description string                          `json:"description"`
 	Layers      map[string][]Key                `json:"layers"`
 	ModifierMaps map[string]map[string][]Key    `json:"modifierMaps"` // layer -> modifier combo -> keys
+	LayerOrder  []string                        `json:"layerOrder,omitempty"` // Display order of the layers (see layers.go)
+	LayerInfo   map[string]LayerInfo            `json:"layerInfo,omitempty"`  // Display settings and protection per layer
 	CreatedAt   time.Time                       `json:"created_at"`
 	ModifiedAt  time.Time                       `json:"modified_at"`
 }
@@ -172,6 +179,8 @@ func DefaultTenkeylessLayout() KeyboardLayout {
 
 	// ONLY ONE LAYER - just base
 	layout.Layers["base"] = baseKeys
+	layout.LayerOrder = []string{"base"}
+	layout.LayerInfo = map[string]LayerInfo{"base": {Protected: true}}
 
 	// Initialize modifier maps - generate modifier combinations for base layer
 	layout.ModifierMaps["base"] = make(map[string][]Key)
@@ -297,6 +306,12 @@ func DefaultCorneLayout() KeyboardLayout {
 	layout.Layers["base"] = baseKeys
 	layout.Layers["lower"] = lowerKeys
 	layout.Layers["raise"] = raiseKeys
+	layout.LayerOrder = []string{"base", "lower", "raise"}
+	layout.LayerInfo = map[string]LayerInfo{
+		"base":  {Protected: true},
+		"lower": {ActivationHint: "Hold left thumb", Protected: true},
+		"raise": {ActivationHint: "Hold right thumb", Protected: true},
+	}
 
 	// Initialize modifier maps for each layer
 	layout.ModifierMaps["base"] = make(map[string][]Key)
@@ -428,92 +443,58 @@ func (kl *KeyboardLayout) GetKeysForModifier(layer, modifiers string) []Key {
 	return []Key{}
 }
 
-// GetKeysForActiveModifiers returns keys based on currently active individual modifiers
+// GetKeysForActiveModifiers returns a copy of the keys for the currently active individual modifiers.
+// It never modifies the layout: a missing combination is returned as blank keys and only
+// stored once one of its keys is updated.
 func (kl *KeyboardLayout) GetKeysForActiveModifiers(layer string, activeModifiers []string) []Key {
 	if len(activeModifiers) == 0 {
 		// No modifiers active, return base layer
 		if keys, exists := kl.Layers[layer]; exists {
-			return keys
+			return cloneKeys(keys)
 		}
 		return []Key{}
 	}
 
-	// Sort modifiers to ensure consistent key lookup
-	sortedMods := make([]string, len(activeModifiers))
-	copy(sortedMods, activeModifiers)
-	
-	// Sort the modifiers in a consistent order: ctrl, shift, alt, gui, then custom modifiers alphabetically
-	modOrder := map[string]int{"ctrl": 0, "shift": 1, "alt": 2, "gui": 3}
-	for i := 0; i < len(sortedMods); i++ {
-		for j := i + 1; j < len(sortedMods); j++ {
-			orderI, existsI := modOrder[sortedMods[i]]
-			orderJ, existsJ := modOrder[sortedMods[j]]
-			
-			// If both are built-in modifiers, sort by order
-			if existsI && existsJ {
-				if orderI > orderJ {
-					sortedMods[i], sortedMods[j] = sortedMods[j], sortedMods[i]
-				}
-			} else if existsI && !existsJ {
-				// Built-in comes before custom
-				continue
-			} else if !existsI && existsJ {
-				// Custom comes after built-in
-				sortedMods[i], sortedMods[j] = sortedMods[j], sortedMods[i]
-			} else {
-				// Both are custom, sort alphabetically
-				if sortedMods[i] > sortedMods[j] {
-					sortedMods[i], sortedMods[j] = sortedMods[j], sortedMods[i]
-				}
-			}
-		}
-	}
-	
-	// Create the combination key
-	comboKey := strings.Join(sortedMods, "+")
+	// Modifiers are stored in a consistent order: ctrl, shift, alt, gui, then custom modifiers alphabetically
+	comboKey := comboName(activeModifiers)
 	
 	// Look for the exact combination in the modifier maps
 	if layerMods, exists := kl.ModifierMaps[layer]; exists {
 		if keys, exists := layerMods[comboKey]; exists {
-			return keys
+			return cloneKeys(keys)
 		}
 		
-		// If exact combination doesn't exist, create it with blank layout
+		// If exact combination doesn't exist, return a blank layout for it
 		if baseKeys, exists := kl.Layers[layer]; exists {
-			newComboKeys := make([]Key, len(baseKeys))
-			
-			// Create blank keys based on base structure but without copying content
-			for i, baseKey := range baseKeys {
-				newComboKeys[i] = Key{
-					ID:               baseKey.ID,
-					Label:            "", // Start with blank label
-					ImagePath:        "", // No image path
-					ImageData:        "", // No image data  
-					Description:      "", // No description
-					Color:            "#e0e0e0", // Light grey for blank keys
-					Layer:            baseKey.Layer,
-					Modifiers:        sortedMods, // Set the active modifiers
-					Row:              baseKey.Row,
-					Col:              baseKey.Col,
-					Side:             baseKey.Side,
-					KeyType:          baseKey.KeyType,
-					CustomX:          baseKey.CustomX,
-					CustomY:          baseKey.CustomY,
-					IsCustomPosition: baseKey.IsCustomPosition,
-				}
-			}
-			
-			// Store the new blank combination
-			layerMods[comboKey] = newComboKeys
-			kl.ModifiedAt = time.Now()
-			
-			return newComboKeys
+			return blankComboKeys(baseKeys, comboKey)
 		}
 	}
 
 	return []Key{}
 }
 
+// blankComboKeys returns the keys of a modifier combination that was never edited:
+// blank keys laid out like the layer's own keys
+func blankComboKeys(baseKeys []Key, combo string) []Key {
+	comboKeys := make([]Key, len(baseKeys))
+	for i, baseKey := range baseKeys {
+		comboKeys[i] = Key{
+			ID:               baseKey.ID,
+			Color:            blankKeyColor, // Light grey for blank keys
+			Layer:            baseKey.Layer,
+			Modifiers:        strings.Split(combo, "+"),
+			Row:              baseKey.Row,
+			Col:              baseKey.Col,
+			Side:             baseKey.Side,
+			KeyType:          baseKey.KeyType,
+			CustomX:          baseKey.CustomX,
+			CustomY:          baseKey.CustomY,
+			IsCustomPosition: baseKey.IsCustomPosition,
+		}
+	}
+	return comboKeys
+}
+
 // UpdateModifierKey updates a key in a specific modifier combination
 func (kl *KeyboardLayout) UpdateModifierKey(layer, modifiers string, updatedKey Key) bool {
 	if layerMods, exists := kl.ModifierMaps[layer]; exists {
@@ -537,82 +518,13 @@ func (kl *KeyboardLayout) UpdateModifierKeyByActiveModifiers(layer string, activ
 		return kl.UpdateKey(layer, updatedKey)
 	}
 	
-	// Sort modifiers to ensure consistent key lookup
-	sortedMods := make([]string, len(activeModifiers))
-	copy(sortedMods, activeModifiers)
-	
-	// Sort the modifiers in a consistent order: ctrl, shift, alt, gui, then custom modifiers alphabetically
-	modOrder := map[string]int{"ctrl": 0, "shift": 1, "alt": 2, "gui": 3}
-	for i := 0; i < len(sortedMods); i++ {
-		for j := i + 1; j < len(sortedMods); j++ {
-			orderI, existsI := modOrder[sortedMods[i]]
-			orderJ, existsJ := modOrder[sortedMods[j]]
-			
-			// If both are built-in modifiers, sort by order
-			if existsI && existsJ {
-				if orderI > orderJ {
-					sortedMods[i], sortedMods[j] = sortedMods[j], sortedMods[i]
-				}
-			} else if existsI && !existsJ {
-				// Built-in comes before custom
-				continue
-			} else if !existsI && existsJ {
-				// Custom comes after built-in
-				sortedMods[i], sortedMods[j] = sortedMods[j], sortedMods[i]
-			} else {
-				// Both are custom, sort alphabetically
-				if sortedMods[i] > sortedMods[j] {
-					sortedMods[i], sortedMods[j] = sortedMods[j], sortedMods[i]
-				}
-			}
-		}
-	}
-	
-	// Create the combination key
-	comboKey := strings.Join(sortedMods, "+")
-	
-	// Check if the modifier combination exists, if not create it
-	if layerMods, exists := kl.ModifierMaps[layer]; exists {
-		if _, exists := layerMods[comboKey]; !exists {
-			// Combination doesn't exist, create it based on base layer structure but with blank content
-			if baseKeys, exists := kl.Layers[layer]; exists {
-				newComboKeys := make([]Key, len(baseKeys))
-				
-				// Create blank keys based on base structure but without copying content
-				for i, baseKey := range baseKeys {
-					newComboKeys[i] = Key{
-						ID:               baseKey.ID,
-						Label:            "", // Start with blank label
-						ImagePath:        "", // No image path
-						ImageData:        "", // No image data  
-						Description:      "", // No description
-						Color:            "#e0e0e0", // Light grey for blank keys
-						Layer:            baseKey.Layer,
-						Modifiers:        sortedMods, // Set the active modifiers
-						Row:              baseKey.Row,
-						Col:              baseKey.Col,
-						Side:             baseKey.Side,
-						KeyType:          baseKey.KeyType,
-						CustomX:          baseKey.CustomX,
-						CustomY:          baseKey.CustomY,
-						IsCustomPosition: baseKey.IsCustomPosition,
-					}
-				}
-				
-				// Store the new blank combination
-				layerMods[comboKey] = newComboKeys
-			}
-		}
-		
-		// Now update the specific key in the combination
-		if keys, exists := layerMods[comboKey]; exists {
-			for i := range keys {
-				if keys[i].ID == updatedKey.ID {
-					keys[i] = updatedKey
-					kl.ModifiedAt = time.Now()
-					return true
-				}
-			}
+	// A combination that was never edited is stored blank first
+	keys := kl.keysFor(layer, comboName(activeModifiers), true)
+	for i := range keys {
+		if keys[i].ID == updatedKey.ID {
+			keys[i] = updatedKey
+			kl.ModifiedAt = time.Now()
+			return true
 		}
 	}
 	
@@ -623,6 +535,7 @@ func (kl *KeyboardLayout) UpdateModifierKeyByActiveModifiers(layer string, activ
 func (kl *KeyboardLayout) AddCustomLayer(layerName string, baseKeys []Key) {
 	kl.Layers[layerName] = baseKeys
 	kl.ModifierMaps[layerName] = make(map[string][]Key)
+	kl.LayerOrder = append(kl.GetLayerNames(), layerName)
 	
 	// Generate modifier combinations for both keyboard types
 	// Only skip multiple layers for Tenkeyless, but keep modifier support
@@ -634,14 +547,16 @@ func (kl *KeyboardLayout) AddCustomLayer(layerName string, baseKeys []Key) {
 
 // RemoveCustomLayer removes a layer from the layout
 func (kl *KeyboardLayout) RemoveCustomLayer(layerName string) bool {
-	// Don't allow removal of base layers
-	if layerName == "base" || layerName == "lower" || layerName == "raise" {
+	// Don't allow removal of protected layers
+	if kl.GetLayerInfo(layerName).Protected {
 		return false
 	}
 	
 	if _, exists := kl.Layers[layerName]; exists {
 		delete(kl.Layers, layerName)
 		delete(kl.ModifierMaps, layerName)
+		delete(kl.LayerInfo, layerName)
+		kl.LayerOrder = kl.GetLayerNames()
 		kl.ModifiedAt = time.Now()
 		return true
 	}
@@ -668,13 +583,31 @@ func (kl *KeyboardLayout) UpdateKey(layer string, updatedKey Key) bool {
 	return false
 }
 
-// GetLayerNames returns all available layer names
+// GetLayerNames returns all available layer names in display order. Layers missing
+// from LayerOrder follow the ordered ones: base first, then by name.
 func (kl *KeyboardLayout) GetLayerNames() []string {
 	layers := make([]string, 0, len(kl.Layers))
+	listed := make(map[string]bool, len(kl.Layers))
+	for _, name := range kl.LayerOrder {
+		if _, exists := kl.Layers[name]; exists && !listed[name] {
+			listed[name] = true
+			layers = append(layers, name)
+		}
+	}
+	
+	var rest []string
 	for name := range kl.Layers {
-		layers = append(layers, name)
+		if !listed[name] {
+			rest = append(rest, name)
+		}
 	}
-	return layers
+	sort.Slice(rest, func(i, j int) bool {
+		if (rest[i] == "base") != (rest[j] == "base") {
+			return rest[i] == "base"
+		}
+		return rest[i] < rest[j]
+	})
+	return append(layers, rest...)
 }
 
 // ToJSON converts the layout to JSON string
@@ -686,6 +619,70 @@ func (kl *KeyboardLayout) ToJSON() (string, error) {
 	return string(data), nil
 }
 
+// Clone returns a deep copy of the key
+func (k Key) Clone() Key {
+	k.Modifiers = cloneStrings(k.Modifiers)
+	k.Legends = cloneLegends(k.Legends)
+	k.Tags = cloneStrings(k.Tags)
+	return k
+}
+
+// cloneKeys returns a deep copy of a key slice
+func cloneKeys(keys []Key) []Key {
+	if keys == nil {
+		return nil
+	}
+	cloned := make([]Key, len(keys))
+	for i, key := range keys {
+		cloned[i] = key.Clone()
+	}
+	return cloned
+}
+
+// cloneStrings returns a copy of a string slice, preserving nil
+func cloneStrings(values []string) []string {
+	if values == nil {
+		return nil
+	}
+	return append([]string{}, values...)
+}
+
+// Clone returns a deep copy of the layout
+func (kl *KeyboardLayout) Clone() KeyboardLayout {
+	cloned := *kl
+	cloned.LayerOrder = cloneStrings(kl.LayerOrder)
+	if kl.LayerInfo != nil {
+		cloned.LayerInfo = make(map[string]LayerInfo, len(kl.LayerInfo))
+		for layer, info := range kl.LayerInfo {
+			cloned.LayerInfo[layer] = info
+		}
+	}
+	
+	if kl.Layers != nil {
+		cloned.Layers = make(map[string][]Key, len(kl.Layers))
+		for layer, keys := range kl.Layers {
+			cloned.Layers[layer] = cloneKeys(keys)
+		}
+	}
+	
+	if kl.ModifierMaps != nil {
+		cloned.ModifierMaps = make(map[string]map[string][]Key, len(kl.ModifierMaps))
+		for layer, combos := range kl.ModifierMaps {
+			if combos == nil {
+				cloned.ModifierMaps[layer] = nil
+				continue
+			}
+			clonedCombos := make(map[string][]Key, len(combos))
+			for combo, keys := range combos {
+				clonedCombos[combo] = cloneKeys(keys)
+			}
+			cloned.ModifierMaps[layer] = clonedCombos
+		}
+	}
+	
+	return cloned
+}
+
 // FromJSON creates a layout from JSON string
 func FromJSON(jsonStr string) (*KeyboardLayout, error) {
 	var layout KeyboardLayout
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Swapping, moving and mirroring change which key carries a binding: the label,
+// image, description and color. The keycaps themselves (ID, row, column and
+// position) stay where they are.
+
+// blankKeyColor is the color of a key without a binding
+const blankKeyColor = "#e0e0e0"
+
+// SwapKeys swaps the bindings of two keys in a layer, in one of its modifier
+// combinations (combo, "" for the layer itself), or with allCombos in the layer and
+// all of its combinations
+func (kl *KeyboardLayout) SwapKeys(layer, combo, keyA, keyB string, allCombos bool) error {
+	lists, err := kl.keyLists(layer, combo, allCombos, keyA, keyB)
+	if err != nil {
+		return err
+	}
+	for _, keys := range lists {
+		a, b := findKey(keys, keyA), findKey(keys, keyB)
+		if a == nil || b == nil {
+			continue
+		}
+		content := *a
+		copyKeyContent(a, *b)
+		copyKeyContent(b, content)
+	}
+	kl.ModifiedAt = time.Now()
+	return nil
+}
+
+// MoveKeyBinding moves a key's binding to another key, leaving the first key blank.
+// combo and allCombos work as in SwapKeys.
+func (kl *KeyboardLayout) MoveKeyBinding(layer, combo, fromID, toID string, allCombos bool) error {
+	if fromID == toID {
+		return fmt.Errorf("cannot move key %s onto itself", fromID)
+	}
+	lists, err := kl.keyLists(layer, combo, allCombos, fromID, toID)
+	if err != nil {
+		return err
+	}
+	for _, keys := range lists {
+		from, to := findKey(keys, fromID), findKey(keys, toID)
+		if from == nil || to == nil {
+			continue
+		}
+		copyKeyContent(to, *from)
+		copyKeyContent(from, Key{Color: blankKeyColor})
+	}
+	kl.ModifiedAt = time.Now()
+	return nil
+}
+
+// MirrorHalves swaps the bindings of a split layout's halves, so that each left key
+// trades with the right key in the same row at the mirrored column (the outermost
+// left key with the outermost right key, and so on). Every key must have a
+// counterpart. combo and allCombos work as in SwapKeys.
+func (kl *KeyboardLayout) MirrorHalves(layer, combo string, allCombos bool) error {
+	pairs, err := mirrorPairs(kl.Layers[layer])
+	if err != nil {
+		return err
+	}
+	lists, err := kl.keyLists(layer, combo, allCombos)
+	if err != nil {
+		return err
+	}
+	for _, keys := range lists {
+		for left, right := range pairs {
+			a, b := findKey(keys, left), findKey(keys, right)
+			if a == nil || b == nil {
+				continue
+			}
+			content := *a
+			copyKeyContent(a, *b)
+			copyKeyContent(b, content)
+		}
+	}
+	kl.ModifiedAt = time.Now()
+	return nil
+}
+
+// keyLists returns the key lists an operation applies to, after checking that the
+// layer has the given keys
+func (kl *KeyboardLayout) keyLists(layer, combo string, allCombos bool, keyIDs ...string) ([][]Key, error) {
+	keys, exists := kl.Layers[layer]
+	if !exists {
+		return nil, fmt.Errorf("layer %s does not exist", layer)
+	}
+	for _, keyID := range keyIDs {
+		if findKey(keys, keyID) == nil {
+			return nil, fmt.Errorf("key %s not found in layer %s", keyID, layer)
+		}
+	}
+
+	switch {
+	case allCombos:
+		lists := [][]Key{keys}
+		combos := kl.ModifierMaps[layer]
+		for _, name := range unionKeys(combos, nil) {
+			lists = append(lists, combos[name])
+		}
+		return lists, nil
+	case combo != "":
+		return [][]Key{kl.keysFor(layer, combo, true)}, nil
+	default:
+		return [][]Key{keys}, nil
+	}
+}
+
+// mirrorPairs maps each left key's ID to its mirrored right key's ID. Columns are
+// counted from the left on both halves, so column c of a row mirrors to column
+// (last - c + first) of the same row on the other half.
+func mirrorPairs(keys []Key) (map[string]string, error) {
+	type position struct{ row, col int }
+	halves := map[string]map[position]string{"left": {}, "right": {}}
+	first := map[string]map[int]int{"left": {}, "right": {}}
+	last := map[string]map[int]int{"left": {}, "right": {}}
+
+	for _, key := range keys {
+		half, split := halves[key.Side]
+		if !split {
+			continue
+		}
+		half[position{key.Row, key.Col}] = key.ID
+		if col, seen := first[key.Side][key.Row]; !seen || key.Col < col {
+			first[key.Side][key.Row] = key.Col
+		}
+		if col, seen := last[key.Side][key.Row]; !seen || key.Col > col {
+			last[key.Side][key.Row] = key.Col
+		}
+	}
+	if len(halves["left"]) == 0 || len(halves["right"]) == 0 {
+		return nil, fmt.Errorf("layout is not split into halves")
+	}
+	if len(halves["left"]) != len(halves["right"]) {
+		return nil, fmt.Errorf("halves have different numbers of keys (%d left, %d right)", len(halves["left"]), len(halves["right"]))
+	}
+
+	pairs := make(map[string]string, len(halves["left"]))
+	for pos, leftID := range halves["left"] {
+		mirrored := position{pos.row, last["right"][pos.row] - (pos.col - first["left"][pos.row])}
+		rightID, exists := halves["right"][mirrored]
+		if !exists {
+			return nil, fmt.Errorf("key %s has no mirrored key on the right half", leftID)
+		}
+		pairs[leftID] = rightID
+	}
+	return pairs, nil
+}
+
+// copyKeyContent gives a key the binding of another, keeping its own position
+func copyKeyContent(dst *Key, src Key) {
+	dst.Label = src.Label
+	dst.ImagePath = src.ImagePath
+	dst.ImageData = src.ImageData
+	dst.Description = src.Description
+	dst.Color = src.Color
+	dst.Category = src.Category
+	dst.CategoryColor = src.CategoryColor
+	dst.Legends = cloneLegends(src.Legends)
+	dst.Tags = cloneStrings(src.Tags)
+}
+
+// SwapKeys swaps the bindings of two keys on the current layer, in the active
+// modifier combination or, with allCombos, in the layer and all its combinations
+func (a *App) SwapKeys(keyA, keyB string, allCombos bool) error {
+	return a.editCurrentLayer(func(layout *KeyboardLayout, layer, combo string) error {
+		return layout.SwapKeys(layer, combo, keyA, keyB, allCombos)
+	})
+}
+
+// MoveKeyBinding moves a key's binding to another key on the current layer, in the
+// active modifier combination or, with allCombos, in the layer and all its combinations
+func (a *App) MoveKeyBinding(fromID, toID string, allCombos bool) error {
+	return a.editCurrentLayer(func(layout *KeyboardLayout, layer, combo string) error {
+		return layout.MoveKeyBinding(layer, combo, fromID, toID, allCombos)
+	})
+}
+
+// MirrorHalves swaps the bindings of the left and right halves of the current layer,
+// in the active modifier combination or, with allCombos, in the layer and all its
+// combinations
+func (a *App) MirrorHalves(allCombos bool) error {
+	return a.editCurrentLayer(func(layout *KeyboardLayout, layer, combo string) error {
+		return layout.MirrorHalves(layer, combo, allCombos)
+	})
+}
+
+// editCurrentLayer runs an edit on the current layer and active modifier
+// combination of the active profile, then saves it. The edit runs on a copy of the
+// layout, so a failed edit changes nothing.
+func (a *App) editCurrentLayer(edit func(layout *KeyboardLayout, layer, combo string) error) error {
+	a.lock()
+	defer a.unlock()
+
+	location, activeProfile, currentLayout, _, err := a.resolveKeyContext(a.activeKeyContext(), false)
+	if err != nil {
+		return err
+	}
+	edited := currentLayout.Clone()
+	if err := edit(&edited, location.Layer, comboName(location.Modifiers)); err != nil {
+		return err
+	}
+
+	*currentLayout = edited
+	activeProfile.ModifiedAt = time.Now()
+	a.notifyLayerChanged(activeProfile, "keys")
+	a.requestSave(activeProfile.ID)
+	return nil
+}
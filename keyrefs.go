@@ -0,0 +1,292 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+// A key description can refer to other keys of the same layout with [[layer/combo:KEY]],
+// e.g. [[raise/ctrl:R04]]. [[raise:R04]] is a key on the raise layer itself and
+// [[R04]] a key next to the described one (same layer and combination). References
+// render as the label of the key they point to and are checked when a layout is
+// imported and by CheckKeyReferences.
+
+// keyReferencePattern finds references in Markdown source
+var keyReferencePattern = regexp.MustCompile(`\[\[([^\[\]\n]+?)\]\]`)
+
+// KeyReference is a reference to a key, as written and as resolved
+type KeyReference struct {
+	Ref       string `json:"ref"`             // As written, without the brackets
+	Layer     string `json:"layer"`           // Layer of the key referred to
+	Modifiers string `json:"modifiers"`       // Its modifier combination, "" for the layer itself
+	KeyID     string `json:"keyId"`           // Its ID
+	Label     string `json:"label,omitempty"` // Its label
+	Error     string `json:"error,omitempty"` // Why the reference doesn't resolve
+}
+
+// RenderedDescription is a key description rendered for display and for export
+type RenderedDescription struct {
+	HTML       string         `json:"html"` // Sanitized HTML
+	Text       string         `json:"text"` // Plain text
+	References []KeyReference `json:"references"`
+}
+
+// BrokenReference is a reference in a key's description that doesn't resolve
+type BrokenReference struct {
+	Layout    string       `json:"layout"`
+	Layer     string       `json:"layer"`
+	Modifiers string       `json:"modifiers"`
+	KeyID     string       `json:"keyId"`
+	Reference KeyReference `json:"reference"`
+}
+
+// parseKeyReference reads a reference made from a key on layer and combo
+func parseKeyReference(ref, layer, combo string) KeyReference {
+	ref = strings.TrimSpace(ref)
+	reference := KeyReference{Ref: ref, Layer: layer, Modifiers: combo, KeyID: ref}
+	if colon := strings.LastIndex(ref, ":"); colon >= 0 {
+		location := ref[:colon]
+		reference.KeyID = strings.TrimSpace(ref[colon+1:])
+		reference.Layer, reference.Modifiers = strings.TrimSpace(location), ""
+		if slash := strings.Index(location, "/"); slash >= 0 {
+			reference.Layer = strings.TrimSpace(location[:slash])
+			reference.Modifiers = strings.TrimSpace(location[slash+1:])
+		}
+	}
+	if reference.Modifiers != "" {
+		// Modifiers may be written in any order, as in [[raise/shift+ctrl:R04]]
+		mods := strings.Split(reference.Modifiers, "+")
+		for i := range mods {
+			mods[i] = strings.TrimSpace(mods[i])
+		}
+		reference.Modifiers = comboName(mods)
+	}
+	return reference
+}
+
+// location returns where a reference points, in reference notation
+func (r KeyReference) location() string {
+	if r.Modifiers == "" {
+		return fmt.Sprintf("%s:%s", r.Layer, r.KeyID)
+	}
+	return fmt.Sprintf("%s/%s:%s", r.Layer, r.Modifiers, r.KeyID)
+}
+
+// resolveKeyReference looks up the key a reference points to in a layout, setting
+// its label or, if it doesn't resolve, the error
+func resolveKeyReference(layout *KeyboardLayout, reference *KeyReference) {
+	_, exists := layout.Layers[reference.Layer]
+	switch {
+	case reference.KeyID == "":
+		reference.Error = "no key given"
+		return
+	case reference.Layer == "":
+		reference.Error = "no layer given"
+		return
+	case !exists:
+		reference.Error = fmt.Sprintf("layer %s not found", reference.Layer)
+		return
+	}
+	// A combination that was never edited is blank, but its keys exist
+	key := findKey(layout.keysFor(reference.Layer, reference.Modifiers, false), reference.KeyID)
+	if key == nil {
+		reference.Error = fmt.Sprintf("key %s not found on layer %s", reference.KeyID, reference.Layer)
+		return
+	}
+	reference.Label = key.Label
+}
+
+// renderDescription renders the description of a key on layer and combo of a layout
+func renderDescription(layout *KeyboardLayout, layer, combo, description string) RenderedDescription {
+	rendered := RenderedDescription{References: []KeyReference{}}
+	rendered.HTML, rendered.Text = renderMarkdown(description, func(ref string) (string, string) {
+		reference := parseKeyReference(ref, layer, combo)
+		resolveKeyReference(layout, &reference)
+		rendered.References = append(rendered.References, reference)
+
+		if reference.Error != "" {
+			return fmt.Sprintf(`<span class="key-ref key-ref-broken" title="%s">%s</span>`,
+				html.EscapeString(reference.Error), html.EscapeString("[["+ref+"]]")), "[[" + ref + "]]"
+		}
+		name := reference.Label
+		if name == "" {
+			name = reference.KeyID
+		}
+		return fmt.Sprintf(`<span class="key-ref" data-layer="%s" data-modifiers="%s" data-key="%s" title="%s">%s</span>`,
+			html.EscapeString(reference.Layer), html.EscapeString(reference.Modifiers), html.EscapeString(reference.KeyID),
+			html.EscapeString(reference.location()), html.EscapeString(name)), fmt.Sprintf("%s (%s)", name, reference.location())
+	})
+	return rendered
+}
+
+// keyReferences returns the references in a description made from a key on layer
+// and combo, resolved against the layout
+func keyReferences(layout *KeyboardLayout, layer, combo, description string) []KeyReference {
+	var references []KeyReference
+	for _, match := range keyReferencePattern.FindAllStringSubmatch(description, -1) {
+		reference := parseKeyReference(match[1], layer, combo)
+		resolveKeyReference(layout, &reference)
+		references = append(references, reference)
+	}
+	return references
+}
+
+// brokenReferences returns the references in a layout's descriptions that don't resolve
+func brokenReferences(layout *KeyboardLayout) []BrokenReference {
+	broken := []BrokenReference{}
+	check := func(layer, combo string, keys []Key) {
+		for _, key := range keys {
+			for _, reference := range keyReferences(layout, layer, combo, key.Description) {
+				if reference.Error != "" {
+					broken = append(broken, BrokenReference{Layout: layout.Name, Layer: layer, Modifiers: combo, KeyID: key.ID, Reference: reference})
+				}
+			}
+		}
+	}
+	for _, layer := range layout.GetLayerNames() {
+		check(layer, "", layout.Layers[layer])
+		for _, combo := range unionKeys(layout.ModifierMaps[layer], nil) {
+			check(layer, combo, layout.ModifierMaps[layer][combo])
+		}
+	}
+	return broken
+}
+
+// renameLayerReferences points references to a renamed layer at its new name
+func (kl *KeyboardLayout) renameLayerReferences(oldName, newName string) {
+	eachLayoutKey(kl, func(key *Key) {
+		key.Description = keyReferencePattern.ReplaceAllStringFunc(key.Description, func(match string) string {
+			ref := match[2 : len(match)-2]
+			colon := strings.LastIndex(ref, ":")
+			if colon < 0 {
+				return match
+			}
+			layer, rest := ref[:colon], ref[colon:]
+			if slash := strings.Index(layer, "/"); slash >= 0 {
+				layer, rest = ref[:slash], ref[slash:]
+			}
+			if strings.TrimSpace(layer) != oldName {
+				return match
+			}
+			return "[[" + newName + rest + "]]"
+		})
+	})
+}
+
+// RenderDescription renders Markdown as a description of a key in the current
+// context would be, for previews while editing
+func (a *App) RenderDescription(markdown string) (string, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	location, _, layout, _, err := a.resolveKeyContext(a.activeKeyContext(), false)
+	if err != nil {
+		return "", err
+	}
+	return marshalRenderedDescription(renderDescription(layout, location.Layer, comboName(location.Modifiers), markdown))
+}
+
+// RenderKeyDescription renders the description of a key in the current context as
+// sanitized HTML and plain text, resolving its key references
+func (a *App) RenderKeyDescription(keyID string) (string, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	location, _, layout, keys, err := a.resolveKeyContext(a.activeKeyContext(), false)
+	if err != nil {
+		return "", err
+	}
+	key := findKey(keys, keyID)
+	if key == nil {
+		return "", fmt.Errorf("key %s not found in current context", keyID)
+	}
+	return marshalRenderedDescription(renderDescription(layout, location.Layer, comboName(location.Modifiers), key.Description))
+}
+
+// CheckKeyReferences returns the key references in the active profile's descriptions
+// that don't resolve, in all its layouts
+func (a *App) CheckKeyReferences() (string, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	activeProfile := a.profileManager.GetActiveProfile()
+	if activeProfile == nil {
+		return "", fmt.Errorf("no active profile available")
+	}
+
+	broken := []BrokenReference{}
+	for i := range activeProfile.Layouts {
+		broken = append(broken, brokenReferences(&activeProfile.Layouts[i])...)
+	}
+
+	data, err := json.MarshalIndent(broken, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal references: %v", err)
+	}
+	return string(data), nil
+}
+
+// ExportLayoutText exports the current layout as a plain text cheatsheet: every key
+// with a label, image or description, by layer and modifier combination
+func (a *App) ExportLayoutText() (string, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	_, currentLayout, err := a.activeLayout()
+	if err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	title := func(text string, underline string) {
+		out.WriteString(text + "\n" + strings.Repeat(underline, len([]rune(text))) + "\n\n")
+	}
+	section := func(layer, combo string, keys []Key) {
+		var lines []string
+		for _, key := range keys {
+			content := key.Label
+			if content == "" && (key.ImageData != "" || key.ImagePath != "") {
+				content = "[image]"
+			}
+			description := renderDescription(currentLayout, layer, combo, key.Description).Text
+			if content == "" && description == "" {
+				continue
+			}
+			line := fmt.Sprintf("%-6s %s", key.ID, content)
+			if description != "" {
+				line = strings.TrimRight(line, " ") + " - " + strings.ReplaceAll(description, "\n", "\n       ")
+			}
+			lines = append(lines, line)
+		}
+		if len(lines) == 0 {
+			return
+		}
+		heading := currentLayout.GetLayerInfo(layer).DisplayName
+		if combo != "" {
+			heading += " + " + combo
+		}
+		title(heading, "-")
+		out.WriteString(strings.Join(lines, "\n") + "\n\n")
+	}
+
+	title(currentLayout.Name, "=")
+	for _, layer := range currentLayout.GetLayerNames() {
+		section(layer, "", currentLayout.Layers[layer])
+		for _, combo := range unionKeys(currentLayout.ModifierMaps[layer], nil) {
+			section(layer, combo, currentLayout.ModifierMaps[layer][combo])
+		}
+	}
+	return strings.TrimRight(out.String(), "\n") + "\n", nil
+}
+
+// marshalRenderedDescription returns a rendered description as JSON
+func marshalRenderedDescription(rendered RenderedDescription) (string, error) {
+	data, err := json.MarshalIndent(rendered, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal description: %v", err)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,424 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Layers live in a map, so their display order is kept separately in LayerOrder, and
+// their display settings in LayerInfo. GetLayerNames tolerates an order that is missing
+// or out of date; the methods that add, remove or rename layers keep it complete.
+
+// LayerInfo holds a layer's display settings
+type LayerInfo struct {
+	DisplayName    string `json:"displayName,omitempty"`    // Shown instead of the layer name
+	Color          string `json:"color,omitempty"`          // Hex color for the layer's tab and exports
+	Icon           string `json:"icon,omitempty"`           // Base64 encoded image
+	Description    string `json:"description,omitempty"`    // What the layer is for
+	ActivationHint string `json:"activationHint,omitempty"` // How to reach the layer, e.g. "Hold left thumb"
+	Protected      bool   `json:"protected,omitempty"`      // The layer can't be removed
+}
+
+// LayerDetails is a layer's name with its display settings, as returned by GetAvailableLayers
+type LayerDetails struct {
+	Name string `json:"name"`
+	LayerInfo
+}
+
+// GetLayerInfo returns a layer's display settings, with the display name defaulting
+// to the layer name. The base layer is always protected.
+func (kl *KeyboardLayout) GetLayerInfo(layerName string) LayerInfo {
+	info := kl.LayerInfo[layerName]
+	if info.DisplayName == "" {
+		info.DisplayName = layerName
+	}
+	if layerName == "base" {
+		info.Protected = true
+	}
+	return info
+}
+
+// SetLayerInfo replaces a layer's display settings
+func (kl *KeyboardLayout) SetLayerInfo(layerName string, info LayerInfo) error {
+	if _, exists := kl.Layers[layerName]; !exists {
+		return fmt.Errorf("layer %s does not exist", layerName)
+	}
+	if err := validateLayerInfo(info); err != nil {
+		return err
+	}
+	if layerName == "base" && !info.Protected {
+		return fmt.Errorf("the base layer is always protected")
+	}
+
+	// A display name equal to the layer name is the default, so it isn't stored
+	if info.DisplayName == layerName {
+		info.DisplayName = ""
+	}
+	// Empty settings are kept too, so a layout that once had settings is never mistaken
+	// for one saved before layers had them (see repairLayout)
+	if kl.LayerInfo == nil {
+		kl.LayerInfo = make(map[string]LayerInfo)
+	}
+	kl.LayerInfo[layerName] = info
+	kl.ModifiedAt = time.Now()
+	return nil
+}
+
+// GetLayerDetails returns every layer with its display settings, in display order
+func (kl *KeyboardLayout) GetLayerDetails() []LayerDetails {
+	details := []LayerDetails{}
+	for _, name := range kl.GetLayerNames() {
+		details = append(details, LayerDetails{Name: name, LayerInfo: kl.GetLayerInfo(name)})
+	}
+	return details
+}
+
+// validateLayerInfo checks a layer's color and icon
+func validateLayerInfo(info LayerInfo) error {
+	if info.Color != "" && !isValidHexColor(info.Color) {
+		return fmt.Errorf("invalid layer color: %s", info.Color)
+	}
+	if info.Icon != "" && !isValidBase64Image(info.Icon) {
+		return fmt.Errorf("invalid layer icon: must be a base64 encoded image")
+	}
+	return nil
+}
+
+// RenameLayer renames a layer, along with its modifier combinations and the layer
+// recorded on each of its keys. The base layer can't be renamed.
+func (kl *KeyboardLayout) RenameLayer(oldName, newName string) error {
+	newName = strings.TrimSpace(newName)
+	switch {
+	case newName == "":
+		return fmt.Errorf("layer name cannot be empty")
+	case oldName == "base":
+		return fmt.Errorf("the base layer can't be renamed")
+	}
+	keys, exists := kl.Layers[oldName]
+	if !exists {
+		return fmt.Errorf("layer %s does not exist", oldName)
+	}
+	if _, exists := kl.Layers[newName]; exists {
+		return fmt.Errorf("layer %s already exists", newName)
+	}
+
+	order := kl.GetLayerNames()
+	for i, name := range order {
+		if name == oldName {
+			order[i] = newName
+		}
+	}
+
+	delete(kl.Layers, oldName)
+	kl.Layers[newName] = setKeysLayer(keys, newName)
+	if combos, exists := kl.ModifierMaps[oldName]; exists {
+		delete(kl.ModifierMaps, oldName)
+		for combo, comboKeys := range combos {
+			combos[combo] = setKeysLayer(comboKeys, newName)
+		}
+		kl.ModifierMaps[newName] = combos
+	}
+	if info, exists := kl.LayerInfo[oldName]; exists {
+		delete(kl.LayerInfo, oldName)
+		kl.LayerInfo[newName] = info
+	}
+	kl.renameLayerReferences(oldName, newName)
+	kl.LayerOrder = order
+	kl.ModifiedAt = time.Now()
+	return nil
+}
+
+// DuplicateLayer copies a layer and all its modifier combinations under a new name,
+// placed right after the original
+func (kl *KeyboardLayout) DuplicateLayer(layerName, newName string) error {
+	if _, exists := kl.Layers[layerName]; !exists {
+		return fmt.Errorf("layer %s does not exist", layerName)
+	}
+	order := kl.GetLayerNames()
+	if err := kl.CopyLayerFrom(kl, layerName, newName); err != nil {
+		return err
+	}
+
+	for i, name := range order {
+		if name == layerName {
+			order = append(order[:i+1], append([]string{strings.TrimSpace(newName)}, order[i+1:]...)...)
+			break
+		}
+	}
+	kl.LayerOrder = order
+	return nil
+}
+
+// CopyLayerFrom copies a layer, its modifier combinations and display settings from
+// another layout (or this one) under a new name, added after the other layers. Keys
+// that aren't on this layout's base layer are left out, since they have nowhere to be
+// drawn. The copy isn't protected, and shows the copied display name only if the
+// original had one.
+func (kl *KeyboardLayout) CopyLayerFrom(source *KeyboardLayout, layerName, newName string) error {
+	newName = strings.TrimSpace(newName)
+	if newName == "" {
+		return fmt.Errorf("layer name cannot be empty")
+	}
+	keys, exists := source.Layers[layerName]
+	if !exists {
+		return fmt.Errorf("layer %s does not exist", layerName)
+	}
+	if _, exists := kl.Layers[newName]; exists {
+		return fmt.Errorf("layer %s already exists", newName)
+	}
+
+	var baseIDs map[string]bool
+	if baseKeys, hasBase := kl.Layers["base"]; hasBase {
+		baseIDs = make(map[string]bool, len(baseKeys))
+		for _, key := range baseKeys {
+			baseIDs[key.ID] = true
+		}
+	}
+	copyKeys := func(keys []Key) []Key {
+		copied := []Key{}
+		for _, key := range keys {
+			if baseIDs == nil || baseIDs[key.ID] {
+				copied = append(copied, key.Clone())
+			}
+		}
+		return setKeysLayer(copied, newName)
+	}
+
+	copiedKeys := copyKeys(keys)
+	if len(keys) > 0 && len(copiedKeys) == 0 {
+		return fmt.Errorf("layer %s has no keys that fit this layout", layerName)
+	}
+	combos := make(map[string][]Key)
+	for combo, comboKeys := range source.ModifierMaps[layerName] {
+		combos[combo] = copyKeys(comboKeys)
+	}
+
+	order := kl.GetLayerNames()
+	if kl.Layers == nil {
+		kl.Layers = make(map[string][]Key)
+	}
+	if kl.ModifierMaps == nil {
+		kl.ModifierMaps = make(map[string]map[string][]Key)
+	}
+	kl.Layers[newName] = copiedKeys
+	kl.ModifierMaps[newName] = combos
+	if info, exists := source.LayerInfo[layerName]; exists {
+		info.Protected = false
+		if kl.LayerInfo == nil {
+			kl.LayerInfo = make(map[string]LayerInfo)
+		}
+		kl.LayerInfo[newName] = info
+	}
+	kl.LayerOrder = append(order, newName)
+	kl.ModifiedAt = time.Now()
+	return nil
+}
+
+// MoveLayer moves a layer to the given position in the display order
+func (kl *KeyboardLayout) MoveLayer(layerName string, index int) error {
+	order := kl.GetLayerNames()
+	from := -1
+	for i, name := range order {
+		if name == layerName {
+			from = i
+			break
+		}
+	}
+	if from < 0 {
+		return fmt.Errorf("layer %s does not exist", layerName)
+	}
+	if index < 0 || index >= len(order) {
+		return fmt.Errorf("position %d is out of range (0-%d)", index, len(order)-1)
+	}
+
+	order = append(order[:from], order[from+1:]...)
+	order = append(order[:index], append([]string{layerName}, order[index:]...)...)
+	kl.LayerOrder = order
+	kl.ModifiedAt = time.Now()
+	return nil
+}
+
+// setKeysLayer records the layer on each key and returns the keys
+func setKeysLayer(keys []Key, layerName string) []Key {
+	for i := range keys {
+		keys[i].Layer = layerName
+	}
+	return keys
+}
+
+// RenameLayer renames a layer in the current layout
+func (a *App) RenameLayer(oldName, newName string) error {
+	a.lock()
+	defer a.unlock()
+
+	activeProfile, currentLayout, err := a.activeLayout()
+	if err != nil {
+		return err
+	}
+	if err := a.checkLayerNotInherited(activeProfile, currentLayout, oldName); err != nil {
+		return err
+	}
+	if err := currentLayout.RenameLayer(oldName, newName); err != nil {
+		return err
+	}
+
+	if activeProfile.CurrentLayer == oldName {
+		activeProfile.CurrentLayer = strings.TrimSpace(newName)
+	}
+	activeProfile.ModifiedAt = time.Now()
+	a.notifyLayerChanged(activeProfile, "renamed")
+	a.requestSave(activeProfile.ID)
+	return nil
+}
+
+// DuplicateLayer copies a layer in the current layout, with all its modifier
+// combinations, under a new name
+func (a *App) DuplicateLayer(layerName, newName string) error {
+	a.lock()
+	defer a.unlock()
+
+	activeProfile, currentLayout, err := a.activeLayout()
+	if err != nil {
+		return err
+	}
+	if err := currentLayout.DuplicateLayer(layerName, newName); err != nil {
+		return err
+	}
+
+	activeProfile.ModifiedAt = time.Now()
+	a.notifyLayerChanged(activeProfile, "duplicated")
+	a.requestSave(activeProfile.ID)
+	return nil
+}
+
+// MoveLayer moves a layer of the current layout to a position in the layer order
+func (a *App) MoveLayer(layerName string, index int) error {
+	a.lock()
+	defer a.unlock()
+
+	activeProfile, currentLayout, err := a.activeLayout()
+	if err != nil {
+		return err
+	}
+	if err := currentLayout.MoveLayer(layerName, index); err != nil {
+		return err
+	}
+
+	activeProfile.ModifiedAt = time.Now()
+	a.notifyLayerChanged(activeProfile, "moved")
+	a.requestSave(activeProfile.ID)
+	return nil
+}
+
+// CopyLayerToLayout copies a layer of the current layout, with its modifier
+// combinations, to a layout in any profile. An empty targetProfileID means the active
+// profile; an empty newName keeps the layer's name.
+func (a *App) CopyLayerToLayout(layerName, targetProfileID, targetLayout, newName string) error {
+	a.lock()
+	defer a.unlock()
+
+	activeProfile, _, err := a.activeLayout()
+	if err != nil {
+		return err
+	}
+	activeID := activeProfile.ID
+	if targetProfileID == "" {
+		targetProfileID = activeID
+	}
+	if newName == "" {
+		newName = layerName
+	}
+
+	target := a.profileManager.GetProfile(targetProfileID)
+	if target == nil {
+		return fmt.Errorf("profile not found: %s", targetProfileID)
+	}
+	if err := a.ensureProfileLoaded(target); err != nil {
+		return err
+	}
+
+	// Loading may quarantine profiles, so look both up again
+	target = a.profileManager.GetProfile(targetProfileID)
+	activeProfile, sourceLayout, err := a.activeLayout()
+	if err != nil || target == nil || activeProfile.ID != activeID {
+		return fmt.Errorf("profile was removed while loading")
+	}
+	destination := findLayout(target.Layouts, targetLayout)
+	if destination == nil {
+		return fmt.Errorf("layout not found: %s", targetLayout)
+	}
+
+	// Copy out first, the destination may be the source layout
+	source := sourceLayout.Clone()
+	if err := destination.CopyLayerFrom(&source, layerName, newName); err != nil {
+		return err
+	}
+
+	target.ModifiedAt = time.Now()
+	a.notifyProfileChanged(target.ID, "layer-copied")
+	if target.ID == activeID && destination.Name == target.CurrentLayout {
+		a.notifyLayerChanged(target, "copied")
+	}
+	a.requestSave(target.ID)
+	return nil
+}
+
+// UpdateLayerInfo replaces the display settings of a layer in the current layout.
+// infoJSON is a LayerInfo; the base layer must stay protected.
+func (a *App) UpdateLayerInfo(layerName, infoJSON string) error {
+	var info LayerInfo
+	if err := json.Unmarshal([]byte(infoJSON), &info); err != nil {
+		return fmt.Errorf("invalid layer info: %v", err)
+	}
+
+	a.lock()
+	defer a.unlock()
+
+	activeProfile, currentLayout, err := a.activeLayout()
+	if err != nil {
+		return err
+	}
+	if err := currentLayout.SetLayerInfo(layerName, info); err != nil {
+		return err
+	}
+
+	activeProfile.ModifiedAt = time.Now()
+	a.notifyLayerChanged(activeProfile, "info")
+	a.requestSave(activeProfile.ID)
+	return nil
+}
+
+// activeLayout returns the active profile and its current layout.
+// The caller must hold the lock.
+func (a *App) activeLayout() (*Profile, *KeyboardLayout, error) {
+	activeProfile := a.profileManager.GetActiveProfile()
+	if activeProfile == nil {
+		return nil, nil, fmt.Errorf("no active profile available")
+	}
+	currentLayout := activeProfile.GetCurrentLayout()
+	if currentLayout == nil {
+		return nil, nil, fmt.Errorf("no current layout available in profile")
+	}
+	return activeProfile, currentLayout, nil
+}
+
+// checkLayerNotInherited rejects changes that would need a layer inherited from the
+// profile's parent to go away, which overrides can't express (see inherit.go).
+// The caller must hold the lock.
+func (a *App) checkLayerNotInherited(profile *Profile, layout *KeyboardLayout, layerName string) error {
+	if profile.Parent == "" {
+		return nil
+	}
+	parent := a.profileManager.GetProfile(profile.Parent)
+	if parent == nil {
+		return nil
+	}
+	if inherited := findLayout(parent.Layouts, layout.Name); inherited != nil {
+		if _, exists := inherited.Layers[layerName]; exists {
+			return fmt.Errorf("layer %s is inherited from %s", layerName, parent.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Layouts imported from JSON are validated before they touch a profile. Problems that
+// can be fixed safely (missing maps, stray modifier maps, bad colors) are repaired and
+// reported as warnings; anything else is an error and stops the import. A name clash
+// with an existing layout is settled by one of the layout import strategies below.
+
+// Layout import strategies
+const (
+	LayoutImportReplace = "replace" // Replace the existing layout with the same name
+	LayoutImportCopy    = "copy"    // Add the layout under a new name
+	LayoutImportMerge   = "merge"   // Merge layers and keys into the existing layout
+)
+
+// LayoutIssue is a problem found while validating a layout
+type LayoutIssue struct {
+	Severity string `json:"severity"` // "error" stops the import; "warning" was repaired
+	Path     string `json:"path"`     // Where the problem is, e.g. "layers.raise[3]"
+	Message  string `json:"message"`
+}
+
+// LayoutValidationError is returned when a layout has errors
+type LayoutValidationError struct {
+	Issues []LayoutIssue
+}
+
+func (e *LayoutValidationError) Error() string {
+	var messages []string
+	for _, issue := range e.Issues {
+		if issue.Severity == "error" {
+			messages = append(messages, fmt.Sprintf("%s: %s", issue.Path, issue.Message))
+		}
+	}
+	return fmt.Sprintf("invalid layout data: %s", strings.Join(messages, "; "))
+}
+
+// LayoutImportPreview describes what importing a layout does (or would do)
+type LayoutImportPreview struct {
+	Valid      bool            `json:"valid"`
+	Issues     []LayoutIssue   `json:"issues"`
+	LayoutName string          `json:"layoutName"` // Name in the imported data
+	TargetName string          `json:"targetName"` // Name the layout has in the profile afterwards
+	Strategy   string          `json:"strategy"`   // Strategy applied: "add", "replace", "copy" or "merge"
+	Conflict   bool            `json:"conflict"`   // The profile already has a layout with this name
+	Changes    []ProfileChange `json:"changes"`    // What changes in the profile
+}
+
+// PreviewLayoutImport validates layout JSON and describes what ImportLayoutWithStrategy
+// would change in the active profile, without changing anything
+func (a *App) PreviewLayoutImport(jsonData, strategy string) (string, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	activeProfile := a.profileManager.GetActiveProfile()
+	if activeProfile == nil {
+		return "", fmt.Errorf("no active profile available")
+	}
+
+	preview, _, err := planLayoutImport(activeProfile, jsonData, strategy)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.MarshalIndent(preview, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// ImportLayoutWithStrategy imports a layout into the active profile. strategy is
+// "replace", "copy" or "merge"; empty imports a copy if the name is taken. Returns
+// the applied preview, or a *LayoutValidationError if the layout has errors.
+func (a *App) ImportLayoutWithStrategy(jsonData, strategy string) (string, error) {
+	a.lock()
+	defer a.unlock()
+
+	preview, err := a.importLayout(jsonData, strategy)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.MarshalIndent(preview, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// importLayout validates and applies a layout import to the active profile.
+// The caller must hold the write lock.
+func (a *App) importLayout(jsonData, strategy string) (*LayoutImportPreview, error) {
+	activeProfile := a.profileManager.GetActiveProfile()
+	if activeProfile == nil {
+		return nil, fmt.Errorf("no active profile available")
+	}
+
+	preview, result, err := planLayoutImport(activeProfile, jsonData, strategy)
+	if err != nil {
+		return nil, err
+	}
+	if !preview.Valid {
+		return nil, &LayoutValidationError{Issues: preview.Issues}
+	}
+
+	activeProfile.Layouts = result.Layouts
+	activeProfile.CurrentLayout = result.CurrentLayout
+	activeProfile.CurrentLayer = result.CurrentLayer
+	activeProfile.ModifiedAt = time.Now()
+	a.notifyProfileChanged(activeProfile.ID, "layout-imported")
+	a.notifyLayerChanged(activeProfile, "layout")
+	a.requestSave(activeProfile.ID)
+
+	return preview, nil
+}
+
+// planLayoutImport parses and validates layout JSON and applies it to a copy of the
+// profile. The copy is returned with a preview of the differences; an invalid layout
+// gives a preview with Valid false and no copy.
+func planLayoutImport(profile *Profile, jsonData, strategy string) (*LayoutImportPreview, *Profile, error) {
+	switch strategy {
+	case "", LayoutImportReplace, LayoutImportCopy, LayoutImportMerge:
+	default:
+		return nil, nil, fmt.Errorf("invalid import strategy %q (must be 'replace', 'copy' or 'merge')", strategy)
+	}
+
+	layout, err := FromJSON(jsonData)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid layout data: %v", err)
+	}
+
+	preview := &LayoutImportPreview{
+		LayoutName: layout.Name,
+		Issues:     validateLayout(layout),
+		Changes:    []ProfileChange{},
+	}
+	preview.Valid = true
+	for _, issue := range preview.Issues {
+		if issue.Severity == "error" {
+			preview.Valid = false
+		}
+	}
+	if !preview.Valid {
+		return preview, nil, nil
+	}
+
+	result := profile.Clone()
+	existing := -1
+	for i := range result.Layouts {
+		if result.Layouts[i].Name == layout.Name {
+			existing = i
+			break
+		}
+	}
+	preview.Conflict = existing >= 0
+
+	if strategy == "" {
+		strategy = LayoutImportCopy
+	}
+	if existing < 0 {
+		// Nothing to replace or merge into
+		strategy = ""
+	}
+
+	now := time.Now()
+	layout.ModifiedAt = now
+	if layout.CreatedAt.IsZero() {
+		layout.CreatedAt = now
+	}
+
+	switch strategy {
+	case LayoutImportReplace:
+		result.Layouts[existing] = *layout
+	case LayoutImportMerge:
+		mergeLayout(&result.Layouts[existing], layout)
+	case LayoutImportCopy:
+		names := make(map[string]bool)
+		for _, l := range result.Layouts {
+			names[l.Name] = true
+		}
+		original := layout.Name
+		for n := 2; names[layout.Name]; n++ {
+			layout.Name = fmt.Sprintf("%s (%d)", original, n)
+		}
+		result.Layouts = append(result.Layouts, *layout)
+	default:
+		result.Layouts = append(result.Layouts, *layout)
+		strategy = "add"
+	}
+
+	// Switch to the imported layout, keeping the layer if it still exists
+	preview.Strategy = strategy
+	preview.TargetName = layout.Name
+	result.CurrentLayout = layout.Name
+	current := result.GetCurrentLayout()
+	if _, exists := current.Layers[result.CurrentLayer]; !exists {
+		result.CurrentLayer = "base"
+	}
+
+	if changes := diffProfiles(profile, &result); changes != nil {
+		preview.Changes = changes
+	}
+	return preview, &result, nil
+}
+
+// validateLayout checks a layout before import, repairing what it safely can.
+// Repaired problems are reported as warnings, the rest as errors.
+func validateLayout(layout *KeyboardLayout) []LayoutIssue {
+	issues := []LayoutIssue{}
+	report := func(severity, path, format string, args ...interface{}) {
+		issues = append(issues, LayoutIssue{Severity: severity, Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if strings.TrimSpace(layout.Name) == "" {
+		layout.Name = "Imported Layout"
+		report("warning", "name", "layout has no name, named it %q", layout.Name)
+	}
+
+	if len(layout.Layers) == 0 {
+		report("error", "layers", "layout has no layers")
+		return issues
+	}
+	baseKeys, hasBase := layout.Layers["base"]
+	if !hasBase {
+		report("error", "layers.base", "layout has no base layer")
+	}
+
+	// Every key in the layout must be one of the base layer's keys
+	baseIDs := make(map[string]bool, len(baseKeys))
+	for _, key := range baseKeys {
+		baseIDs[key.ID] = true
+	}
+
+	checkKeys := func(path, layerName string, keys []Key) {
+		seen := make(map[string]bool, len(keys))
+		for i := range keys {
+			key := &keys[i]
+			keyPath := fmt.Sprintf("%s[%d]", path, i)
+
+			switch {
+			case key.ID == "":
+				report("error", keyPath, "key has no ID")
+				continue
+			case seen[key.ID]:
+				report("error", keyPath, "duplicate key ID %s", key.ID)
+				continue
+			case hasBase && !baseIDs[key.ID]:
+				report("error", keyPath, "key %s is not on the base layer", key.ID)
+			}
+			seen[key.ID] = true
+
+			if key.Layer != layerName {
+				report("warning", keyPath, "key %s says it is on layer %q, moved to %q", key.ID, key.Layer, layerName)
+				key.Layer = layerName
+			}
+			if key.Color != "" && !isValidHexColor(key.Color) {
+				report("warning", keyPath, "key %s has invalid color %q, cleared it", key.ID, key.Color)
+				key.Color = ""
+			}
+			if key.ImageData != "" && !isValidBase64Image(key.ImageData) {
+				report("warning", keyPath, "key %s has invalid image data, removed it", key.ID)
+				key.ImageData = ""
+			}
+			if migrateOverlayLegends(key) {
+				report("warning", keyPath, "key %s kept overlay images in its description, moved them into legends", key.ID)
+			}
+			for _, slot := range legendSlotsOf(key.Legends) {
+				legend := key.Legends[slot]
+				switch {
+				case !isLegendSlot(slot):
+					report("warning", keyPath, "key %s has a legend in unknown slot %q, removed it", key.ID, slot)
+					delete(key.Legends, slot)
+					continue
+				case legend.Color != "" && !isValidHexColor(legend.Color):
+					report("warning", keyPath, "key %s has invalid color %q for legend %s, cleared it", key.ID, legend.Color, slot)
+					legend.Color = ""
+				}
+				if legend.ImageData != "" && !isValidBase64Image(legend.ImageData) {
+					report("warning", keyPath, "key %s has invalid image data for legend %s, removed it", key.ID, slot)
+					legend.ImageData = ""
+				}
+				setLegend(key, slot, legend)
+			}
+		}
+	}
+
+	layerNames := layout.GetLayerNames()
+	sort.Strings(layerNames)
+	for _, layerName := range layerNames {
+		if strings.TrimSpace(layerName) == "" {
+			report("error", "layers", "layer with an empty name")
+			continue
+		}
+		checkKeys("layers."+layerName, layerName, layout.Layers[layerName])
+	}
+
+	if layout.ModifierMaps == nil {
+		layout.ModifierMaps = make(map[string]map[string][]Key)
+		report("warning", "modifierMaps", "layout has no modifier maps, created empty ones")
+	}
+	for _, layerName := range unionKeys(layout.ModifierMaps, nil) {
+		if _, hasLayer := layout.Layers[layerName]; !hasLayer {
+			delete(layout.ModifierMaps, layerName)
+			report("warning", "modifierMaps."+layerName, "modifier map for unknown layer %q, removed it", layerName)
+			continue
+		}
+		combos := layout.ModifierMaps[layerName]
+		for _, combo := range unionKeys(combos, nil) {
+			checkKeys(fmt.Sprintf("modifierMaps.%s.%s", layerName, combo), layerName, combos[combo])
+		}
+	}
+	for _, layerName := range layerNames {
+		if layout.ModifierMaps[layerName] == nil {
+			layout.ModifierMaps[layerName] = make(map[string][]Key)
+		}
+	}
+
+	for _, layerName := range unionKeys(layout.LayerInfo, nil) {
+		path := "layerInfo." + layerName
+		info := layout.LayerInfo[layerName]
+		if _, hasLayer := layout.Layers[layerName]; !hasLayer {
+			delete(layout.LayerInfo, layerName)
+			report("warning", path, "settings for unknown layer %q, removed them", layerName)
+			continue
+		}
+		if info.Color != "" && !isValidHexColor(info.Color) {
+			report("warning", path, "layer %s has invalid color %q, cleared it", layerName, info.Color)
+			info.Color = ""
+		}
+		if info.Icon != "" && !isValidBase64Image(info.Icon) {
+			report("warning", path, "layer %s has invalid icon data, removed it", layerName)
+			info.Icon = ""
+		}
+		layout.LayerInfo[layerName] = info
+	}
+
+	// Broken key references still import; they show as broken until fixed
+	for _, broken := range brokenReferences(layout) {
+		path := "layers." + broken.Layer
+		if broken.Modifiers != "" {
+			path = fmt.Sprintf("modifierMaps.%s.%s", broken.Layer, broken.Modifiers)
+		}
+		report("warning", path, "key %s refers to [[%s]]: %s", broken.KeyID, broken.Reference.Ref, broken.Reference.Error)
+	}
+
+	return issues
+}
+
+// mergeLayout merges an imported layout into an existing one: new layers and modifier
+// combinations are added, and keys with matching IDs are replaced by the imported ones
+func mergeLayout(existing, imported *KeyboardLayout) {
+	if imported.Description != "" {
+		existing.Description = imported.Description
+	}
+	if existing.ModifierMaps == nil {
+		existing.ModifierMaps = make(map[string]map[string][]Key)
+	}
+
+	for layerName, keys := range imported.Layers {
+		existing.Layers[layerName] = mergeKeys(existing.Layers[layerName], keys)
+	}
+	for layerName, info := range imported.LayerInfo {
+		if existing.LayerInfo == nil {
+			existing.LayerInfo = make(map[string]LayerInfo)
+		}
+		existing.LayerInfo[layerName] = info
+	}
+	for layerName, combos := range imported.ModifierMaps {
+		if existing.ModifierMaps[layerName] == nil {
+			existing.ModifierMaps[layerName] = make(map[string][]Key)
+		}
+		for combo, keys := range combos {
+			existing.ModifierMaps[layerName][combo] = mergeKeys(existing.ModifierMaps[layerName][combo], keys)
+		}
+	}
+
+	// The imported order wins; layers only the existing layout has follow in their order
+	if len(imported.LayerOrder) > 0 {
+		existing.LayerOrder = append(cloneStrings(imported.LayerOrder), existing.GetLayerNames()...)
+		existing.LayerOrder = existing.GetLayerNames()
+	}
+
+	existing.ModifiedAt = time.Now()
+}
+
+// mergeKeys replaces keys with matching IDs and appends the rest
+func mergeKeys(existing, imported []Key) []Key {
+	merged := cloneKeys(existing)
+	index := make(map[string]int, len(merged))
+	for i, key := range merged {
+		index[key.ID] = i
+	}
+	for _, key := range imported {
+		if i, exists := index[key.ID]; exists {
+			merged[i] = key.Clone()
+		} else {
+			index[key.ID] = len(merged)
+			merged = append(merged, key.Clone())
+		}
+	}
+	return merged
+}
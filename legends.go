@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Besides its label, a key can show legends in named slots on the keycap, like the
+// shifted symbol in the top left corner or a layer legend on the front. Each slot
+// has its own text, color and image.
+
+// legendSlots are the slots a legend can be put in, in drawing order
+var legendSlots = []string{
+	"topLeft", "top", "topRight",
+	"left", "center", "right",
+	"bottomLeft", "bottom", "bottomRight",
+	"front",
+}
+
+// Legend is what a key shows in one legend slot
+type Legend struct {
+	Text      string `json:"text,omitempty"`
+	Color     string `json:"color,omitempty"`     // Text color; empty uses the key's
+	ImageData string `json:"imageData,omitempty"` // Base64 encoded image data
+	ImagePath string `json:"imagePath,omitempty"` // Image reference, used in profile files and bundles
+}
+
+// isEmpty reports whether the legend shows nothing
+func (l Legend) isEmpty() bool {
+	return l.Text == "" && l.ImageData == "" && l.ImagePath == ""
+}
+
+// isLegendSlot reports whether slot is one of the legend slots
+func isLegendSlot(slot string) bool {
+	for _, name := range legendSlots {
+		if name == slot {
+			return true
+		}
+	}
+	return false
+}
+
+// validateLegend checks a legend's slot, color and image
+func validateLegend(slot string, legend Legend) error {
+	if !isLegendSlot(slot) {
+		return fmt.Errorf("unknown legend slot %q (expected one of %s)", slot, strings.Join(legendSlots, ", "))
+	}
+	if legend.Color != "" && !isValidHexColor(legend.Color) {
+		return fmt.Errorf("invalid color for legend %s: %s", slot, legend.Color)
+	}
+	if legend.ImageData != "" && !isValidBase64Image(legend.ImageData) {
+		return fmt.Errorf("invalid image data for legend %s", slot)
+	}
+	return nil
+}
+
+// cloneLegends returns a copy of a key's legends, preserving nil
+func cloneLegends(legends map[string]Legend) map[string]Legend {
+	if legends == nil {
+		return nil
+	}
+	cloned := make(map[string]Legend, len(legends))
+	for slot, legend := range legends {
+		cloned[slot] = legend
+	}
+	return cloned
+}
+
+// setLegend puts a legend in a slot of a key; an empty legend clears the slot
+func setLegend(key *Key, slot string, legend Legend) {
+	if legend.isEmpty() {
+		delete(key.Legends, slot)
+		if len(key.Legends) == 0 {
+			key.Legends = nil
+		}
+		return
+	}
+	if key.Legends == nil {
+		key.Legends = make(map[string]Legend)
+	}
+	key.Legends[slot] = legend
+}
+
+// legendSlotsOf returns the slots used in any of the given legends, in drawing
+// order, followed by any unknown slots alphabetically
+func legendSlotsOf(legends ...map[string]Legend) []string {
+	used := make(map[string]bool)
+	for _, set := range legends {
+		for slot := range set {
+			used[slot] = true
+		}
+	}
+	var slots, unknown []string
+	for _, slot := range legendSlots {
+		if used[slot] {
+			slots = append(slots, slot)
+		}
+	}
+	for slot := range used {
+		if !isLegendSlot(slot) {
+			unknown = append(unknown, slot)
+		}
+	}
+	sort.Strings(unknown)
+	return append(slots, unknown...)
+}
+
+// legacyOverlays is how the key editor used to store a key's description together
+// with its secondary (top right) and tertiary (bottom right) images
+type legacyOverlays struct {
+	UserDescription    *string `json:"userDescription"`
+	SecondaryImageData *string `json:"secondaryImageData"`
+	TertiaryImageData  *string `json:"tertiaryImageData"`
+}
+
+// migrateOverlayLegends moves the overlay images of a description in the old JSON
+// format into the key's legends and makes the description plain text again. It
+// reports whether any images were moved.
+func migrateOverlayLegends(key *Key) bool {
+	description := strings.TrimSpace(key.Description)
+	if !strings.HasPrefix(description, "{") {
+		return false
+	}
+	decoder := json.NewDecoder(strings.NewReader(description))
+	decoder.DisallowUnknownFields()
+	var overlays legacyOverlays
+	if err := decoder.Decode(&overlays); err != nil {
+		return false
+	}
+
+	moved := false
+	for slot, image := range map[string]*string{"topRight": overlays.SecondaryImageData, "bottomRight": overlays.TertiaryImageData} {
+		if image == nil || *image == "" || key.Legends[slot].ImageData != "" {
+			continue
+		}
+		legend := key.Legends[slot]
+		legend.ImageData = *image
+		setLegend(key, slot, legend)
+		moved = true
+	}
+	key.Description = ""
+	if overlays.UserDescription != nil {
+		key.Description = *overlays.UserDescription
+	}
+	return moved
+}
+
+// migrateProfileLegends converts the descriptions a profile's keys hold in the old
+// JSON format, including its stored overrides, and reports whether any key changed
+func migrateProfileLegends(profile *Profile) bool {
+	changed := false
+	migrate := func(key *Key) {
+		description := key.Description
+		if migrateOverlayLegends(key) || key.Description != description {
+			changed = true
+		}
+	}
+	for i := range profile.Layouts {
+		eachLayoutKey(&profile.Layouts[i], migrate)
+	}
+	for i := range profile.overrides {
+		eachLayoutKey(&profile.overrides[i], migrate)
+	}
+	return changed
+}
+
+// GetLegendSlots returns the names of the legend slots, in drawing order
+func (a *App) GetLegendSlots() []string {
+	return cloneStrings(legendSlots)
+}
+
+// SetKeyLegend sets the legend in one slot of a key on the current layer, in the
+// active modifier combination. Text, color and image are given as legend JSON; an
+// empty legend clears the slot.
+func (a *App) SetKeyLegend(keyID, slot, legendJSON string) error {
+	var legend Legend
+	if strings.TrimSpace(legendJSON) != "" {
+		if err := json.Unmarshal([]byte(legendJSON), &legend); err != nil {
+			return fmt.Errorf("invalid legend data: %v", err)
+		}
+	}
+	if err := validateLegend(slot, legend); err != nil {
+		return err
+	}
+
+	return a.editCurrentLayer(func(layout *KeyboardLayout, layer, combo string) error {
+		key := findKey(layout.keysFor(layer, combo, true), keyID)
+		if key == nil {
+			return fmt.Errorf("key %s not found", keyID)
+		}
+		setLegend(key, slot, legend)
+		return nil
+	})
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"html"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Key descriptions are written in a small subset of Markdown: paragraphs (a single
+// newline is a line break), headings, "-" and "1." lists, "> " quotes, ``` code
+// blocks, **strong**, *emphasis*, `code`, [links](https://...) and <https://...>,
+// plus key references like [[raise/ctrl:R04]] (see keyrefs.go). Everything else is
+// text: raw HTML is escaped, and links only go to http, https and mailto URLs.
+// A description renders to HTML for the UI and to plain text for exports.
+
+// markdownRenderer renders Markdown to HTML and plain text side by side
+type markdownRenderer struct {
+	html, text strings.Builder
+	// reference renders a key reference (the text between [[ and ]])
+	reference func(ref string) (htmlOut, textOut string)
+}
+
+// renderMarkdown renders Markdown to sanitized HTML and plain text. refs renders
+// key references; without it they are left as written.
+func renderMarkdown(source string, refs func(ref string) (string, string)) (string, string) {
+	r := &markdownRenderer{reference: refs}
+	r.blocks(strings.Split(strings.ReplaceAll(source, "\r\n", "\n"), "\n"))
+	return r.html.String(), strings.TrimSpace(r.text.String())
+}
+
+// listItem returns the text of a list item line and whether the list is ordered
+func listItem(line string) (string, bool, bool) {
+	trimmed := strings.TrimLeft(line, " ")
+	if len(trimmed) >= 2 && strings.IndexByte("-*+", trimmed[0]) >= 0 && trimmed[1] == ' ' {
+		return strings.TrimSpace(trimmed[2:]), false, true
+	}
+	digits := 0
+	for digits < len(trimmed) && digits < 9 && trimmed[digits] >= '0' && trimmed[digits] <= '9' {
+		digits++
+	}
+	if digits > 0 && len(trimmed) > digits+1 && (trimmed[digits] == '.' || trimmed[digits] == ')') && trimmed[digits+1] == ' ' {
+		return strings.TrimSpace(trimmed[digits+2:]), true, true
+	}
+	return "", false, false
+}
+
+// heading returns the level and text of a heading line
+func heading(line string) (int, string, bool) {
+	level := 0
+	for level < len(line) && line[level] == '#' {
+		level++
+	}
+	if level == 0 || level > 6 || (len(line) > level && line[level] != ' ') {
+		return 0, "", false
+	}
+	return level, strings.TrimSpace(strings.TrimRight(strings.TrimSpace(line[level:]), "#")), true
+}
+
+// separate starts a new block in the plain text
+func (r *markdownRenderer) separate() {
+	if r.text.Len() > 0 {
+		r.text.WriteString("\n\n")
+	}
+}
+
+// blocks renders lines of block-level Markdown
+func (r *markdownRenderer) blocks(lines []string) {
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case trimmed == "":
+			i++
+
+		case strings.HasPrefix(trimmed, "```"):
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				code = append(code, lines[i])
+			}
+			i++ // closing fence
+			r.separate()
+			r.html.WriteString("<pre><code>" + html.EscapeString(strings.Join(code, "\n")) + "</code></pre>")
+			r.text.WriteString(strings.Join(code, "\n"))
+
+		case strings.HasPrefix(trimmed, ">"):
+			var quoted []string
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), ">"); i++ {
+				quoted = append(quoted, strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(lines[i]), ">"), " "))
+			}
+			inner := &markdownRenderer{reference: r.reference}
+			inner.blocks(quoted)
+			r.separate()
+			r.html.WriteString("<blockquote>" + inner.html.String() + "</blockquote>")
+			r.text.WriteString(strings.TrimSpace(inner.text.String()))
+
+		default:
+			if level, text, ok := heading(trimmed); ok {
+				i++
+				htmlOut, textOut := r.inline(text)
+				tag := "h" + strconv.Itoa(level)
+				r.separate()
+				r.html.WriteString("<" + tag + ">" + htmlOut + "</" + tag + ">")
+				r.text.WriteString(textOut)
+				continue
+			}
+			if _, ordered, ok := listItem(line); ok {
+				tag := "ul"
+				if ordered {
+					tag = "ol"
+				}
+				r.separate()
+				r.html.WriteString("<" + tag + ">")
+				for n := 1; i < len(lines); i++ {
+					text, itemOrdered, isItem := listItem(lines[i])
+					if !isItem || itemOrdered != ordered {
+						break
+					}
+					htmlOut, textOut := r.inline(text)
+					r.html.WriteString("<li>" + htmlOut + "</li>")
+					if n > 1 {
+						r.text.WriteString("\n")
+					}
+					if ordered {
+						r.text.WriteString(strconv.Itoa(n) + ". " + textOut)
+					} else {
+						r.text.WriteString("- " + textOut)
+					}
+					n++
+				}
+				r.html.WriteString("</" + tag + ">")
+				continue
+			}
+
+			// A paragraph runs until a blank line or another kind of block
+			var paragraph []string
+			for ; i < len(lines); i++ {
+				next := strings.TrimSpace(lines[i])
+				_, _, isHeading := heading(next)
+				_, _, isItem := listItem(lines[i])
+				if next == "" || isHeading || (isItem && len(paragraph) > 0) || strings.HasPrefix(next, "```") || strings.HasPrefix(next, ">") {
+					break
+				}
+				paragraph = append(paragraph, next)
+			}
+			htmlOut, textOut := r.inline(strings.Join(paragraph, "\n"))
+			r.separate()
+			r.html.WriteString("<p>" + strings.ReplaceAll(htmlOut, "\n", "<br>") + "</p>")
+			r.text.WriteString(textOut)
+		}
+	}
+}
+
+// safeURL returns a link target if it is an absolute http, https or mailto URL
+func safeURL(target string) (string, bool) {
+	parsed, err := url.Parse(strings.TrimSpace(target))
+	if err != nil {
+		return "", false
+	}
+	switch strings.ToLower(parsed.Scheme) {
+	case "http", "https":
+		if parsed.Host == "" {
+			return "", false
+		}
+	case "mailto":
+	default:
+		return "", false
+	}
+	return parsed.String(), true
+}
+
+// link renders a link, or nothing if the target isn't safe
+func link(target, htmlText, plainText string) (string, string, bool) {
+	href, ok := safeURL(target)
+	if !ok {
+		return "", "", false
+	}
+	htmlOut := `<a href="` + html.EscapeString(href) + `" target="_blank" rel="noopener noreferrer">` + htmlText + `</a>`
+	if plainText == href || "mailto:"+plainText == href {
+		return htmlOut, plainText, true
+	}
+	return htmlOut, plainText + " (" + href + ")", true
+}
+
+// isPunctuation reports whether a backslash can escape c
+func isPunctuation(c byte) bool {
+	return strings.IndexByte("\\`*_{}[]()#+-.!<>|~", c) >= 0
+}
+
+// inline renders inline Markdown
+func (r *markdownRenderer) inline(source string) (string, string) {
+	var htmlOut, textOut strings.Builder
+	literal := func(s string) {
+		htmlOut.WriteString(html.EscapeString(s))
+		textOut.WriteString(s)
+	}
+
+	for i := 0; i < len(source); {
+		rest := source[i:]
+		switch {
+		case rest[0] == '\\' && len(rest) > 1 && isPunctuation(rest[1]):
+			literal(rest[1:2])
+			i += 2
+			continue
+
+		case rest[0] == '`':
+			if end := strings.IndexByte(rest[1:], '`'); end >= 0 {
+				code := rest[1 : end+1]
+				htmlOut.WriteString("<code>" + html.EscapeString(code) + "</code>")
+				textOut.WriteString(code)
+				i += end + 2
+				continue
+			}
+
+		case strings.HasPrefix(rest, "[["):
+			if end := strings.Index(rest, "]]"); end > 2 && !strings.ContainsAny(rest[2:end], "[\n") {
+				ref := rest[2:end]
+				if r.reference != nil {
+					refHTML, refText := r.reference(ref)
+					htmlOut.WriteString(refHTML)
+					textOut.WriteString(refText)
+				} else {
+					literal(rest[:end+2])
+				}
+				i += end + 2
+				continue
+			}
+
+		case rest[0] == '[':
+			// [text](url), with the text not spanning other brackets
+			if close := strings.Index(rest, "]("); close > 0 && !strings.ContainsAny(rest[1:close], "[]") {
+				if end := strings.IndexByte(rest[close+2:], ')'); end >= 0 {
+					innerHTML, innerText := r.inline(rest[1:close])
+					if linkHTML, linkText, ok := link(rest[close+2:close+2+end], innerHTML, innerText); ok {
+						htmlOut.WriteString(linkHTML)
+						textOut.WriteString(linkText)
+						i += close + 3 + end
+						continue
+					}
+				}
+			}
+
+		case rest[0] == '<':
+			if end := strings.IndexByte(rest, '>'); end > 0 && !strings.ContainsAny(rest[1:end], " <\n") {
+				target := rest[1:end]
+				if linkHTML, linkText, ok := link(target, html.EscapeString(target), target); ok {
+					htmlOut.WriteString(linkHTML)
+					textOut.WriteString(linkText)
+					i += end + 1
+					continue
+				}
+			}
+
+		case strings.HasPrefix(rest, "**") || strings.HasPrefix(rest, "__"):
+			marker := rest[:2]
+			if end := strings.Index(rest[2:], marker); end > 0 && rest[2] != ' ' && rest[1+end] != ' ' {
+				innerHTML, innerText := r.inline(rest[2 : 2+end])
+				htmlOut.WriteString("<strong>" + innerHTML + "</strong>")
+				textOut.WriteString(innerText)
+				i += end + 4
+				continue
+			}
+
+		case rest[0] == '*' || rest[0] == '_':
+			marker := rest[0]
+			// Underscores inside words (snake_case) aren't emphasis
+			wordBefore := i > 0 && isWordByte(source[i-1])
+			if end := emphasisEnd(rest, marker); end > 1 && rest[1] != ' ' && rest[end-1] != ' ' &&
+				!(marker == '_' && (wordBefore || (end+1 < len(rest) && isWordByte(rest[end+1])))) {
+				innerHTML, innerText := r.inline(rest[1:end])
+				htmlOut.WriteString("<em>" + innerHTML + "</em>")
+				textOut.WriteString(innerText)
+				i += end + 1
+				continue
+			}
+		}
+
+		literal(rest[:1])
+		i++
+	}
+	return htmlOut.String(), textOut.String()
+}
+
+// emphasisEnd returns the index of the marker closing emphasis opened at rest[0], or
+// -1. Doubled markers are skipped: they belong to strong text inside the emphasis.
+func emphasisEnd(rest string, marker byte) int {
+	for i := 1; i < len(rest); i++ {
+		if rest[i] != marker {
+			continue
+		}
+		if i+1 < len(rest) && rest[i+1] == marker {
+			i++
+			continue
+		}
+		return i
+	}
+	return -1
+}
+
+// isWordByte reports whether c is an ASCII letter or digit
+func isWordByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
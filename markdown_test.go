@@ -0,0 +1,153 @@
+package main
+
+import "testing"
+
+func TestRenderMarkdown(t *testing.T) {
+	refs := func(ref string) (string, string) {
+		return "<kbd>" + ref + "</kbd>", "[" + ref + "]"
+	}
+
+	tests := []struct {
+		name     string
+		source   string
+		wantHTML string
+		wantText string
+	}{
+		{
+			name:     "script tag",
+			source:   "<script>alert(1)</script>",
+			wantHTML: "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>",
+			wantText: "<script>alert(1)</script>",
+		},
+		{
+			name:     "inline html",
+			source:   `<img src=x onerror="alert(1)">`,
+			wantHTML: "<p>&lt;img src=x onerror=&#34;alert(1)&#34;&gt;</p>",
+			wantText: `<img src=x onerror="alert(1)">`,
+		},
+		{
+			name:     "javascript link",
+			source:   "[x](javascript:alert(1))",
+			wantHTML: "<p>[x](javascript:alert(1))</p>",
+			wantText: "[x](javascript:alert(1))",
+		},
+		{
+			name:     "javascript link in capitals",
+			source:   "[x](JavaScript:alert(1))",
+			wantHTML: "<p>[x](JavaScript:alert(1))</p>",
+			wantText: "[x](JavaScript:alert(1))",
+		},
+		{
+			name:     "javascript autolink",
+			source:   "<javascript:alert(1)>",
+			wantHTML: "<p>&lt;javascript:alert(1)&gt;</p>",
+			wantText: "<javascript:alert(1)>",
+		},
+		{
+			name:     "attribute breakout in link",
+			source:   `[x](https://a.example/"onmouseover="alert)`,
+			wantHTML: `<p><a href="https://a.example/%22onmouseover=%22alert" target="_blank" rel="noopener noreferrer">x</a></p>`,
+			wantText: "x (https://a.example/%22onmouseover=%22alert)",
+		},
+		{
+			name:     "attribute breakout in autolink",
+			source:   `<https://a.example/"x>`,
+			wantHTML: `<p><a href="https://a.example/%22x" target="_blank" rel="noopener noreferrer">https://a.example/&#34;x</a></p>`,
+			wantText: `https://a.example/"x (https://a.example/%22x)`,
+		},
+		{
+			name:     "markup in link query",
+			source:   "[x](https://a.example/?q=<b>&r=1)",
+			wantHTML: `<p><a href="https://a.example/?q=&lt;b&gt;&amp;r=1" target="_blank" rel="noopener noreferrer">x</a></p>`,
+			wantText: "x (https://a.example/?q=<b>&r=1)",
+		},
+		{
+			name:     "mailto link",
+			source:   "[me](mailto:me@example.com)",
+			wantHTML: `<p><a href="mailto:me@example.com" target="_blank" rel="noopener noreferrer">me</a></p>`,
+			wantText: "me (mailto:me@example.com)",
+		},
+		{
+			name:     "key reference",
+			source:   "Same as [[raise/ctrl:R04]]",
+			wantHTML: "<p>Same as <kbd>raise/ctrl:R04</kbd></p>",
+			wantText: "Same as [raise/ctrl:R04]",
+		},
+		{
+			name:     "escaped key reference",
+			source:   `\[[raise:R04]]`,
+			wantHTML: "<p>[[raise:R04]]</p>",
+			wantText: "[[raise:R04]]",
+		},
+		{
+			name:     "key reference in code",
+			source:   "`[[raise:R04]]`",
+			wantHTML: "<p><code>[[raise:R04]]</code></p>",
+			wantText: "[[raise:R04]]",
+		},
+		{
+			name:     "emphasis inside strong",
+			source:   "**bold *both* bold**",
+			wantHTML: "<p><strong>bold <em>both</em> bold</strong></p>",
+			wantText: "bold both bold",
+		},
+		{
+			name:     "strong inside emphasis",
+			source:   "*em **both** em*",
+			wantHTML: "<p><em>em <strong>both</strong> em</em></p>",
+			wantText: "em both em",
+		},
+		{
+			name:     "snake case",
+			source:   "run some_long_name",
+			wantHTML: "<p>run some_long_name</p>",
+			wantText: "run some_long_name",
+		},
+		{
+			name:     "lists",
+			source:   "- one\n- **two**\n\n1. a\n2. b",
+			wantHTML: "<ul><li>one</li><li><strong>two</strong></li></ul><ol><li>a</li><li>b</li></ol>",
+			wantText: "- one\n- two\n\n1. a\n2. b",
+		},
+		{
+			name:     "quote",
+			source:   "> quote *em*\n> more",
+			wantHTML: "<blockquote><p>quote <em>em</em><br>more</p></blockquote>",
+			wantText: "quote em\nmore",
+		},
+		{
+			name:     "code fence",
+			source:   "```\n<b>*x*</b> [[raise:R04]]\n```",
+			wantHTML: "<pre><code>&lt;b&gt;*x*&lt;/b&gt; [[raise:R04]]</code></pre>",
+			wantText: "<b>*x*</b> [[raise:R04]]",
+		},
+		{
+			name:     "heading and paragraphs",
+			source:   "# Head *em*\na\nb\n\nc",
+			wantHTML: "<h1>Head <em>em</em></h1><p>a<br>b</p><p>c</p>",
+			wantText: "Head em\n\na\nb\n\nc",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			gotHTML, gotText := renderMarkdown(test.source, refs)
+			if gotHTML != test.wantHTML {
+				t.Errorf("html = %q, want %q", gotHTML, test.wantHTML)
+			}
+			if gotText != test.wantText {
+				t.Errorf("text = %q, want %q", gotText, test.wantText)
+			}
+		})
+	}
+}
+
+func TestRenderMarkdownWithoutReferences(t *testing.T) {
+	gotHTML, gotText := renderMarkdown("See [[raise:<b>]]", nil)
+	if want := "<p>See [[raise:&lt;b&gt;]]</p>"; gotHTML != want {
+		t.Errorf("html = %q, want %q", gotHTML, want)
+	}
+	if want := "See [[raise:<b>]]"; gotText != want {
+		t.Errorf("text = %q, want %q", gotText, want)
+	}
+}
@@ -0,0 +1,752 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Three-way merges combine two versions of a profile that were edited separately,
+// using a common ancestor to tell who changed what. Profiles are merged structurally:
+// layouts, layers, modifier combinations and keys are matched by name or ID, and a
+// key's fields merge independently except for its image and its position, which each
+// merge as a whole. A change made differently on both sides is a conflict; until it is
+// resolved the merged profile keeps our version.
+
+// MergeConflict is something both sides of a merge changed differently
+type MergeConflict struct {
+	ID         string      `json:"id"`
+	Scope      string      `json:"scope"`                // "profile", "layout", "layer", "combo" or "key"
+	Layout     string      `json:"layout,omitempty"`     // Layout the conflict is in
+	Layer      string      `json:"layer,omitempty"`      // Layer the conflict is in
+	Modifiers  string      `json:"modifiers,omitempty"`  // Modifier combination, e.g. "ctrl+shift"
+	KeyID      string      `json:"keyId,omitempty"`      // Key the conflict is in
+	Fields     []string    `json:"fields,omitempty"`     // JSON names of the conflicting fields, if not the whole item
+	Base       interface{} `json:"base"`                 // Common version; null if it didn't exist
+	Ours       interface{} `json:"ours"`                 // Our version; null if we removed it
+	Theirs     interface{} `json:"theirs"`               // Their version; null if they removed it
+	Resolution string      `json:"resolution,omitempty"` // "ours", "theirs" or "base" once resolved
+}
+
+// ProfileMerge is a merge of another profile into one of ours, waiting for its
+// conflicts to be resolved
+type ProfileMerge struct {
+	ID         string          `json:"id"`
+	ProfileID  string          `json:"profileId"` // Profile the merge is applied to
+	BaseID     string          `json:"baseId"`    // Common ancestor; empty if there is none
+	TheirsID   string          `json:"theirsId"`  // Profile merged in
+	Changes    []ProfileChange `json:"changes"`   // What applying the merge changes in our profile
+	Conflicts  []MergeConflict `json:"conflicts"`
+	Unresolved int             `json:"unresolved"` // Conflicts still without a resolution
+	StartedAt  time.Time       `json:"startedAt"`
+
+	base, ours, theirs *Profile
+	resolutions        map[string]string // Conflict ID -> resolution
+	merged             *Profile
+}
+
+// merger collects conflicts while merging and applies resolutions given for them
+type merger struct {
+	resolutions map[string]string
+	conflicts   []MergeConflict
+}
+
+// MergeProfiles starts merging theirsID into profileID, using baseID as the common
+// ancestor (empty if they have none, which makes every difference a conflict).
+// Changes without conflicts are merged right away; resolve the conflicts with
+// ResolveMergeConflict and finish with ApplyProfileMerge.
+func (a *App) MergeProfiles(baseID, profileID, theirsID string) (string, error) {
+	a.lock()
+	defer a.unlock()
+
+	profileIDs := []string{profileID, theirsID}
+	if baseID != "" {
+		profileIDs = append(profileIDs, baseID)
+	}
+	for _, id := range profileIDs {
+		profile := a.profileManager.GetProfile(id)
+		if profile == nil {
+			return "", fmt.Errorf("profile not found: %s", id)
+		}
+		if err := a.ensureProfileLoaded(profile); err != nil {
+			return "", err
+		}
+	}
+
+	// Loading may quarantine profiles, so take the snapshots once all are loaded
+	snapshot := func(id string) (*Profile, error) {
+		profile := a.profileManager.GetProfile(id)
+		if profile == nil {
+			return nil, fmt.Errorf("profile not found: %s", id)
+		}
+		cloned := profile.Clone()
+		return &cloned, nil
+	}
+	merge := &ProfileMerge{
+		ID:          fmt.Sprintf("merge_%d", time.Now().UnixNano()),
+		ProfileID:   profileID,
+		BaseID:      baseID,
+		TheirsID:    theirsID,
+		StartedAt:   time.Now(),
+		resolutions: make(map[string]string),
+	}
+	var err error
+	if merge.ours, err = snapshot(profileID); err != nil {
+		return "", err
+	}
+	if merge.theirs, err = snapshot(theirsID); err != nil {
+		return "", err
+	}
+	if baseID != "" {
+		if merge.base, err = snapshot(baseID); err != nil {
+			return "", err
+		}
+	} else {
+		merge.base = &Profile{}
+	}
+
+	// Profiles here have distinct names, so the merged profile keeps ours
+	merge.base.Name, merge.theirs.Name = merge.ours.Name, merge.ours.Name
+
+	merge.update()
+	a.profileMerges[merge.ID] = merge
+	return merge.ToJSON()
+}
+
+// GetProfileMerge returns a merge started with MergeProfiles
+func (a *App) GetProfileMerge(mergeID string) (string, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	merge, exists := a.profileMerges[mergeID]
+	if !exists {
+		return "", fmt.Errorf("merge not found: %s", mergeID)
+	}
+	return merge.ToJSON()
+}
+
+// ResolveMergeConflict settles a conflict by taking "ours", "theirs" or "base", or
+// clears the resolution with an empty string. Returns the updated merge.
+func (a *App) ResolveMergeConflict(mergeID, conflictID, resolution string) (string, error) {
+	switch resolution {
+	case "", "ours", "theirs", "base":
+	default:
+		return "", fmt.Errorf("invalid resolution %q (must be 'ours', 'theirs' or 'base')", resolution)
+	}
+
+	a.lock()
+	defer a.unlock()
+
+	merge, exists := a.profileMerges[mergeID]
+	if !exists {
+		return "", fmt.Errorf("merge not found: %s", mergeID)
+	}
+	found := false
+	for _, conflict := range merge.Conflicts {
+		if conflict.ID == conflictID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return "", fmt.Errorf("conflict not found: %s", conflictID)
+	}
+
+	if resolution == "" {
+		delete(merge.resolutions, conflictID)
+	} else {
+		merge.resolutions[conflictID] = resolution
+	}
+	merge.update()
+	return merge.ToJSON()
+}
+
+// ApplyProfileMerge writes the merged profile once every conflict is resolved. The
+// merge is refused if the profile's layouts, palette or settings were edited after the
+// merge started; switching layouts, layers or modifiers doesn't count.
+func (a *App) ApplyProfileMerge(mergeID string) error {
+	a.lock()
+	defer a.unlock()
+
+	merge, exists := a.profileMerges[mergeID]
+	if !exists {
+		return fmt.Errorf("merge not found: %s", mergeID)
+	}
+	if merge.Unresolved > 0 {
+		return fmt.Errorf("%d conflict(s) still need resolving", merge.Unresolved)
+	}
+
+	profile := a.profileManager.GetProfile(merge.ProfileID)
+	if profile == nil {
+		return fmt.Errorf("profile not found: %s", merge.ProfileID)
+	}
+	if err := a.ensureProfileLoaded(profile); err != nil {
+		return err
+	}
+	profile = a.profileManager.GetProfile(merge.ProfileID)
+	if profile == nil || !sameProfileContent(profile, merge.ours) {
+		return fmt.Errorf("profile changed since the merge started; start the merge again")
+	}
+
+	// The profile keeps its identity, inheritance and view state
+	merged := merge.merged.Clone()
+	merged.ID = profile.ID
+	merged.Parent = profile.Parent
+	merged.overrides = profile.overrides
+	merged.CreatedAt = profile.CreatedAt
+	merged.CurrentLayout = profile.CurrentLayout
+	merged.CurrentLayer = profile.CurrentLayer
+	merged.ActiveModifiers = cloneStrings(profile.ActiveModifiers)
+	merged.ModifiedAt = time.Now()
+	repairProfile(&merged)
+	*profile = merged
+
+	delete(a.profileMerges, mergeID)
+	a.notifyProfileChanged(profile.ID, "merged")
+	a.notifyLayerChanged(profile, "layout")
+	a.requestSave(profile.ID)
+	return nil
+}
+
+// CancelProfileMerge discards a merge without changing the profile
+func (a *App) CancelProfileMerge(mergeID string) error {
+	a.lock()
+	defer a.unlock()
+
+	if _, exists := a.profileMerges[mergeID]; !exists {
+		return fmt.Errorf("merge not found: %s", mergeID)
+	}
+	delete(a.profileMerges, mergeID)
+	return nil
+}
+
+// update merges again with the current resolutions
+func (m *ProfileMerge) update() {
+	m.merged, m.Conflicts = mergeProfiles(m.base, m.ours, m.theirs, m.resolutions)
+	m.Unresolved = 0
+	for _, conflict := range m.Conflicts {
+		if conflict.Resolution == "" {
+			m.Unresolved++
+		}
+	}
+
+	m.Changes = []ProfileChange{}
+	for _, change := range diffProfiles(m.ours, m.merged) {
+		if change.Scope != "state" {
+			m.Changes = append(m.Changes, change)
+		}
+	}
+}
+
+// ToJSON converts the merge to JSON
+func (m *ProfileMerge) ToJSON() (string, error) {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// mergeProfiles merges two versions of a profile against their common ancestor. It
+// returns the merged profile, which has our ID and view state, and every conflict with
+// the resolution applied to it, if any. Unresolved conflicts keep our version.
+func mergeProfiles(base, ours, theirs *Profile, resolutions map[string]string) (*Profile, []MergeConflict) {
+	m := &merger{resolutions: resolutions}
+	merged := ours.Clone()
+
+	property := func(field string, base, ours, theirs interface{}, set func(interface{})) {
+		conflict := MergeConflict{Scope: "profile", Fields: []string{field}}
+		if value, ok := m.mergeValue(conflict, base, ours, theirs); ok {
+			set(value)
+		}
+	}
+	property("name", base.Name, ours.Name, theirs.Name, func(v interface{}) { merged.Name = v.(string) })
+	property("icon", base.Icon, ours.Icon, theirs.Icon, func(v interface{}) { merged.Icon = v.(string) })
+	property("backgroundColor", base.BackgroundColor, ours.BackgroundColor, theirs.BackgroundColor, func(v interface{}) { merged.BackgroundColor = v.(string) })
+	property("description", base.Description, ours.Description, theirs.Description, func(v interface{}) { merged.Description = v.(string) })
+
+	for _, name := range unionKeys(ours.ColorSchemes, theirs.ColorSchemes) {
+		name := name
+		property("colorSchemes."+name, base.ColorSchemes[name], ours.ColorSchemes[name], theirs.ColorSchemes[name], func(v interface{}) {
+			if merged.ColorSchemes == nil {
+				merged.ColorSchemes = make(map[string]string)
+			}
+			if v.(string) == "" {
+				delete(merged.ColorSchemes, name)
+			} else {
+				merged.ColorSchemes[name] = v.(string)
+			}
+		})
+	}
+	property("colorByCategory", base.ColorByCategory, ours.ColorByCategory, theirs.ColorByCategory, func(v interface{}) { merged.ColorByCategory = v.(bool) })
+	property("savedFilters", base.SavedFilters, ours.SavedFilters, theirs.SavedFilters, func(v interface{}) {
+		merged.SavedFilters = cloneSavedFilters(v.([]SavedFilter))
+	})
+
+	merged.Palette = m.mergePalette(base.Palette, ours.Palette, theirs.Palette)
+
+	// Layouts keep our order, followed by the ones only they have
+	var names []string
+	seen := make(map[string]bool)
+	for _, layouts := range [][]KeyboardLayout{ours.Layouts, theirs.Layouts} {
+		for _, layout := range layouts {
+			if !seen[layout.Name] {
+				seen[layout.Name] = true
+				names = append(names, layout.Name)
+			}
+		}
+	}
+
+	merged.Layouts = []KeyboardLayout{}
+	for _, name := range names {
+		baseLayout := findLayout(base.Layouts, name)
+		ourLayout := findLayout(ours.Layouts, name)
+		theirLayout := findLayout(theirs.Layouts, name)
+
+		if ourLayout == nil || theirLayout == nil {
+			conflict := MergeConflict{Scope: "layout", Layout: name}
+			kept := pickVersion(m, conflict, baseLayout, ourLayout, theirLayout, func(a, b *KeyboardLayout) bool {
+				return len(diffLayouts(a, b)) == 0
+			})
+			if kept != nil {
+				merged.Layouts = append(merged.Layouts, kept.Clone())
+			}
+			continue
+		}
+
+		if baseLayout == nil {
+			baseLayout = &KeyboardLayout{Name: name}
+		}
+		merged.Layouts = append(merged.Layouts, m.merge3Layout(baseLayout, ourLayout, theirLayout))
+	}
+
+	return &merged, m.conflicts
+}
+
+// mergePalette merges two versions of a profile's palette item by item. Items keep
+// our order, followed by the ones only they have.
+func (m *merger) mergePalette(base, ours, theirs []PaletteItem) []PaletteItem {
+	find := func(items []PaletteItem, itemID string) *PaletteItem {
+		if index, err := findPaletteItem(items, itemID); err == nil {
+			return &items[index]
+		}
+		return nil
+	}
+
+	var merged []PaletteItem
+	seen := make(map[string]bool)
+	for _, items := range [][]PaletteItem{ours, theirs} {
+		for _, item := range items {
+			if seen[item.ID] {
+				continue
+			}
+			seen[item.ID] = true
+
+			baseItem, ourItem, theirItem := find(base, item.ID), find(ours, item.ID), find(theirs, item.ID)
+			conflict := MergeConflict{Scope: "profile", Fields: []string{"palette." + item.ID}}
+			if ourItem == nil || theirItem == nil {
+				kept := pickVersion(m, conflict, baseItem, ourItem, theirItem, func(a, b *PaletteItem) bool {
+					return reflect.DeepEqual(*a, *b)
+				})
+				if kept != nil {
+					merged = append(merged, kept.Clone())
+				}
+				continue
+			}
+
+			var baseValue interface{}
+			if baseItem != nil {
+				baseValue = *baseItem
+			}
+			value, _ := m.mergeValue(conflict, baseValue, *ourItem, *theirItem)
+			if value == nil {
+				// The base version was picked for an item the base doesn't have
+				continue
+			}
+			merged = append(merged, value.(PaletteItem).Clone())
+		}
+	}
+	return merged
+}
+
+// merge3Layout merges two versions of a layout that both sides have
+func (m *merger) merge3Layout(base, ours, theirs *KeyboardLayout) KeyboardLayout {
+	merged := KeyboardLayout{
+		Name:         ours.Name,
+		Description:  ours.Description,
+		Layers:       make(map[string][]Key),
+		ModifierMaps: make(map[string]map[string][]Key),
+		CreatedAt:    ours.CreatedAt,
+		ModifiedAt:   ours.ModifiedAt,
+	}
+	if theirs.ModifiedAt.After(merged.ModifiedAt) {
+		merged.ModifiedAt = theirs.ModifiedAt
+	}
+
+	conflict := MergeConflict{Scope: "layout", Layout: ours.Name, Fields: []string{"description"}}
+	if value, ok := m.mergeValue(conflict, base.Description, ours.Description, theirs.Description); ok {
+		merged.Description = value.(string)
+	}
+
+	// A layer and its modifier combinations are added or removed together
+	for _, layerName := range unionKeys(ours.Layers, theirs.Layers) {
+		baseLayer := layerVersion(base, layerName)
+		ourLayer := layerVersion(ours, layerName)
+		theirLayer := layerVersion(theirs, layerName)
+
+		if ourLayer == nil || theirLayer == nil {
+			conflict := MergeConflict{Scope: "layer", Layout: ours.Name, Layer: layerName}
+			kept := pickVersion(m, conflict, baseLayer, ourLayer, theirLayer, func(a, b *KeyboardLayout) bool {
+				return len(diffLayouts(a, b)) == 0
+			})
+			if kept != nil {
+				merged.Layers[layerName] = cloneKeys(kept.Layers[layerName])
+				if combos := kept.Clone().ModifierMaps[layerName]; combos != nil {
+					merged.ModifierMaps[layerName] = combos
+				}
+				if info, exists := kept.LayerInfo[layerName]; exists {
+					setMergedLayerInfo(&merged, layerName, info)
+				}
+			}
+			continue
+		}
+		if baseLayer == nil {
+			baseLayer = &KeyboardLayout{}
+		}
+
+		_, ourInfo := ourLayer.LayerInfo[layerName]
+		_, theirInfo := theirLayer.LayerInfo[layerName]
+		if ourInfo || theirInfo {
+			conflict := MergeConflict{Scope: "layer", Layout: ours.Name, Layer: layerName, Fields: []string{"layerInfo"}}
+			value, _ := m.mergeValue(conflict, baseLayer.LayerInfo[layerName], ourLayer.LayerInfo[layerName], theirLayer.LayerInfo[layerName])
+			setMergedLayerInfo(&merged, layerName, value.(LayerInfo))
+		}
+
+		location := MergeConflict{Layout: ours.Name, Layer: layerName}
+		merged.Layers[layerName] = m.merge3Keys(location, baseLayer.Layers[layerName], ourLayer.Layers[layerName], theirLayer.Layers[layerName])
+
+		baseCombos := baseLayer.ModifierMaps[layerName]
+		ourCombos, theirCombos := ourLayer.ModifierMaps[layerName], theirLayer.ModifierMaps[layerName]
+		if ourCombos == nil && theirCombos == nil {
+			continue
+		}
+		mergedCombos := make(map[string][]Key)
+		for _, combo := range unionKeys(ourCombos, theirCombos) {
+			baseKeys, inBase := baseCombos[combo]
+			ourKeys, inOurs := ourCombos[combo]
+			theirKeys, inTheirs := theirCombos[combo]
+
+			if !inOurs || !inTheirs {
+				conflict := MergeConflict{Scope: "combo", Layout: ours.Name, Layer: layerName, Modifiers: combo}
+				kept := pickVersion(m, conflict, keysOrNil(baseKeys, inBase), keysOrNil(ourKeys, inOurs), keysOrNil(theirKeys, inTheirs), func(a, b *[]Key) bool {
+					return len(diffKeys(*a, *b, "", "", "")) == 0
+				})
+				if kept != nil {
+					mergedCombos[combo] = cloneKeys(*kept)
+				}
+				continue
+			}
+
+			location := MergeConflict{Layout: ours.Name, Layer: layerName, Modifiers: combo}
+			mergedCombos[combo] = m.merge3Keys(location, baseKeys, ourKeys, theirKeys)
+		}
+		merged.ModifierMaps[layerName] = mergedCombos
+	}
+
+	// Whoever reordered the layers wins, ours if both did; layers only one side has
+	// follow in that side's order
+	first, second := ours, theirs
+	if sameLayerOrder(base, ours) && !sameLayerOrder(base, theirs) {
+		first, second = theirs, ours
+	}
+	merged.LayerOrder = append(first.GetLayerNames(), second.GetLayerNames()...)
+	merged.LayerOrder = merged.GetLayerNames()
+
+	return merged
+}
+
+// merge3Keys merges two versions of a list of keys. Keys keep our order, followed by
+// the ones only they have.
+func (m *merger) merge3Keys(location MergeConflict, base, ours, theirs []Key) []Key {
+	index := func(keys []Key) map[string]*Key {
+		byID := make(map[string]*Key, len(keys))
+		for i := range keys {
+			byID[keys[i].ID] = &keys[i]
+		}
+		return byID
+	}
+	baseByID, ourByID, theirByID := index(base), index(ours), index(theirs)
+
+	var ids []string
+	seen := make(map[string]bool)
+	for _, keys := range [][]Key{ours, theirs} {
+		for _, key := range keys {
+			if !seen[key.ID] {
+				seen[key.ID] = true
+				ids = append(ids, key.ID)
+			}
+		}
+	}
+
+	merged := []Key{}
+	for _, id := range ids {
+		conflict := location
+		conflict.Scope = "key"
+		conflict.KeyID = id
+		baseKey, ourKey, theirKey := baseByID[id], ourByID[id], theirByID[id]
+
+		if ourKey == nil || theirKey == nil {
+			kept := pickVersion(m, conflict, baseKey, ourKey, theirKey, func(a, b *Key) bool {
+				return len(changedKeyFields(*a, *b)) == 0
+			})
+			if kept != nil {
+				merged = append(merged, kept.Clone())
+			}
+			continue
+		}
+
+		if baseKey == nil {
+			baseKey = &Key{ID: id}
+		}
+		merged = append(merged, m.mergeKey(conflict, *baseKey, *ourKey, *theirKey))
+	}
+	return merged
+}
+
+// mergeKey merges two versions of a key field by field. The image and the position
+// each merge as a whole, since their fields only make sense together.
+func (m *merger) mergeKey(conflict MergeConflict, base, ours, theirs Key) Key {
+	merged := ours.Clone()
+
+	ourFields := changedKeyFields(base, ours)
+	theirFields := changedKeyFields(base, theirs)
+	ourChanged := make(map[string]bool)
+	for _, field := range ourFields {
+		ourChanged[keyFieldGroup(field)] = true
+	}
+
+	var takeTheirs, conflicting []string
+	sidesDiffer := make(map[string]bool)
+	for _, field := range changedKeyFields(ours, theirs) {
+		sidesDiffer[keyFieldGroup(field)] = true
+	}
+	handled := make(map[string]bool)
+	for _, field := range theirFields {
+		group := keyFieldGroup(field)
+		if handled[group] || !sidesDiffer[group] {
+			continue
+		}
+		handled[group] = true
+		if ourChanged[group] {
+			conflicting = append(conflicting, keyGroupFields(group)...)
+		} else {
+			takeTheirs = append(takeTheirs, keyGroupFields(group)...)
+		}
+	}
+	copyKeyFields(&merged, theirs, takeTheirs)
+
+	if len(conflicting) > 0 {
+		sort.Strings(conflicting)
+		conflict.Fields = conflicting
+		conflict.Base, conflict.Ours, conflict.Theirs = base, ours, theirs
+		switch m.record(conflict) {
+		case "theirs":
+			copyKeyFields(&merged, theirs, conflicting)
+		case "base":
+			copyKeyFields(&merged, base, conflicting)
+		}
+	}
+
+	return merged
+}
+
+// mergeValue merges a single value. ok is false when our value stays.
+func (m *merger) mergeValue(conflict MergeConflict, base, ours, theirs interface{}) (interface{}, bool) {
+	switch {
+	case reflect.DeepEqual(ours, theirs), reflect.DeepEqual(theirs, base):
+		return ours, false
+	case reflect.DeepEqual(ours, base):
+		return theirs, true
+	}
+
+	conflict.Base, conflict.Ours, conflict.Theirs = base, ours, theirs
+	switch m.record(conflict) {
+	case "theirs":
+		return theirs, true
+	case "base":
+		return base, true
+	}
+	return ours, false
+}
+
+// pickVersion settles an item at least one side doesn't have: one side adding it or
+// removing it unchanged wins, and removing it while the other side changed it is a
+// conflict
+func pickVersion[T any](m *merger, conflict MergeConflict, base, ours, theirs *T, equal func(a, b *T) bool) *T {
+	switch {
+	case ours == nil && theirs == nil:
+		return nil
+	case base == nil && ours == nil:
+		return theirs
+	case base == nil && theirs == nil:
+		return ours
+	case ours == nil && equal(base, theirs):
+		return nil
+	case theirs == nil && equal(base, ours):
+		return nil
+	}
+
+	// Nil pointers must become untyped nils to show up as null
+	for _, side := range []struct {
+		value *T
+		field *interface{}
+	}{{base, &conflict.Base}, {ours, &conflict.Ours}, {theirs, &conflict.Theirs}} {
+		if side.value != nil {
+			*side.field = *side.value
+		}
+	}
+
+	switch m.record(conflict) {
+	case "theirs":
+		return theirs
+	case "base":
+		return base
+	}
+	return ours
+}
+
+// record adds a conflict and returns the resolution given for it, if any
+func (m *merger) record(conflict MergeConflict) string {
+	parts := []string{conflict.Scope}
+	for _, part := range []string{conflict.Layout, conflict.Layer, conflict.Modifiers, conflict.KeyID} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	conflict.ID = strings.Join(parts, "/")
+	if conflict.Scope != "key" && len(conflict.Fields) > 0 {
+		conflict.ID += "#" + strings.Join(conflict.Fields, ",")
+	}
+
+	conflict.Resolution = m.resolutions[conflict.ID]
+	m.conflicts = append(m.conflicts, conflict)
+	return conflict.Resolution
+}
+
+// sameProfileContent reports whether two versions of a profile hold the same layouts,
+// palette and settings. View state and modification times are left out, as they change
+// without the content changing.
+func sameProfileContent(a, b *Profile) bool {
+	content := func(profile *Profile) []byte {
+		cloned := profile.Clone()
+		cloned.CurrentLayout, cloned.CurrentLayer, cloned.ActiveModifiers = "", "", nil
+		cloned.ModifiedAt = time.Time{}
+		for i := range cloned.Layouts {
+			cloned.Layouts[i].ModifiedAt = time.Time{}
+		}
+		data, err := json.Marshal(cloned)
+		if err != nil {
+			return nil
+		}
+		return data
+	}
+	contentA, contentB := content(a), content(b)
+	return contentA != nil && string(contentA) == string(contentB)
+}
+
+// sameLayerOrder reports whether the layers two layouts both have are in the same order
+func sameLayerOrder(a, b *KeyboardLayout) bool {
+	var orderA, orderB []string
+	for _, name := range a.GetLayerNames() {
+		if _, exists := b.Layers[name]; exists {
+			orderA = append(orderA, name)
+		}
+	}
+	for _, name := range b.GetLayerNames() {
+		if _, exists := a.Layers[name]; exists {
+			orderB = append(orderB, name)
+		}
+	}
+	return reflect.DeepEqual(orderA, orderB)
+}
+
+// layerVersion returns a layout holding just one layer and its modifier
+// combinations, or nil if the layout doesn't have the layer
+func layerVersion(layout *KeyboardLayout, layerName string) *KeyboardLayout {
+	keys, exists := layout.Layers[layerName]
+	if !exists {
+		return nil
+	}
+	version := &KeyboardLayout{
+		Layers:       map[string][]Key{layerName: keys},
+		ModifierMaps: make(map[string]map[string][]Key),
+	}
+	if combos, exists := layout.ModifierMaps[layerName]; exists {
+		version.ModifierMaps[layerName] = combos
+	}
+	if info, exists := layout.LayerInfo[layerName]; exists {
+		version.LayerInfo = map[string]LayerInfo{layerName: info}
+	}
+	return version
+}
+
+// setMergedLayerInfo stores a layer's settings on a merged layout
+func setMergedLayerInfo(layout *KeyboardLayout, layerName string, info LayerInfo) {
+	if layout.LayerInfo == nil {
+		layout.LayerInfo = make(map[string]LayerInfo)
+	}
+	layout.LayerInfo[layerName] = info
+}
+
+// keysOrNil returns a pointer to keys if they exist, for pickVersion
+func keysOrNil(keys []Key, exists bool) *[]Key {
+	if !exists {
+		return nil
+	}
+	return &keys
+}
+
+// keyFieldGroup returns the group a key field merges with
+func keyFieldGroup(field string) string {
+	switch {
+	case field == "imageData" || field == "imagePath":
+		return "image"
+	case positionFields[field]:
+		return "position"
+	case field == "categoryColor":
+		return "color"
+	}
+	return field
+}
+
+// keyGroupFields returns the fields of a key field group
+func keyGroupFields(group string) []string {
+	switch group {
+	case "image":
+		return []string{"imageData", "imagePath"}
+	case "position":
+		return []string{"customX", "customY", "isCustomPosition"}
+	case "color":
+		return []string{"color", "categoryColor"}
+	}
+	return []string{group}
+}
+
+// copyKeyFields copies the fields with the given JSON names from one key to another
+func copyKeyFields(dst *Key, src Key, fields []string) {
+	wanted := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		wanted[field] = true
+	}
+
+	dstValue, srcValue := reflect.ValueOf(dst).Elem(), reflect.ValueOf(src.Clone())
+	keyType := dstValue.Type()
+	for i := 0; i < keyType.NumField(); i++ {
+		if wanted[strings.Split(keyType.Field(i).Tag.Get("json"), ",")[0]] {
+			dstValue.Field(i).Set(srcValue.Field(i))
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// mergeTestKey returns the key with the given ID on a layer of a profile's first
+// layout, or on one of the layer's modifier combinations
+func mergeTestKey(profile *Profile, layer, combo, keyID string) *Key {
+	layout := &profile.Layouts[0]
+	if combo == "" {
+		return findKey(layout.Layers[layer], keyID)
+	}
+	return findKey(layout.ModifierMaps[layer][combo], keyID)
+}
+
+func TestMergeProfiles(t *testing.T) {
+	setLabel := func(label string) func(*Profile) {
+		return func(profile *Profile) { mergeTestKey(profile, "base", "", "L00").Label = label }
+	}
+	addCombo := func(profile *Profile) {
+		profile.Layouts[0].ModifierMaps["base"]["ctrl"] = blankComboKeys(profile.Layouts[0].Layers["base"], "ctrl")
+		mergeTestKey(profile, "base", "ctrl", "L00").Label = "Copy"
+	}
+	removeCombo := func(profile *Profile) { delete(profile.Layouts[0].ModifierMaps["base"], "ctrl") }
+	setImage := func(image string) func(*Profile) {
+		return func(profile *Profile) { mergeTestKey(profile, "base", "", "L00").ImageData = image }
+	}
+
+	tests := []struct {
+		name          string
+		base          func(*Profile) // Applied to the common ancestor before the sides diverge
+		ours, theirs  func(*Profile)
+		resolutions   map[string]string
+		wantConflicts []string
+		check         func(t *testing.T, merged *Profile)
+	}{
+		{
+			name:   "key changed by them",
+			theirs: setLabel("Esc"),
+			check: func(t *testing.T, merged *Profile) {
+				if got := mergeTestKey(merged, "base", "", "L00").Label; got != "Esc" {
+					t.Errorf("L00 = %q, want Esc", got)
+				}
+			},
+		},
+		{
+			name: "key changed by us",
+			ours: setLabel("Esc"),
+			check: func(t *testing.T, merged *Profile) {
+				if got := mergeTestKey(merged, "base", "", "L00").Label; got != "Esc" {
+					t.Errorf("L00 = %q, want Esc", got)
+				}
+			},
+		},
+		{
+			name:   "same change on both sides",
+			ours:   setLabel("Esc"),
+			theirs: setLabel("Esc"),
+			check: func(t *testing.T, merged *Profile) {
+				if got := mergeTestKey(merged, "base", "", "L00").Label; got != "Esc" {
+					t.Errorf("L00 = %q, want Esc", got)
+				}
+			},
+		},
+		{
+			name:          "conflict keeps ours",
+			ours:          setLabel("Esc"),
+			theirs:        setLabel("Tab"),
+			wantConflicts: []string{"key/Corne/base/L00"},
+			check: func(t *testing.T, merged *Profile) {
+				if got := mergeTestKey(merged, "base", "", "L00").Label; got != "Esc" {
+					t.Errorf("L00 = %q, want Esc", got)
+				}
+			},
+		},
+		{
+			name:          "conflict resolved with theirs",
+			ours:          setLabel("Esc"),
+			theirs:        setLabel("Tab"),
+			resolutions:   map[string]string{"key/Corne/base/L00": "theirs"},
+			wantConflicts: []string{"key/Corne/base/L00"},
+			check: func(t *testing.T, merged *Profile) {
+				if got := mergeTestKey(merged, "base", "", "L00").Label; got != "Tab" {
+					t.Errorf("L00 = %q, want Tab", got)
+				}
+			},
+		},
+		{
+			name:   "different keys changed",
+			ours:   setLabel("Esc"),
+			theirs: func(profile *Profile) { mergeTestKey(profile, "base", "", "L01").Label = "Q" },
+			check: func(t *testing.T, merged *Profile) {
+				if got := mergeTestKey(merged, "base", "", "L00").Label; got != "Esc" {
+					t.Errorf("L00 = %q, want Esc", got)
+				}
+				if got := mergeTestKey(merged, "base", "", "L01").Label; got != "Q" {
+					t.Errorf("L01 = %q, want Q", got)
+				}
+			},
+		},
+		{
+			name:   "combo added by them",
+			theirs: addCombo,
+			check: func(t *testing.T, merged *Profile) {
+				if key := mergeTestKey(merged, "base", "ctrl", "L00"); key == nil || key.Label != "Copy" {
+					t.Errorf("ctrl L00 = %+v, want label Copy", key)
+				}
+			},
+		},
+		{
+			name:   "combo removed by them",
+			base:   addCombo,
+			theirs: removeCombo,
+			check: func(t *testing.T, merged *Profile) {
+				if _, exists := merged.Layouts[0].ModifierMaps["base"]["ctrl"]; exists {
+					t.Error("combo removed by them is still there")
+				}
+			},
+		},
+		{
+			name:          "combo removed by them and changed by us",
+			base:          addCombo,
+			ours:          func(profile *Profile) { mergeTestKey(profile, "base", "ctrl", "L00").Label = "Cut" },
+			theirs:        removeCombo,
+			wantConflicts: []string{"combo/Corne/base/ctrl"},
+			check: func(t *testing.T, merged *Profile) {
+				if key := mergeTestKey(merged, "base", "ctrl", "L00"); key == nil || key.Label != "Cut" {
+					t.Errorf("ctrl L00 = %+v, want label Cut", key)
+				}
+			},
+		},
+		{
+			name:   "image changed by them",
+			ours:   setLabel("Esc"),
+			theirs: setImage(testImage),
+			check: func(t *testing.T, merged *Profile) {
+				key := mergeTestKey(merged, "base", "", "L00")
+				if key.Label != "Esc" || key.ImageData != testImage {
+					t.Errorf("L00 = label %q, image %q; want our label and their image", key.Label, key.ImageData)
+				}
+			},
+		},
+		{
+			name:          "image changed on both sides",
+			ours:          setImage(testImage),
+			theirs:        setImage("data:image/png;base64,AAAA"),
+			wantConflicts: []string{"key/Corne/base/L00"},
+			check: func(t *testing.T, merged *Profile) {
+				if got := mergeTestKey(merged, "base", "", "L00").ImageData; got != testImage {
+					t.Errorf("L00 image = %q, want ours", got)
+				}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			base := NewProfile("Merge")
+			if test.base != nil {
+				test.base(&base)
+			}
+			ours, theirs := base.Clone(), base.Clone()
+			for _, side := range []struct {
+				edit    func(*Profile)
+				profile *Profile
+			}{{test.ours, &ours}, {test.theirs, &theirs}} {
+				if side.edit != nil {
+					side.edit(side.profile)
+				}
+			}
+
+			merged, conflicts := mergeProfiles(&base, &ours, &theirs, test.resolutions)
+			var conflictIDs []string
+			for _, conflict := range conflicts {
+				conflictIDs = append(conflictIDs, conflict.ID)
+			}
+			if !reflect.DeepEqual(conflictIDs, test.wantConflicts) {
+				t.Errorf("conflicts = %v, want %v", conflictIDs, test.wantConflicts)
+			}
+			test.check(t, merged)
+		})
+	}
+}
+
+// startTestMerge creates a copy of the active profile that diverges from it, edits both
+// with ours and theirs, and starts merging the copy back using a snapshot of the
+// profile before the edits as the common ancestor. Returns the merge.
+func startTestMerge(t *testing.T, app *App, ours, theirs string) ProfileMerge {
+	t.Helper()
+	profileID := testProfileID(app)
+	duplicate := func(name string) string {
+		data, err := app.DuplicateProfile(profileID, name)
+		if err != nil {
+			t.Fatalf("DuplicateProfile: %v", err)
+		}
+		var profile Profile
+		if err := json.Unmarshal([]byte(data), &profile); err != nil {
+			t.Fatal(err)
+		}
+		return profile.ID
+	}
+	baseID, theirsID := duplicate("Base"), duplicate("Theirs")
+
+	setTestLabel(t, app, "L00", ours)
+	if err := app.SetActiveProfile(theirsID); err != nil {
+		t.Fatalf("SetActiveProfile: %v", err)
+	}
+	setTestLabel(t, app, "L00", theirs)
+	if err := app.SetActiveProfile(profileID); err != nil {
+		t.Fatalf("SetActiveProfile: %v", err)
+	}
+
+	data, err := app.MergeProfiles(baseID, profileID, theirsID)
+	if err != nil {
+		t.Fatalf("MergeProfiles: %v", err)
+	}
+	var merge ProfileMerge
+	if err := json.Unmarshal([]byte(data), &merge); err != nil {
+		t.Fatal(err)
+	}
+	return merge
+}
+
+func TestResolveThenApplyMerge(t *testing.T) {
+	app := NewApp(t.TempDir())
+	t.Cleanup(func() { app.shutdown(nil) })
+
+	merge := startTestMerge(t, app, "Esc", "Tab")
+	if merge.Unresolved != 1 {
+		t.Fatalf("unresolved = %d, want 1", merge.Unresolved)
+	}
+	if err := app.ApplyProfileMerge(merge.ID); err == nil {
+		t.Fatal("merge with an unresolved conflict applied")
+	}
+
+	data, err := app.ResolveMergeConflict(merge.ID, merge.Conflicts[0].ID, "theirs")
+	if err != nil {
+		t.Fatalf("ResolveMergeConflict: %v", err)
+	}
+	if err := json.Unmarshal([]byte(data), &merge); err != nil {
+		t.Fatal(err)
+	}
+	if merge.Unresolved != 0 || len(merge.Changes) == 0 {
+		t.Fatalf("unresolved = %d with %d change(s), want none unresolved and changes", merge.Unresolved, len(merge.Changes))
+	}
+
+	// Switching layers isn't an edit, so it doesn't make the merge stale
+	if err := app.SetCurrentLayer("lower"); err != nil {
+		t.Fatalf("SetCurrentLayer: %v", err)
+	}
+	if err := app.SetCurrentLayer("base"); err != nil {
+		t.Fatalf("SetCurrentLayer: %v", err)
+	}
+	if err := app.ApplyProfileMerge(merge.ID); err != nil {
+		t.Fatalf("ApplyProfileMerge: %v", err)
+	}
+	if got := testKey(t, app, "L00").Label; got != "Tab" {
+		t.Errorf("L00 = %q, want Tab", got)
+	}
+}
+
+func TestMergeRefusedAfterEdit(t *testing.T) {
+	app := NewApp(t.TempDir())
+	t.Cleanup(func() { app.shutdown(nil) })
+
+	merge := startTestMerge(t, app, "Esc", "Esc")
+	setTestLabel(t, app, "L01", "Q")
+	if err := app.ApplyProfileMerge(merge.ID); err == nil {
+		t.Fatal("merge applied over an edit made after it started")
+	}
+}
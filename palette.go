@@ -0,0 +1,480 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The key palette is a library of key designs to apply to keys. The shared palette is
+// stored in the profile index and available in every profile; each profile can also
+// keep its own palette, which is stored in its file and travels with its bundle.
+// Bound methods take a profile ID to pick the palette, "" for the shared one.
+
+// PaletteItem is a key design in a palette
+type PaletteItem struct {
+	ID          string   `json:"id"`
+	Label       string   `json:"label"`
+	ImageData   string   `json:"imageData"` // Base64 encoded image
+	Color       string   `json:"color"`
+	Description string   `json:"description"`
+	KeyType     string   `json:"keyType"`
+	Tags        []string `json:"tags"`
+	Favorite    bool     `json:"favorite"`
+	UsageCount  int      `json:"usageCount"`
+
+	// Where the design was taken from
+	SourceLayer          string   `json:"sourceLayer"`
+	SourceModifiers      []string `json:"sourceModifiers"`
+	SourceKeyboardType   string   `json:"sourceKeyboardType"`
+	SourceLayerKeysCount int      `json:"sourceLayerKeysCount"`
+
+	Timestamp  int64     `json:"timestamp"` // When the design was added, in Unix milliseconds
+	ModifiedAt time.Time `json:"modifiedAt"`
+}
+
+// PaletteSearch filters a palette. Empty fields don't filter.
+type PaletteSearch struct {
+	ProfileID     string   `json:"profileId"`     // Palette to search; "" for the shared one
+	Query         string   `json:"query"`         // Matched against label, description and tags, ignoring case
+	Tags          []string `json:"tags"`          // Items must have all of these tags
+	FavoritesOnly bool     `json:"favoritesOnly"` // Only favorites
+	IncludeShared bool     `json:"includeShared"` // Also search the shared palette when searching a profile's
+}
+
+// Clone returns a deep copy of the item
+func (item PaletteItem) Clone() PaletteItem {
+	item.Tags = cloneStrings(item.Tags)
+	item.SourceModifiers = cloneStrings(item.SourceModifiers)
+	return item
+}
+
+// sameDesign reports whether two items look the same on a key
+func (item PaletteItem) sameDesign(other PaletteItem) bool {
+	return item.ImageData == other.ImageData && item.Label == other.Label &&
+		item.Color == other.Color && item.Description == other.Description
+}
+
+// matches reports whether the item passes a search's filters
+func (item PaletteItem) matches(search PaletteSearch) bool {
+	if search.FavoritesOnly && !item.Favorite {
+		return false
+	}
+	for _, tag := range search.Tags {
+		if !hasTag(item.Tags, tag) {
+			return false
+		}
+	}
+	query := strings.ToLower(strings.TrimSpace(search.Query))
+	if query == "" {
+		return true
+	}
+	text := strings.ToLower(item.Label + "\n" + item.Description + "\n" + strings.Join(item.Tags, "\n"))
+	return strings.Contains(text, query)
+}
+
+// validatePaletteItem checks an item's color and image
+func validatePaletteItem(item PaletteItem) error {
+	if item.Color != "" && !isValidHexColor(item.Color) {
+		return fmt.Errorf("invalid color: %s", item.Color)
+	}
+	if item.ImageData != "" && !isValidBase64Image(item.ImageData) {
+		return fmt.Errorf("invalid image data: must be a base64 encoded image")
+	}
+	return nil
+}
+
+// normalizeTags trims tags and drops empty and duplicate ones, ignoring case
+func normalizeTags(tags []string) []string {
+	normalized := []string{}
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag != "" && !hasTag(normalized, tag) {
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized
+}
+
+// hasTag reports whether tags contains tag, ignoring case
+func hasTag(tags []string, tag string) bool {
+	for _, existing := range tags {
+		if strings.EqualFold(existing, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// palette returns the palette a profile ID refers to, loading the profile if needed,
+// and the profile itself (nil for the shared palette). The caller must hold the write lock.
+func (a *App) palette(profileID string) (*[]PaletteItem, *Profile, error) {
+	if profileID == "" {
+		return &a.profileManager.Palette, nil, nil
+	}
+	profile := a.profileManager.GetProfile(profileID)
+	if profile == nil {
+		return nil, nil, fmt.Errorf("profile not found: %s", profileID)
+	}
+	if err := a.ensureProfileLoaded(profile); err != nil {
+		return nil, nil, err
+	}
+	// Loading may quarantine profiles, so look it up again
+	if profile = a.profileManager.GetProfile(profileID); profile == nil {
+		return nil, nil, fmt.Errorf("profile not found: %s", profileID)
+	}
+	return &profile.Palette, profile, nil
+}
+
+// paletteChanged saves a changed palette. The caller must hold the write lock.
+func (a *App) paletteChanged(profile *Profile) {
+	if profile == nil {
+		// The shared palette lives in the index, which every save rewrites
+		a.requestSave()
+		return
+	}
+	profile.ModifiedAt = time.Now()
+	a.requestSave(profile.ID)
+}
+
+// findPaletteItem returns the index of an item in a palette
+func findPaletteItem(items []PaletteItem, itemID string) (int, error) {
+	for i := range items {
+		if items[i].ID == itemID {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("palette item not found: %s", itemID)
+}
+
+// GetPalette returns the items of a palette in the order they were added
+func (a *App) GetPalette(profileID string) (string, error) {
+	a.lock()
+	defer a.unlock()
+
+	items, _, err := a.palette(profileID)
+	if err != nil {
+		return "", err
+	}
+	return marshalPaletteItems(*items)
+}
+
+// SearchPalette returns the palette items that match a search, favorites first and
+// then newest first. searchJSON is a PaletteSearch.
+func (a *App) SearchPalette(searchJSON string) (string, error) {
+	var search PaletteSearch
+	if err := json.Unmarshal([]byte(searchJSON), &search); err != nil {
+		return "", fmt.Errorf("invalid palette search: %v", err)
+	}
+
+	a.lock()
+	defer a.unlock()
+
+	items, _, err := a.palette(search.ProfileID)
+	if err != nil {
+		return "", err
+	}
+	candidates := *items
+	if search.ProfileID != "" && search.IncludeShared {
+		candidates = append(append([]PaletteItem{}, candidates...), a.profileManager.Palette...)
+	}
+
+	results := []PaletteItem{}
+	for _, item := range candidates {
+		if item.matches(search) {
+			results = append(results, item)
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Favorite != results[j].Favorite {
+			return results[i].Favorite
+		}
+		return results[i].Timestamp > results[j].Timestamp
+	})
+	return marshalPaletteItems(results)
+}
+
+// GetPaletteTags returns every tag used in a palette, sorted
+func (a *App) GetPaletteTags(profileID string) (string, error) {
+	a.lock()
+	defer a.unlock()
+
+	items, _, err := a.palette(profileID)
+	if err != nil {
+		return "", err
+	}
+	var tags []string
+	for _, item := range *items {
+		for _, tag := range item.Tags {
+			if !hasTag(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	tags = normalizeTags(tags)
+	sort.Strings(tags)
+
+	data, err := json.MarshalIndent(tags, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal palette tags: %v", err)
+	}
+	return string(data), nil
+}
+
+// AddPaletteItem adds a design to a palette and returns it with its ID
+func (a *App) AddPaletteItem(profileID, itemJSON string) (string, error) {
+	var item PaletteItem
+	if err := json.Unmarshal([]byte(itemJSON), &item); err != nil {
+		return "", fmt.Errorf("invalid palette item: %v", err)
+	}
+	if err := validatePaletteItem(item); err != nil {
+		return "", err
+	}
+
+	a.lock()
+	defer a.unlock()
+
+	items, profile, err := a.palette(profileID)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	item.ID = fmt.Sprintf("design_%d", now.UnixNano())
+	item.Tags = normalizeTags(item.Tags)
+	if item.Timestamp == 0 {
+		item.Timestamp = now.UnixMilli()
+	}
+	item.ModifiedAt = now
+	*items = append(*items, item)
+
+	a.paletteChanged(profile)
+	return marshalPaletteItem(item)
+}
+
+// UpdatePaletteItem replaces the design, tags and favorite flag of a palette item
+func (a *App) UpdatePaletteItem(profileID, itemJSON string) error {
+	var item PaletteItem
+	if err := json.Unmarshal([]byte(itemJSON), &item); err != nil {
+		return fmt.Errorf("invalid palette item: %v", err)
+	}
+	if err := validatePaletteItem(item); err != nil {
+		return err
+	}
+
+	a.lock()
+	defer a.unlock()
+
+	items, profile, err := a.palette(profileID)
+	if err != nil {
+		return err
+	}
+	index, err := findPaletteItem(*items, item.ID)
+	if err != nil {
+		return err
+	}
+
+	existing := &(*items)[index]
+	existing.Label = item.Label
+	existing.ImageData = item.ImageData
+	existing.Color = item.Color
+	existing.Description = item.Description
+	existing.KeyType = item.KeyType
+	existing.Tags = normalizeTags(item.Tags)
+	existing.Favorite = item.Favorite
+	existing.ModifiedAt = time.Now()
+
+	a.paletteChanged(profile)
+	return nil
+}
+
+// DeletePaletteItem removes an item from a palette
+func (a *App) DeletePaletteItem(profileID, itemID string) error {
+	a.lock()
+	defer a.unlock()
+
+	items, profile, err := a.palette(profileID)
+	if err != nil {
+		return err
+	}
+	index, err := findPaletteItem(*items, itemID)
+	if err != nil {
+		return err
+	}
+	*items = append((*items)[:index], (*items)[index+1:]...)
+
+	a.paletteChanged(profile)
+	return nil
+}
+
+// SetPaletteItemFavorite marks or unmarks a palette item as a favorite
+func (a *App) SetPaletteItemFavorite(profileID, itemID string, favorite bool) error {
+	return a.editPaletteItem(profileID, itemID, func(item *PaletteItem) {
+		item.Favorite = favorite
+	})
+}
+
+// SetPaletteItemTags replaces the tags of a palette item. tagsJSON is a list of tags.
+func (a *App) SetPaletteItemTags(profileID, itemID, tagsJSON string) error {
+	var tags []string
+	if err := json.Unmarshal([]byte(tagsJSON), &tags); err != nil {
+		return fmt.Errorf("invalid tags: %v", err)
+	}
+	return a.editPaletteItem(profileID, itemID, func(item *PaletteItem) {
+		item.Tags = normalizeTags(tags)
+	})
+}
+
+// RecordPaletteItemUse counts a use of a palette item, e.g. when it is applied to a key
+func (a *App) RecordPaletteItemUse(profileID, itemID string) error {
+	return a.editPaletteItem(profileID, itemID, func(item *PaletteItem) {
+		item.UsageCount++
+	})
+}
+
+// editPaletteItem changes one palette item and saves its palette
+func (a *App) editPaletteItem(profileID, itemID string, edit func(item *PaletteItem)) error {
+	a.lock()
+	defer a.unlock()
+
+	items, profile, err := a.palette(profileID)
+	if err != nil {
+		return err
+	}
+	index, err := findPaletteItem(*items, itemID)
+	if err != nil {
+		return err
+	}
+	edit(&(*items)[index])
+	(*items)[index].ModifiedAt = time.Now()
+
+	a.paletteChanged(profile)
+	return nil
+}
+
+// MovePaletteItem moves an item from one palette to another, e.g. from a profile's
+// palette to the shared one
+func (a *App) MovePaletteItem(fromProfileID, itemID, toProfileID string) error {
+	if fromProfileID == toProfileID {
+		return nil
+	}
+
+	a.lock()
+	defer a.unlock()
+
+	// Load both before taking pointers, since loading may rearrange the profile list
+	if _, _, err := a.palette(fromProfileID); err != nil {
+		return err
+	}
+	if _, _, err := a.palette(toProfileID); err != nil {
+		return err
+	}
+	from, fromProfile, err := a.palette(fromProfileID)
+	if err != nil {
+		return err
+	}
+	to, toProfile, err := a.palette(toProfileID)
+	if err != nil {
+		return err
+	}
+
+	index, err := findPaletteItem(*from, itemID)
+	if err != nil {
+		return err
+	}
+	item := (*from)[index]
+	*from = append((*from)[:index], (*from)[index+1:]...)
+	item.ModifiedAt = time.Now()
+	*to = append(*to, item)
+
+	a.paletteChanged(fromProfile)
+	a.paletteChanged(toProfile)
+	return nil
+}
+
+// ImportPaletteItems adds items to a palette, keeping their IDs unless they are taken
+// and skipping designs it already has, and returns how many were added. It is used to
+// bring over the palette older versions kept in the webview's storage.
+func (a *App) ImportPaletteItems(profileID, itemsJSON string) (int, error) {
+	var imported []PaletteItem
+	if err := json.Unmarshal([]byte(itemsJSON), &imported); err != nil {
+		return 0, fmt.Errorf("invalid palette items: %v", err)
+	}
+
+	a.lock()
+	defer a.unlock()
+
+	items, profile, err := a.palette(profileID)
+	if err != nil {
+		return 0, err
+	}
+
+	added := 0
+	now := time.Now()
+	for _, item := range imported {
+		if err := validatePaletteItem(item); err != nil {
+			fmt.Printf("Warning: Skipping palette item %s: %v\n", item.ID, err)
+			continue
+		}
+		duplicate := false
+		for _, existing := range *items {
+			if existing.sameDesign(item) {
+				duplicate = true
+				break
+			}
+		}
+		if duplicate {
+			continue
+		}
+		if _, err := findPaletteItem(*items, item.ID); item.ID == "" || err == nil {
+			item.ID = fmt.Sprintf("design_%d_%d", now.UnixNano(), added)
+		}
+		item.Tags = normalizeTags(item.Tags)
+		if item.Timestamp == 0 {
+			item.Timestamp = now.UnixMilli()
+		}
+		item.ModifiedAt = now
+		*items = append(*items, item)
+		added++
+	}
+
+	if added > 0 {
+		a.paletteChanged(profile)
+	}
+	return added, nil
+}
+
+// clonePalette returns a deep copy of a palette, preserving nil
+func clonePalette(items []PaletteItem) []PaletteItem {
+	if items == nil {
+		return nil
+	}
+	cloned := make([]PaletteItem, len(items))
+	for i, item := range items {
+		cloned[i] = item.Clone()
+	}
+	return cloned
+}
+
+// marshalPaletteItems returns items as JSON, an empty list when there are none
+func marshalPaletteItems(items []PaletteItem) (string, error) {
+	if items == nil {
+		items = []PaletteItem{}
+	}
+	data, err := json.MarshalIndent(items, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal palette: %v", err)
+	}
+	return string(data), nil
+}
+
+// marshalPaletteItem returns an item as JSON
+func marshalPaletteItem(item PaletteItem) (string, error) {
+	data, err := json.MarshalIndent(item, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal palette item: %v", err)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// dataDirEnv names the environment variable that overrides where all data is stored
+const dataDirEnv = "KBDSHRTCT_DATA_DIR"
+
+// appDirName is the directory name used under the XDG base directories
+const appDirName = "kbdshrtct"
+
+// legacyDirName is the directory under the home directory used by earlier versions
+const legacyDirName = ".keyboard-cheatsheet"
+
+// Paths holds the directories the app reads and writes
+type Paths struct {
+	ConfigDir string `json:"configDir"` // Profiles, index and settings
+	DataDir   string `json:"dataDir"`   // Bulk data such as images
+	ImagesDir string `json:"imagesDir"` // Key images, referenced from the profile files (see images.go)
+	Portable  bool   `json:"portable"`  // Everything lives in one directory chosen by the user
+}
+
+// parseDataDirFlag extracts --data-dir from the command line. Unknown arguments are
+// ignored because the platform or the Wails tooling may pass their own.
+func parseDataDirFlag(args []string) string {
+	flags := flag.NewFlagSet("kbdshrtct", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	dataDir := flags.String("data-dir", "", "directory to store all profiles and images in")
+
+	// Parse stops at the first unknown flag, so feed it one argument at a time
+	for i := 0; i < len(args); i++ {
+		if !strings.HasPrefix(args[i], "-data-dir") && !strings.HasPrefix(args[i], "--data-dir") {
+			continue
+		}
+		if err := flags.Parse(args[i:]); err != nil {
+			continue
+		}
+		break
+	}
+
+	return *dataDir
+}
+
+// resolvePaths decides where data is stored. An explicit override (flag or environment)
+// puts everything in one directory; on Linux and other Unix systems the XDG base
+// directories are used; elsewhere the legacy ~/.keyboard-cheatsheet directory is kept.
+func resolvePaths(override string) (Paths, error) {
+	if override == "" {
+		override = os.Getenv(dataDirEnv)
+	}
+	if override != "" {
+		dir, err := filepath.Abs(override)
+		if err != nil {
+			return Paths{}, fmt.Errorf("invalid data directory %s: %v", override, err)
+		}
+		return Paths{
+			ConfigDir: dir,
+			DataDir:   dir,
+			ImagesDir: filepath.Join(dir, "images"),
+			Portable:  true,
+		}, nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return Paths{}, fmt.Errorf("failed to get home directory: %v", err)
+	}
+
+	if !usesXDG() {
+		dir := filepath.Join(homeDir, legacyDirName)
+		return Paths{
+			ConfigDir: dir,
+			DataDir:   dir,
+			ImagesDir: filepath.Join(dir, "images"),
+		}, nil
+	}
+
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" || !filepath.IsAbs(configHome) {
+		configHome = filepath.Join(homeDir, ".config")
+	}
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" || !filepath.IsAbs(dataHome) {
+		dataHome = filepath.Join(homeDir, ".local", "share")
+	}
+
+	dataDir := filepath.Join(dataHome, appDirName)
+	return Paths{
+		ConfigDir: filepath.Join(configHome, appDirName),
+		DataDir:   dataDir,
+		ImagesDir: filepath.Join(dataDir, "images"),
+	}, nil
+}
+
+// usesXDG reports whether the platform follows the XDG Base Directory specification
+func usesXDG() bool {
+	return runtime.GOOS != "windows" && runtime.GOOS != "darwin"
+}
+
+// GetDataPaths returns the directories profiles and images are stored in
+func (a *App) GetDataPaths() (string, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	data, err := json.MarshalIndent(a.paths, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// migrateLegacyDir copies data from ~/.keyboard-cheatsheet into the XDG directories the
+// first time they are used. The legacy directory is left in place as a backup.
+// The caller must hold the write lock (or be constructing the App).
+func (a *App) migrateLegacyDir() {
+	if a.paths.Portable || !usesXDG() {
+		return
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return
+	}
+	legacyDir := filepath.Join(homeDir, legacyDirName)
+	if info, err := os.Stat(legacyDir); err != nil || !info.IsDir() {
+		return
+	}
+
+	// Anything already in the new location means migration happened (or isn't wanted)
+	for _, name := range []string{"index.json", "profiles.json", "config.json"} {
+		if _, err := os.Stat(filepath.Join(a.paths.ConfigDir, name)); err == nil {
+			return
+		}
+	}
+
+	entries, err := os.ReadDir(legacyDir)
+	if err != nil {
+		fmt.Printf("Warning: Failed to read legacy directory %s: %v\n", legacyDir, err)
+		return
+	}
+
+	copied := 0
+	for _, entry := range entries {
+		source := filepath.Join(legacyDir, entry.Name())
+		target := filepath.Join(a.paths.ConfigDir, entry.Name())
+		if entry.Name() == "images" {
+			target = a.paths.ImagesDir
+		}
+
+		if err := copyPath(source, target); err != nil {
+			fmt.Printf("Warning: Failed to migrate %s: %v\n", source, err)
+			continue
+		}
+		copied++
+	}
+
+	if copied > 0 {
+		fmt.Printf("Copied %d item(s) from %s to %s; the old directory was kept as a backup\n", copied, legacyDir, a.paths.ConfigDir)
+		a.diagnostics.MigratedFrom = legacyDir
+	}
+}
+
+// copyPath copies a file or directory tree, creating parent directories as needed
+func copyPath(source, target string) error {
+	info, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		data, err := os.ReadFile(source)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		return writeFileAtomic(target, data, info.Mode().Perm())
+	}
+
+	entries, err := os.ReadDir(source)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(target, 0755); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := copyPath(filepath.Join(source, entry.Name()), filepath.Join(target, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+const (
+	saveDebounce = 500 * time.Millisecond // Quiet period before pending changes are written
+	saveMaxDelay = 5 * time.Second        // Upper bound on how long a change may stay unwritten
+)
+
+// requestSave marks the given profiles (and always the index) dirty and wakes the
+// background writer. Every edit of a profile ends here, so it also brings inheriting
+// profiles up to date. The caller must hold the write lock.
+func (a *App) requestSave(profileIDs ...string) {
+	a.dirty = true
+	for _, profileID := range profileIDs {
+		a.dirtyProfiles[profileID] = true
+		a.updateInheritance(profileID)
+	}
+	select {
+	case a.saveSignal <- struct{}{}:
+	default:
+		// A wake-up is already pending
+	}
+}
+
+// startSaveLoop starts the background writer
+func (a *App) startSaveLoop() {
+	go a.saveLoop()
+}
+
+// stopSaveLoop stops the background writer and waits for it to exit.
+// Pending changes are not written; call writePendingProfiles afterwards.
+func (a *App) stopSaveLoop() {
+	select {
+	case <-a.saveStop:
+		// Already stopped
+	default:
+		close(a.saveStop)
+	}
+	<-a.saveDone
+}
+
+// saveLoop coalesces save requests and writes them once the state has been quiet
+// for saveDebounce, or at the latest saveMaxDelay after the first pending change
+func (a *App) saveLoop() {
+	defer close(a.saveDone)
+
+	timer := time.NewTimer(saveDebounce)
+	timer.Stop()
+
+	var firstPending time.Time
+	for {
+		select {
+		case <-a.saveSignal:
+			if firstPending.IsZero() {
+				firstPending = time.Now()
+			}
+
+			wait := saveDebounce
+			if remaining := saveMaxDelay - time.Since(firstPending); remaining < wait {
+				wait = remaining
+			}
+			if wait < 0 {
+				wait = 0
+			}
+			timer.Reset(wait)
+		case <-timer.C:
+			firstPending = time.Time{}
+			if err := a.writePendingProfiles(); err != nil {
+				fmt.Printf("Warning: Failed to save profiles: %v\n", err)
+			}
+		case <-a.saveStop:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// writePendingProfiles writes the profile state to disk if it is dirty.
+// Failures leave the state dirty so the next save retries, and are reported
+// to the frontend as an EventSaveFailed event.
+func (a *App) writePendingProfiles() error {
+	a.writeMu.Lock()
+	defer a.writeMu.Unlock()
+
+	// Snapshot the state under the lock; the disk write happens without it
+	a.mu.Lock()
+	if !a.dirty {
+		a.mu.Unlock()
+		return nil
+	}
+	writes, err := a.snapshotPendingWrites()
+	if err == nil {
+		a.dirty = false
+	}
+	a.mu.Unlock()
+
+	if err == nil {
+		err = a.applyPendingWrites(writes)
+		if err != nil {
+			a.mu.Lock()
+			a.restorePendingWrites(writes)
+			a.mu.Unlock()
+		}
+	}
+
+	// The files are safe on disk either way; a failed commit is retried with the next save
+	if err == nil {
+		if commitErr := a.commitProfileChanges(""); commitErr != nil {
+			fmt.Printf("Warning: Failed to commit profile changes: %v\n", commitErr)
+		}
+	}
+
+	if err != nil {
+		a.emit(EventSaveFailed, SaveFailedEvent{
+			Error: err.Error(),
+			Time:  time.Now(),
+		})
+		return err
+	}
+
+	return nil
+}
+
+// writeFileAtomic writes data to a temporary file in the target directory, fsyncs it,
+// renames it over path and fsyncs the directory so the rename itself is durable
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+
+	tempFile, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file for %s: %v", path, err)
+	}
+	tempPath := tempFile.Name()
+
+	// Clean up the temp file on any failure before the rename
+	fail := func(format string, err error) error {
+		tempFile.Close()
+		os.Remove(tempPath)
+		return fmt.Errorf(format, path, err)
+	}
+
+	if _, err := tempFile.Write(data); err != nil {
+		return fail("failed to write temporary file for %s: %v", err)
+	}
+	if err := tempFile.Chmod(perm); err != nil && runtime.GOOS != "windows" {
+		return fail("failed to set permissions on temporary file for %s: %v", err)
+	}
+	if err := tempFile.Sync(); err != nil {
+		return fail("failed to sync temporary file for %s: %v", err)
+	}
+	if err := tempFile.Close(); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to close temporary file for %s: %v", path, err)
+	}
+
+	// Atomic move to final location
+	if err := os.Rename(tempPath, path); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to move %s to final location: %v", path, err)
+	}
+
+	return syncDir(dir)
+}
+
+// syncDir fsyncs a directory so that renames within it survive a crash.
+// Directories can't be synced on Windows, where renames are already durable.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open directory %s: %v", dir, err)
+	}
+	defer d.Close()
+
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("failed to sync directory %s: %v", dir, err)
+	}
+	return nil
+}
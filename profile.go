@@ -24,6 +24,19 @@ type Profile struct {
 	
 	// Profile-specific settings
 	ColorSchemes     map[string]string `json:"colorSchemes"`     // Color preferences
+	ColorByCategory  bool              `json:"colorByCategory,omitempty"` // Keys without their own color take their category's color
+	
+	// Inheritance - layouts resolve from the parent profile, overridden by this one (see inherit.go)
+	Parent           string            `json:"parent,omitempty"` // ID of the parent profile, if any
+	
+	// Key designs kept for this profile only (see palette.go)
+	Palette          []PaletteItem     `json:"palette,omitempty"`
+	
+	// Named key filters, e.g. all keys tagged "git" (see tags.go)
+	SavedFilters     []SavedFilter     `json:"savedFilters,omitempty"`
+	
+	stub      bool             // Only the index entry is loaded; layouts are still on disk (see storage.go)
+	overrides []KeyboardLayout // With a parent: what differs from it; this is what gets stored
 }
 
 // ProfileManager handles multiple profiles and profile operations
@@ -31,6 +44,7 @@ type ProfileManager struct {
 	Profiles       []Profile `json:"profiles"`       // All available profiles
 	ActiveProfile  string    `json:"activeProfile"`  // ID of currently active profile
 	LastModified   time.Time `json:"lastModified"`   // Last change timestamp
+	Palette        []PaletteItem `json:"palette,omitempty"` // Key designs shared by all profiles (see palette.go)
 }
 
 // NewProfile creates a new profile with default keyboard layouts
@@ -57,14 +71,19 @@ func NewProfile(name string) Profile {
 		CurrentLayout:    "Corne", // Default to Corne
 		CurrentLayer:     "base",
 		ActiveModifiers:  []string{},
-		ColorSchemes: map[string]string{
-			"letters":    "#e3f2fd",
-			"numbers":    "#e8f5e8",
-			"symbols":    "#fff3e0",
-			"function":   "#fff9c4",
-			"modifiers":  "#ffebee",
-			"navigation": "#f3e5f5",
-		},
+		ColorSchemes:     defaultColorSchemes(),
+	}
+}
+
+// defaultColorSchemes returns the default color preferences for a new profile
+func defaultColorSchemes() map[string]string {
+	return map[string]string{
+		"letters":    "#e3f2fd",
+		"numbers":    "#e8f5e8",
+		"symbols":    "#fff3e0",
+		"function":   "#fff9c4",
+		"modifiers":  "#ffebee",
+		"navigation": "#f3e5f5",
 	}
 }
 
@@ -87,20 +106,60 @@ func NewDefaultProfile(existingConfig KeyboardConfig) Profile {
 	
 	// Ensure color schemes exist
 	if profile.ColorSchemes == nil {
-		profile.ColorSchemes = map[string]string{
-			"letters":    "#e3f2fd",
-			"numbers":    "#e8f5e8",
-			"symbols":    "#fff3e0",
-			"function":   "#fff9c4",
-			"modifiers":  "#ffebee",
-			"navigation": "#f3e5f5",
-		}
+		profile.ColorSchemes = defaultColorSchemes()
 	}
 	
 	return profile
 }
 
-// GetActiveProfile returns the currently active profile
+// Clone returns a deep copy of the profile
+func (p *Profile) Clone() Profile {
+	cloned := *p
+	
+	cloned.Layouts = cloneLayouts(p.Layouts)
+	cloned.overrides = cloneLayouts(p.overrides)
+	cloned.ActiveModifiers = cloneStrings(p.ActiveModifiers)
+	cloned.Palette = clonePalette(p.Palette)
+	cloned.SavedFilters = cloneSavedFilters(p.SavedFilters)
+	
+	if p.ColorSchemes != nil {
+		cloned.ColorSchemes = make(map[string]string, len(p.ColorSchemes))
+		for name, color := range p.ColorSchemes {
+			cloned.ColorSchemes[name] = color
+		}
+	}
+	
+	return cloned
+}
+
+// cloneLayouts returns a deep copy of a layout slice, preserving nil
+func cloneLayouts(layouts []KeyboardLayout) []KeyboardLayout {
+	if layouts == nil {
+		return nil
+	}
+	cloned := make([]KeyboardLayout, len(layouts))
+	for i := range layouts {
+		cloned[i] = layouts[i].Clone()
+	}
+	return cloned
+}
+
+// Clone returns a deep copy of the profile manager
+func (pm *ProfileManager) Clone() ProfileManager {
+	cloned := *pm
+	
+	if pm.Profiles != nil {
+		cloned.Profiles = make([]Profile, len(pm.Profiles))
+		for i := range pm.Profiles {
+			cloned.Profiles[i] = pm.Profiles[i].Clone()
+		}
+	}
+	
+	return cloned
+}
+
+// GetActiveProfile returns the currently active profile.
+// Falls back to the first profile without modifying ActiveProfile, so it is safe to call under a read lock.
 func (pm *ProfileManager) GetActiveProfile() *Profile {
 	for i := range pm.Profiles {
 		if pm.Profiles[i].ID == pm.ActiveProfile {
@@ -110,7 +169,6 @@ func (pm *ProfileManager) GetActiveProfile() *Profile {
 	
 	// If no active profile found, return first profile
 	if len(pm.Profiles) > 0 {
-		pm.ActiveProfile = pm.Profiles[0].ID
 		return &pm.Profiles[0]
 	}
 	
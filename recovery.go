@@ -0,0 +1,368 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Loading never replaces user data wholesale. Problems are handled per profile:
+// profiles that parse are repaired in place (after backing up the original file),
+// profiles that don't are moved to the recovery directory, and everything that
+// happened is reported through GetStartupDiagnostics.
+
+// StartupDiagnostics describes what happened while loading profiles
+type StartupDiagnostics struct {
+	Mode         string               `json:"mode"`         // "normal", "migrated", "recovered" or "fresh"
+	MigratedFrom string               `json:"migratedFrom"` // Legacy directory data was copied from, if any
+	Repaired     []ProfileRepair      `json:"repaired"`     // Profiles that were fixed in place
+	Quarantined  []QuarantinedProfile `json:"quarantined"`  // Profiles that couldn't be loaded
+	Backups      []string             `json:"backups"`      // Copies of original files kept before rewriting them
+	Unavailable  []UnavailableProfile `json:"unavailable"`  // Profiles kept in the list whose files can't be read
+	Messages     []string             `json:"messages"`     // Other notable events
+}
+
+// UnavailableProfile describes a profile whose file couldn't be read. It stays in the
+// profile list, and its file is left untouched, so it loads once the file is readable.
+type UnavailableProfile struct {
+	ProfileID   string `json:"profileId"`
+	ProfileName string `json:"profileName"`
+	Error       string `json:"error"`
+}
+
+// ProfileRepair lists the changes made to a profile to make it loadable
+type ProfileRepair struct {
+	ProfileID   string   `json:"profileId"`
+	ProfileName string   `json:"profileName"`
+	Changes     []string `json:"changes"`
+}
+
+// QuarantinedProfile describes a profile that was set aside because it couldn't be read
+type QuarantinedProfile struct {
+	ProfileID   string    `json:"profileId"`
+	ProfileName string    `json:"profileName"`
+	Reason      string    `json:"reason"`
+	Path        string    `json:"path"` // Where the original data was kept
+	Time        time.Time `json:"time"`
+}
+
+// GetStartupDiagnostics returns what was repaired or quarantined while loading profiles
+func (a *App) GetStartupDiagnostics() (string, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	diagnostics := a.diagnostics
+	diagnostics.Unavailable = nil
+	for _, profile := range a.profileManager.Profiles {
+		if err, failed := a.profileLoadErrors[profile.ID]; failed {
+			diagnostics.Unavailable = append(diagnostics.Unavailable, UnavailableProfile{
+				ProfileID:   profile.ID,
+				ProfileName: profile.Name,
+				Error:       err.Error(),
+			})
+		}
+	}
+	if diagnostics.Mode == "" {
+		diagnostics.Mode = "normal"
+		if len(diagnostics.Repaired) > 0 || len(diagnostics.Quarantined) > 0 || len(diagnostics.Unavailable) > 0 || len(diagnostics.Messages) > 0 {
+			diagnostics.Mode = "recovered"
+		} else if diagnostics.MigratedFrom != "" {
+			diagnostics.Mode = "migrated"
+		}
+	}
+
+	data, err := json.MarshalIndent(diagnostics, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// getRecoveryDir returns the directory holding backups and quarantined profiles
+func (a *App) getRecoveryDir() (string, error) {
+	configPath, err := a.getConfigFilePath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(configPath), "recovery"), nil
+}
+
+// recoveryFilePath returns a fresh path in the recovery directory for the given name
+func (a *App) recoveryFilePath(name string) (string, error) {
+	recoveryDir, err := a.getRecoveryDir()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(recoveryDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create recovery directory %s: %v", recoveryDir, err)
+	}
+
+	stamp := time.Now().Format("20060102-150405")
+	path := filepath.Join(recoveryDir, stamp+"-"+name)
+	for i := 2; ; i++ {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return path, nil
+		}
+		path = filepath.Join(recoveryDir, fmt.Sprintf("%s-%d-%s", stamp, i, name))
+	}
+}
+
+// backupFile copies a file into the recovery directory before it is rewritten.
+// The caller must hold the write lock.
+func (a *App) backupFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s for backup: %v", path, err)
+	}
+
+	backupPath, err := a.recoveryFilePath(filepath.Base(path))
+	if err != nil {
+		return "", err
+	}
+	if err := writeFileAtomic(backupPath, data, 0644); err != nil {
+		return "", err
+	}
+
+	a.diagnostics.Backups = append(a.diagnostics.Backups, backupPath)
+	return backupPath, nil
+}
+
+// startBesideUnloadableProfiles adds and activates a new default profile when none of
+// the indexed profiles could be loaded, instead of starting over. The index is backed
+// up before it is rewritten, and profiles whose files couldn't be read stay in it as
+// stubs. The caller must hold the write lock.
+func (a *App) startBesideUnloadableProfiles(indexPath string, loadErr error) {
+	if _, err := a.backupFile(indexPath); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+
+	defaultProfile := NewProfile("Default")
+	a.profileManager.Profiles = append(a.profileManager.Profiles, defaultProfile)
+	a.profileManager.ActiveProfile = defaultProfile.ID
+	a.recordMessage("%v; started a new Default profile, the other profiles were kept", loadErr)
+	a.requestSave(defaultProfile.ID)
+}
+
+// quarantineData stores unreadable profile data in the recovery directory.
+// The caller must hold the write lock.
+func (a *App) quarantineData(profileID, profileName string, data []byte, reason error) {
+	name := "profile"
+	if isValidProfileID(profileID) {
+		name = profileID
+	}
+
+	entry := QuarantinedProfile{
+		ProfileID:   profileID,
+		ProfileName: profileName,
+		Reason:      reason.Error(),
+		Time:        time.Now(),
+	}
+
+	path, err := a.recoveryFilePath(name + ".json")
+	if err == nil {
+		err = writeFileAtomic(path, data, 0644)
+	}
+	if err != nil {
+		fmt.Printf("Warning: Failed to quarantine profile %s: %v\n", profileID, err)
+	} else {
+		entry.Path = path
+		fmt.Printf("Warning: Profile %s quarantined to %s: %v\n", profileID, path, reason)
+	}
+
+	a.diagnostics.Quarantined = append(a.diagnostics.Quarantined, entry)
+}
+
+// quarantineProfileFile moves an unreadable profile file into the recovery directory and
+// drops the profile from the manager. Pointers into profileManager.Profiles are invalid afterwards.
+// The caller must hold the write lock.
+func (a *App) quarantineProfileFile(profileID string, data []byte, reason error) {
+	profileName := profileID
+	if profile := a.profileManager.GetProfile(profileID); profile != nil {
+		profileName = profile.Name
+	}
+
+	a.quarantineData(profileID, profileName, data, reason)
+
+	if profilePath, err := a.getProfileDataPath(profileID); err == nil {
+		if err := os.Remove(profilePath); err != nil && !os.IsNotExist(err) {
+			fmt.Printf("Warning: Failed to remove quarantined profile file: %v\n", err)
+		}
+	}
+
+	for i := range a.profileManager.Profiles {
+		if a.profileManager.Profiles[i].ID == profileID {
+			a.profileManager.Profiles = append(a.profileManager.Profiles[:i], a.profileManager.Profiles[i+1:]...)
+			break
+		}
+	}
+	delete(a.dirtyProfiles, profileID)
+	a.notifyProfileChanged(profileID, "quarantined")
+	a.requestSave()
+}
+
+// recordRepair adds a profile's repairs to the diagnostics.
+// The caller must hold the write lock.
+func (a *App) recordRepair(profile *Profile, changes []string) {
+	if len(changes) == 0 {
+		return
+	}
+	fmt.Printf("Repaired profile %s: %s\n", profile.Name, strings.Join(changes, "; "))
+	a.diagnostics.Repaired = append(a.diagnostics.Repaired, ProfileRepair{
+		ProfileID:   profile.ID,
+		ProfileName: profile.Name,
+		Changes:     changes,
+	})
+}
+
+// recordMessage adds a message to the diagnostics.
+// The caller must hold the write lock.
+func (a *App) recordMessage(format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	fmt.Println(message)
+	a.diagnostics.Messages = append(a.diagnostics.Messages, message)
+}
+
+// repairProfile fixes everything in a parsed profile that would stop it from being used
+// and returns a description of each change
+func repairProfile(profile *Profile) []string {
+	var changes []string
+
+	if profile.ID == "" {
+		profile.ID = fmt.Sprintf("profile_%d", time.Now().UnixNano())
+		changes = append(changes, "assigned a new ID")
+	}
+	if profile.Name == "" {
+		profile.Name = "Unnamed Profile"
+		changes = append(changes, "named the profile \"Unnamed Profile\"")
+	}
+	if profile.BackgroundColor == "" {
+		profile.BackgroundColor = "#6366f1"
+	}
+	if profile.ColorSchemes == nil {
+		profile.ColorSchemes = defaultColorSchemes()
+		changes = append(changes, "restored default color schemes")
+	}
+	if profile.ActiveModifiers == nil {
+		profile.ActiveModifiers = []string{}
+	}
+
+	// Ensure profile has layouts
+	if len(profile.Layouts) == 0 {
+		corne := DefaultCorneLayout()
+		corne.Name = "Corne"
+		tenkeyless := DefaultTenkeylessLayout()
+		tenkeyless.Name = "Tenkeyless"
+		profile.Layouts = []KeyboardLayout{corne, tenkeyless}
+		changes = append(changes, "profile had no layouts, added default Corne and Tenkeyless layouts")
+	}
+
+	names := make(map[string]bool)
+	for i := range profile.Layouts {
+		layout := &profile.Layouts[i]
+
+		if layout.Name == "" {
+			layout.Name = fmt.Sprintf("Layout %d", i+1)
+			changes = append(changes, fmt.Sprintf("named unnamed layout %q", layout.Name))
+		}
+		if names[layout.Name] {
+			original := layout.Name
+			for n := 2; names[layout.Name]; n++ {
+				layout.Name = fmt.Sprintf("%s (%d)", original, n)
+			}
+			changes = append(changes, fmt.Sprintf("renamed duplicate layout %q to %q", original, layout.Name))
+		}
+		names[layout.Name] = true
+
+		for _, change := range repairLayout(layout) {
+			changes = append(changes, fmt.Sprintf("layout %q: %s", layout.Name, change))
+		}
+	}
+
+	// Ensure current layout exists
+	current := profile.GetCurrentLayout()
+	if current.Name != profile.CurrentLayout {
+		if profile.CurrentLayout != "" {
+			changes = append(changes, fmt.Sprintf("current layout %q not found, switched to %q", profile.CurrentLayout, current.Name))
+		}
+		profile.CurrentLayout = current.Name
+	}
+
+	// Ensure current layer exists in current layout
+	if _, exists := current.Layers[profile.CurrentLayer]; !exists {
+		fallback := "base"
+		if _, exists := current.Layers[fallback]; !exists {
+			layerNames := current.GetLayerNames()
+			sort.Strings(layerNames)
+			fallback = layerNames[0]
+		}
+		if profile.CurrentLayer != "" {
+			changes = append(changes, fmt.Sprintf("current layer %q not found, switched to %q", profile.CurrentLayer, fallback))
+		}
+		profile.CurrentLayer = fallback
+	}
+
+	return changes
+}
+
+// repairLayout fixes missing maps and layers in a layout and returns a description of each change
+func repairLayout(layout *KeyboardLayout) []string {
+	var changes []string
+
+	if len(layout.Layers) == 0 {
+		defaultLayout := DefaultCorneLayout()
+		layout.Layers = defaultLayout.Layers
+		layout.ModifierMaps = defaultLayout.ModifierMaps
+		changes = append(changes, "had no layers, restored the default Corne layers")
+	}
+	if layout.ModifierMaps == nil {
+		layout.ModifierMaps = make(map[string]map[string][]Key)
+		changes = append(changes, "created missing modifier maps")
+	}
+
+	layerNames := make([]string, 0, len(layout.Layers))
+	for layerName := range layout.Layers {
+		layerNames = append(layerNames, layerName)
+	}
+	sort.Strings(layerNames)
+
+	for _, layerName := range layerNames {
+		if layout.ModifierMaps[layerName] == nil {
+			layout.ModifierMaps[layerName] = make(map[string][]Key)
+		}
+
+		keys := layout.Layers[layerName]
+		for i := range keys {
+			if keys[i].Layer == "" {
+				keys[i].Layer = layerName
+			}
+		}
+	}
+
+	// Layouts saved before layers had settings relied on lower and raise being
+	// undeletable, so they keep that protection
+	if layout.LayerInfo == nil {
+		layout.LayerInfo = make(map[string]LayerInfo)
+		for _, layerName := range []string{"base", "lower", "raise"} {
+			if _, exists := layout.Layers[layerName]; exists {
+				layout.LayerInfo[layerName] = LayerInfo{Protected: true}
+			}
+		}
+	}
+	for layerName := range layout.LayerInfo {
+		if _, exists := layout.Layers[layerName]; !exists {
+			delete(layout.LayerInfo, layerName)
+			changes = append(changes, fmt.Sprintf("removed settings for missing layer %s", layerName))
+		}
+	}
+
+	// The key editor used to store descriptions as JSON, with the overlay images
+	eachLayoutKey(layout, func(key *Key) {
+		migrateOverlayLegends(key)
+	})
+
+	return changes
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestStartupKeepsUnreadableProfiles(t *testing.T) {
+	dataDir := t.TempDir()
+	app := NewApp(dataDir)
+	app.shutdown(nil)
+	brokenID := testProfileID(app)
+
+	// A directory where the profile file should be can't be read, but isn't quarantined
+	profilePath, err := app.getProfileDataPath(brokenID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(profilePath); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(profilePath, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	app = NewApp(dataDir)
+	t.Cleanup(func() { app.shutdown(nil) })
+
+	if testProfileID(app) == brokenID {
+		t.Fatal("unreadable profile is still active")
+	}
+	app.mu.RLock()
+	stub := app.profileManager.GetProfile(brokenID)
+	kept := stub != nil && !stub.IsLoaded()
+	app.mu.RUnlock()
+	if !kept {
+		t.Fatal("unreadable profile was dropped from the profile list")
+	}
+
+	indexPath, err := app.getIndexFilePath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(indexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var index ProfileIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Profiles) != 2 || index.Profiles[0].ID != brokenID {
+		t.Errorf("index lists %+v, want the unreadable profile and a new one", index.Profiles)
+	}
+
+	report, err := app.GetStartupDiagnostics()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var diagnostics StartupDiagnostics
+	if err := json.Unmarshal([]byte(report), &diagnostics); err != nil {
+		t.Fatal(err)
+	}
+	if diagnostics.Mode != "recovered" {
+		t.Errorf("mode = %s, want recovered", diagnostics.Mode)
+	}
+	if len(diagnostics.Unavailable) != 1 || diagnostics.Unavailable[0].ProfileID != brokenID || diagnostics.Unavailable[0].Error == "" {
+		t.Errorf("unavailable = %+v, want the unreadable profile with its error", diagnostics.Unavailable)
+	}
+	if len(diagnostics.Backups) != 1 {
+		t.Fatalf("backups = %v, want the index", diagnostics.Backups)
+	}
+	if backup, err := os.ReadFile(diagnostics.Backups[0]); err != nil || !json.Valid(backup) {
+		t.Errorf("index backup unreadable: %v", err)
+	}
+}
+
+func TestOldDescriptionsAreMigratedOnce(t *testing.T) {
+	dataDir := t.TempDir()
+	app := NewApp(dataDir)
+	app.shutdown(nil)
+
+	profilePath, err := app.getProfileDataPath(testProfileID(app))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(profilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored Profile
+	if err := json.Unmarshal(data, &stored); err != nil {
+		t.Fatal(err)
+	}
+	keys := stored.GetCurrentLayout().Layers[stored.CurrentLayer]
+	keys[0].Description = `{"userDescription":"Leave","secondaryImageData":"` + testImage + `"}`
+	if data, err = json.Marshal(stored); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(profilePath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	app = NewApp(dataDir)
+	t.Cleanup(func() { app.shutdown(nil) })
+
+	key := testKey(t, app, keys[0].ID)
+	if key.Description != "Leave" || key.Legends["topRight"].ImageData != testImage {
+		t.Errorf("key not migrated: description %q, legends %+v", key.Description, key.Legends)
+	}
+
+	// The file was rewritten in the current format, after keeping the original
+	if data, err = os.ReadFile(profilePath); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "userDescription") {
+		t.Error("profile file still holds the old description format")
+	}
+	report, err := app.GetStartupDiagnostics()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var diagnostics StartupDiagnostics
+	if err := json.Unmarshal([]byte(report), &diagnostics); err != nil {
+		t.Fatal(err)
+	}
+	if len(diagnostics.Backups) != 1 || len(diagnostics.Repaired) != 0 {
+		t.Errorf("backups %v and repairs %+v, want one backup and no repairs", diagnostics.Backups, diagnostics.Repaired)
+	}
+}
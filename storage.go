@@ -0,0 +1,502 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Profiles are stored one file per profile under profiles/<id>.json, next to a small
+// index.json holding the active profile, the display order and enough metadata to
+// render the profile selector. Profile files are parsed lazily on first use, and a
+// profile whose file is broken is isolated (see recovery.go) instead of failing the
+// whole load.
+
+// ProfileIndex is the on-disk index of all profiles
+type ProfileIndex struct {
+	ActiveProfile string           `json:"activeProfile"`     // ID of currently active profile
+	Profiles      []ProfileSummary `json:"profiles"`          // All profiles, in display order
+	LastModified  time.Time        `json:"lastModified"`      // Last change timestamp
+	Palette       []PaletteItem    `json:"palette,omitempty"` // The shared key palette
+}
+
+// ProfileSummary is the index entry for a profile
+type ProfileSummary struct {
+	ID              string    `json:"id"`
+	Name            string    `json:"name"`
+	Icon            string    `json:"icon"`
+	BackgroundColor string    `json:"backgroundColor"`
+	Description     string    `json:"description"`
+	CreatedAt       time.Time `json:"createdAt"`
+	ModifiedAt      time.Time `json:"modifiedAt"`
+	Parent          string    `json:"parent,omitempty"`
+}
+
+// pendingWrites is a snapshot of everything the background writer has to persist
+type pendingWrites struct {
+	index    []byte            // Marshalled index
+	profiles map[string][]byte // Profile ID -> marshalled profile
+	images   map[string][]byte // Stored image reference -> image, for the profiles above
+	deleted  []string          // Profile IDs whose files should be removed
+}
+
+// Summary returns the index entry for the profile
+func (p *Profile) Summary() ProfileSummary {
+	return ProfileSummary{
+		ID:              p.ID,
+		Name:            p.Name,
+		Icon:            p.Icon,
+		BackgroundColor: p.BackgroundColor,
+		Description:     p.Description,
+		CreatedAt:       p.CreatedAt,
+		ModifiedAt:      p.ModifiedAt,
+		Parent:          p.Parent,
+	}
+}
+
+// profileStub creates an unloaded profile from its index entry
+func profileStub(summary ProfileSummary) Profile {
+	return Profile{
+		ID:              summary.ID,
+		Name:            summary.Name,
+		Icon:            summary.Icon,
+		BackgroundColor: summary.BackgroundColor,
+		Description:     summary.Description,
+		CreatedAt:       summary.CreatedAt,
+		ModifiedAt:      summary.ModifiedAt,
+		Parent:          summary.Parent,
+		stub:            true,
+	}
+}
+
+// IsLoaded reports whether the profile's layouts have been read from disk
+func (p *Profile) IsLoaded() bool {
+	return !p.stub
+}
+
+// isValidProfileID reports whether id can safely be used as a file name
+func isValidProfileID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if !((c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '_' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// getIndexFilePath returns the path to the profile index file
+func (a *App) getIndexFilePath() (string, error) {
+	configPath, err := a.getConfigFilePath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(configPath), "index.json"), nil
+}
+
+// getProfilesDir returns the directory holding one file per profile
+func (a *App) getProfilesDir() (string, error) {
+	configPath, err := a.getConfigFilePath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(configPath), "profiles"), nil
+}
+
+// getProfileDataPath returns the path to a single profile's file
+func (a *App) getProfileDataPath(profileID string) (string, error) {
+	if !isValidProfileID(profileID) {
+		return "", fmt.Errorf("invalid profile ID %q", profileID)
+	}
+
+	profilesDir, err := a.getProfilesDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(profilesDir, profileID+".json"), nil
+}
+
+// loadProfileIndex reads the index and the active profile's file.
+// Other profiles stay unloaded until ensureProfileLoaded is called for them.
+func (a *App) loadProfileIndex(indexPath string) error {
+	data, err := os.ReadFile(indexPath)
+	if err != nil {
+		return fmt.Errorf("failed to read profile index: %v", err)
+	}
+
+	var index ProfileIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		a.recordMessage("profile index could not be parsed, rebuilding it from the profile files: %v", err)
+		if _, err := a.backupFile(indexPath); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+		if index, err = a.rebuildProfileIndex(); err != nil {
+			return err
+		}
+		a.requestSave()
+	}
+
+	profileManager := ProfileManager{
+		ActiveProfile: index.ActiveProfile,
+		LastModified:  index.LastModified,
+		Palette:       index.Palette,
+	}
+	seen := make(map[string]bool)
+	for _, summary := range index.Profiles {
+		if !isValidProfileID(summary.ID) || seen[summary.ID] {
+			fmt.Printf("Warning: Skipping invalid or duplicate profile ID %q in index\n", summary.ID)
+			continue
+		}
+		seen[summary.ID] = true
+		profileManager.Profiles = append(profileManager.Profiles, profileStub(summary))
+	}
+
+	if len(profileManager.Profiles) == 0 {
+		return fmt.Errorf("no profiles found in index")
+	}
+
+	a.profileManager = profileManager
+	a.profileLoadErrors = make(map[string]error)
+
+	if err := a.ensureActiveProfileLoaded(); err != nil {
+		a.startBesideUnloadableProfiles(indexPath, err)
+	}
+	return nil
+}
+
+// parseProfileData parses a single profile file
+func parseProfileData(profileID string, data []byte) (*Profile, error) {
+	var profile Profile
+	if err := json.Unmarshal(data, &profile); err != nil {
+		return nil, fmt.Errorf("profile %s corrupted: %v", profileID, err)
+	}
+
+	// The index is authoritative for the ID, the file name is derived from it
+	profile.ID = profileID
+	return &profile, nil
+}
+
+// rebuildProfileIndex recreates the index from the profile files on disk.
+// The caller must hold the write lock.
+func (a *App) rebuildProfileIndex() (ProfileIndex, error) {
+	var index ProfileIndex
+
+	profilesDir, err := a.getProfilesDir()
+	if err != nil {
+		return index, err
+	}
+	entries, err := os.ReadDir(profilesDir)
+	if err != nil {
+		return index, fmt.Errorf("failed to read profiles directory: %v", err)
+	}
+
+	for _, entry := range entries {
+		profileID := strings.TrimSuffix(entry.Name(), ".json")
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") || !isValidProfileID(profileID) {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(profilesDir, entry.Name()))
+		if err != nil {
+			fmt.Printf("Warning: Failed to read profile file %s: %v\n", entry.Name(), err)
+			continue
+		}
+		profile, err := parseProfileData(profileID, data)
+		if err != nil {
+			a.quarantineProfileFile(profileID, data, err)
+			continue
+		}
+		a.loadStoredImages(profile)
+		index.Profiles = append(index.Profiles, profile.Summary())
+	}
+
+	// Sort by creation so the rebuilt order is stable
+	sort.SliceStable(index.Profiles, func(i, j int) bool {
+		return index.Profiles[i].CreatedAt.Before(index.Profiles[j].CreatedAt)
+	})
+	return index, nil
+}
+
+// ensureProfileLoaded parses a profile's file if it is still a stub.
+// A file that can't be read is remembered and left untouched; a file that can't be parsed
+// is quarantined and the profile removed, so pointers into profileManager.Profiles must not
+// be used after an error. The caller must hold the write lock.
+func (a *App) ensureProfileLoaded(profile *Profile) error {
+	if profile.IsLoaded() {
+		return nil
+	}
+	if err, failed := a.profileLoadErrors[profile.ID]; failed {
+		return err
+	}
+
+	profileID := profile.ID
+	profilePath, err := a.getProfileDataPath(profileID)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(profilePath)
+	if err != nil {
+		err = fmt.Errorf("failed to read profile %s: %v", profile.Name, err)
+		fmt.Printf("Warning: %v\n", err)
+		a.profileLoadErrors[profileID] = err
+		return err
+	}
+
+	loaded, err := parseProfileData(profileID, data)
+	if err != nil {
+		a.quarantineProfileFile(profileID, data, err)
+		return err
+	}
+	a.loadStoredImages(loaded)
+
+	// A child's file only holds its overrides. Loading the parent may quarantine
+	// profiles, so look this one up again afterwards.
+	if err := a.resolveInheritedLayouts(loaded); err != nil {
+		err = fmt.Errorf("failed to load profile %s: %v", loaded.Name, err)
+		fmt.Printf("Warning: %v\n", err)
+		a.profileLoadErrors[profileID] = err
+		return err
+	}
+	profile = a.profileManager.GetProfile(profileID)
+	if profile == nil {
+		return fmt.Errorf("profile %s was removed while loading", profileID)
+	}
+
+	// Repaired profiles and ones in an old format are rewritten, so keep the original
+	// first. Moving to the current format isn't reported as a repair.
+	migrated := migrateProfileLegends(loaded)
+	changes := repairProfile(loaded)
+	if len(changes) > 0 || migrated {
+		if _, err := a.backupFile(profilePath); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+	}
+	if len(changes) > 0 {
+		a.recordRepair(loaded, changes)
+	}
+
+	*profile = *loaded
+	if len(changes) > 0 || migrated {
+		a.requestSave(profileID)
+	}
+	return nil
+}
+
+// ensureActiveProfileLoaded loads the active profile, switching to the first profile
+// that loads if the active one can't be read. The caller must hold the write lock.
+func (a *App) ensureActiveProfileLoaded() error {
+	if active := a.profileManager.GetActiveProfile(); active != nil {
+		activeID := active.ID
+		if err := a.ensureProfileLoaded(active); err == nil {
+			a.profileManager.ActiveProfile = activeID
+			return nil
+		}
+	}
+
+	// Loading may quarantine profiles, so walk a copy of the IDs
+	profileIDs := make([]string, 0, len(a.profileManager.Profiles))
+	for _, profile := range a.profileManager.Profiles {
+		profileIDs = append(profileIDs, profile.ID)
+	}
+
+	for _, profileID := range profileIDs {
+		profile := a.profileManager.GetProfile(profileID)
+		if profile == nil {
+			continue
+		}
+		if err := a.ensureProfileLoaded(profile); err == nil {
+			a.recordMessage("active profile unavailable, switched to %s", profile.Name)
+			a.profileManager.ActiveProfile = profileID
+			a.requestSave()
+			return nil
+		}
+	}
+
+	return fmt.Errorf("none of the %d profiles could be loaded", len(profileIDs))
+}
+
+// markProfileDeleted schedules a profile's file for removal on the next save.
+// The caller must hold the write lock.
+func (a *App) markProfileDeleted(profileID string) {
+	delete(a.dirtyProfiles, profileID)
+	delete(a.profileLoadErrors, profileID)
+	a.deletedProfiles[profileID] = true
+	a.requestSave()
+}
+
+// markAllProfilesDirty schedules every loaded profile for writing.
+// The caller must hold the write lock.
+func (a *App) markAllProfilesDirty() {
+	ids := make([]string, 0, len(a.profileManager.Profiles))
+	for _, profile := range a.profileManager.Profiles {
+		ids = append(ids, profile.ID)
+	}
+	a.requestSave(ids...)
+}
+
+// snapshotPendingWrites marshals the index and every dirty, loaded profile and clears
+// the dirty state. The caller must hold the write lock.
+func (a *App) snapshotPendingWrites() (*pendingWrites, error) {
+	a.profileManager.LastModified = time.Now()
+
+	index := ProfileIndex{
+		ActiveProfile: a.profileManager.ActiveProfile,
+		LastModified:  a.profileManager.LastModified,
+		Palette:       a.profileManager.Palette,
+	}
+	writes := &pendingWrites{profiles: make(map[string][]byte), images: make(map[string][]byte)}
+
+	for i := range a.profileManager.Profiles {
+		profile := &a.profileManager.Profiles[i]
+		index.Profiles = append(index.Profiles, profile.Summary())
+
+		// Stubs are never written: their file on disk is the only copy of their layouts
+		if !a.dirtyProfiles[profile.ID] || !profile.IsLoaded() {
+			continue
+		}
+		// Nor are profiles changed on disk behind unsaved edits until the conflict is resolved
+		if _, conflicted := a.profileConflicts[profile.ID]; conflicted {
+			continue
+		}
+
+		// A child is stored as its overrides only
+		stored := profile.Clone()
+		if profile.Parent != "" {
+			stored.Layouts = stored.overrides
+			if stored.Layouts == nil {
+				stored.Layouts = []KeyboardLayout{}
+			}
+		}
+		// The file references its images, which are stored separately (see images.go)
+		rewriteProfileImages(&stored, func(image string) string {
+			return storeImage(image, writes.images)
+		})
+
+		data, err := json.MarshalIndent(stored, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal profile %s: %v", profile.Name, err)
+		}
+		writes.profiles[profile.ID] = data
+	}
+
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal profile index: %v", err)
+	}
+	writes.index = data
+
+	for profileID := range a.deletedProfiles {
+		writes.deleted = append(writes.deleted, profileID)
+	}
+
+	dirtyProfiles := make(map[string]bool)
+	for profileID := range a.profileConflicts {
+		if a.dirtyProfiles[profileID] {
+			dirtyProfiles[profileID] = true
+		}
+	}
+	a.dirtyProfiles = dirtyProfiles
+	a.deletedProfiles = make(map[string]bool)
+	return writes, nil
+}
+
+// restorePendingWrites marks the contents of a failed write dirty again so the next save retries.
+// The caller must hold the write lock.
+func (a *App) restorePendingWrites(writes *pendingWrites) {
+	for profileID := range writes.profiles {
+		if a.profileManager.GetProfile(profileID) != nil {
+			a.dirtyProfiles[profileID] = true
+		}
+	}
+	for _, profileID := range writes.deleted {
+		if a.profileManager.GetProfile(profileID) == nil {
+			a.deletedProfiles[profileID] = true
+		}
+	}
+	a.dirty = true
+}
+
+// applyPendingWrites writes a snapshot to disk. Profile files are written before the
+// index, and images before profile files, so nothing references a file that doesn't
+// exist yet.
+// The caller must hold writeMu.
+func (a *App) applyPendingWrites(writes *pendingWrites) error {
+	profilesDir, err := a.getProfilesDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(profilesDir, 0755); err != nil {
+		return fmt.Errorf("failed to create profiles directory %s: %v", profilesDir, err)
+	}
+
+	// Images go first, so no profile file references an image that doesn't exist yet
+	if err := a.writeStoredImages(writes.images); err != nil {
+		return err
+	}
+	for profileID, data := range writes.profiles {
+		profilePath, err := a.getProfileDataPath(profileID)
+		if err != nil {
+			return err
+		}
+		if err := writeFileAtomic(profilePath, data, 0644); err != nil {
+			return err
+		}
+		a.recordFileStamp(profilePath, data)
+	}
+
+	indexPath, err := a.getIndexFilePath()
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(indexPath, writes.index, 0644); err != nil {
+		return err
+	}
+	a.recordFileStamp(indexPath, writes.index)
+
+	for _, profileID := range writes.deleted {
+		profilePath, err := a.getProfileDataPath(profileID)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(profilePath); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove profile file %s: %v", profilePath, err)
+		}
+		a.forgetFileStamp(profilePath)
+	}
+
+	return nil
+}
+
+// retireMonolithicProfiles renames the single-file profiles.json written by earlier
+// versions once its contents have been saved in the split layout
+func (a *App) retireMonolithicProfiles() {
+	profilePath, err := a.getProfileFilePath()
+	if err != nil {
+		return
+	}
+	indexPath, err := a.getIndexFilePath()
+	if err != nil {
+		return
+	}
+
+	if _, err := os.Stat(profilePath); err != nil {
+		return
+	}
+	if _, err := os.Stat(indexPath); err != nil {
+		return
+	}
+
+	migratedPath := profilePath + ".migrated"
+	if err := os.Rename(profilePath, migratedPath); err != nil {
+		fmt.Printf("Warning: Failed to rename migrated profiles file: %v\n", err)
+		return
+	}
+	fmt.Printf("Migrated profiles to per-profile files, original kept at %s\n", migratedPath)
+}
@@ -0,0 +1,730 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A small SVG rasterizer for the built-in icons (see icons.go). It understands the
+// subset the icons are drawn with: <svg>, <g>, <path>, <rect>, <circle>, <ellipse>,
+// <line>, <polyline> and <polygon>, filled and/or stroked with round caps and joins.
+// Colors in the file are ignored; everything is painted in one color. Transforms,
+// gradients and text are not supported.
+
+// point is a position in the icon, in viewBox or pixel units
+type point struct{ x, y float64 }
+
+// svgStyle is how an element is painted, inherited from its parents
+type svgStyle struct {
+	fill        bool
+	stroke      bool
+	evenOdd     bool
+	strokeWidth float64
+}
+
+// svgShape is a flattened element: its contours as polylines
+type svgShape struct {
+	contours [][]point
+	closed   []bool
+	style    svgStyle
+}
+
+// vectorIcon is a parsed SVG icon
+type vectorIcon struct {
+	viewBox [4]float64 // min x, min y, width, height
+	shapes  []svgShape
+}
+
+// parseSVG reads an icon in the supported subset of SVG
+func parseSVG(r io.Reader) (*vectorIcon, error) {
+	icon := &vectorIcon{viewBox: [4]float64{0, 0, 24, 24}}
+	styles := []svgStyle{{fill: true, strokeWidth: 1}}
+	decoder := xml.NewDecoder(r)
+	seenRoot := false
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid SVG: %v", err)
+		}
+
+		switch element := token.(type) {
+		case xml.StartElement:
+			style, err := applySVGStyle(styles[len(styles)-1], element.Attr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid <%s>: %v", element.Name.Local, err)
+			}
+			attrs := svgAttrs(element.Attr)
+
+			switch element.Name.Local {
+			case "svg":
+				if seenRoot {
+					return nil, fmt.Errorf("nested <svg> is not supported")
+				}
+				seenRoot = true
+				if viewBox, ok := attrs["viewBox"]; ok {
+					values, err := parseNumbers(viewBox)
+					if err != nil || len(values) != 4 || values[2] <= 0 || values[3] <= 0 {
+						return nil, fmt.Errorf("invalid viewBox %q", viewBox)
+					}
+					copy(icon.viewBox[:], values)
+				}
+			case "g":
+			case "path", "rect", "circle", "ellipse", "line", "polyline", "polygon":
+				shape, err := parseSVGShape(element.Name.Local, attrs)
+				if err != nil {
+					return nil, fmt.Errorf("invalid <%s>: %v", element.Name.Local, err)
+				}
+				shape.style = style
+				icon.shapes = append(icon.shapes, shape)
+			default:
+				// Metadata like <title> and anything unsupported draws nothing
+				if err := decoder.Skip(); err != nil {
+					return nil, fmt.Errorf("invalid SVG: %v", err)
+				}
+				continue
+			}
+			styles = append(styles, style)
+		case xml.EndElement:
+			if len(styles) > 1 {
+				styles = styles[:len(styles)-1]
+			}
+		}
+	}
+
+	if !seenRoot {
+		return nil, fmt.Errorf("not an SVG image")
+	}
+	return icon, nil
+}
+
+// svgAttrs returns an element's attributes by name
+func svgAttrs(attrs []xml.Attr) map[string]string {
+	values := make(map[string]string, len(attrs))
+	for _, attr := range attrs {
+		values[attr.Name.Local] = attr.Value
+	}
+	return values
+}
+
+// applySVGStyle returns the style of an element with the given attributes
+func applySVGStyle(style svgStyle, attrs []xml.Attr) (svgStyle, error) {
+	for _, attr := range attrs {
+		value := strings.TrimSpace(attr.Value)
+		switch attr.Name.Local {
+		case "fill":
+			style.fill = value != "none"
+		case "stroke":
+			style.stroke = value != "none"
+		case "fill-rule":
+			style.evenOdd = value == "evenodd"
+		case "stroke-width":
+			width, err := strconv.ParseFloat(strings.TrimSuffix(value, "px"), 64)
+			if err != nil || width < 0 {
+				return style, fmt.Errorf("invalid stroke-width %q", attr.Value)
+			}
+			style.strokeWidth = width
+		}
+	}
+	return style, nil
+}
+
+// parseSVGShape flattens a shape element into contours
+func parseSVGShape(name string, attrs map[string]string) (svgShape, error) {
+	number := func(attr string) (float64, error) {
+		value, exists := attrs[attr]
+		if !exists {
+			return 0, nil
+		}
+		parsed, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(value), "px"), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s %q", attr, value)
+		}
+		return parsed, nil
+	}
+	numbers := func(attrs ...string) ([]float64, error) {
+		values := make([]float64, len(attrs))
+		for i, attr := range attrs {
+			value, err := number(attr)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+		}
+		return values, nil
+	}
+
+	switch name {
+	case "path":
+		return parsePathData(attrs["d"])
+	case "rect":
+		v, err := numbers("x", "y", "width", "height", "rx", "ry")
+		if err != nil {
+			return svgShape{}, err
+		}
+		x, y, w, h, rx, ry := v[0], v[1], v[2], v[3], v[4], v[5]
+		if _, hasRY := attrs["ry"]; !hasRY {
+			ry = rx
+		}
+		if _, hasRX := attrs["rx"]; !hasRX {
+			rx = ry
+		}
+		rx, ry = math.Min(rx, w/2), math.Min(ry, h/2)
+		if rx <= 0 || ry <= 0 {
+			return parsePathData(fmt.Sprintf("M%g %gh%gv%gh%gz", x, y, w, h, -w))
+		}
+		return parsePathData(fmt.Sprintf("M%g %gh%ga%g %g 0 0 1 %g %gv%ga%g %g 0 0 1 %g %gh%ga%g %g 0 0 1 %g %gv%ga%g %g 0 0 1 %g %gz",
+			x+rx, y, w-2*rx, rx, ry, rx, ry, h-2*ry, rx, ry, -rx, ry, -(w - 2*rx), rx, ry, -rx, -ry, -(h - 2*ry), rx, ry, rx, -ry))
+	case "circle", "ellipse":
+		v, err := numbers("cx", "cy", "r", "rx", "ry")
+		if err != nil {
+			return svgShape{}, err
+		}
+		rx, ry := v[3], v[4]
+		if name == "circle" {
+			rx, ry = v[2], v[2]
+		}
+		if rx <= 0 || ry <= 0 {
+			return svgShape{}, nil
+		}
+		return parsePathData(fmt.Sprintf("M%g %ga%g %g 0 1 0 %g 0a%g %g 0 1 0 %g 0z", v[0]-rx, v[1], rx, ry, 2*rx, rx, ry, -2*rx))
+	case "line":
+		v, err := numbers("x1", "y1", "x2", "y2")
+		if err != nil {
+			return svgShape{}, err
+		}
+		return svgShape{contours: [][]point{{{v[0], v[1]}, {v[2], v[3]}}}, closed: []bool{false}}, nil
+	default: // polyline, polygon
+		values, err := parseNumbers(attrs["points"])
+		if err != nil || len(values)%2 != 0 {
+			return svgShape{}, fmt.Errorf("invalid points %q", attrs["points"])
+		}
+		var contour []point
+		for i := 0; i < len(values); i += 2 {
+			contour = append(contour, point{values[i], values[i+1]})
+		}
+		return svgShape{contours: [][]point{contour}, closed: []bool{name == "polygon"}}, nil
+	}
+}
+
+// parseNumbers reads a list of numbers separated by spaces and/or commas
+func parseNumbers(list string) ([]float64, error) {
+	var values []float64
+	for _, field := range strings.FieldsFunc(list, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r' }) {
+		value, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// pathScanner reads the commands and numbers of path data
+type pathScanner struct {
+	data string
+	pos  int
+}
+
+func (s *pathScanner) skipSeparators() {
+	for s.pos < len(s.data) && strings.IndexByte(" ,\t\n\r", s.data[s.pos]) >= 0 {
+		s.pos++
+	}
+}
+
+// command returns the next command letter, if the next token is one
+func (s *pathScanner) command() (byte, bool) {
+	s.skipSeparators()
+	if s.pos < len(s.data) && strings.IndexByte("MmLlHhVvCcSsQqTtAaZz", s.data[s.pos]) >= 0 {
+		s.pos++
+		return s.data[s.pos-1], true
+	}
+	return 0, false
+}
+
+// hasNumber reports whether a number follows
+func (s *pathScanner) hasNumber() bool {
+	s.skipSeparators()
+	return s.pos < len(s.data) && strings.IndexByte("+-.0123456789", s.data[s.pos]) >= 0
+}
+
+// number reads the next number; numbers may run together, as in "1.5.5" or "2-3"
+func (s *pathScanner) number() (float64, error) {
+	s.skipSeparators()
+	start := s.pos
+	if s.pos < len(s.data) && (s.data[s.pos] == '+' || s.data[s.pos] == '-') {
+		s.pos++
+	}
+	seenDot, seenDigit := false, false
+	for s.pos < len(s.data) {
+		c := s.data[s.pos]
+		switch {
+		case c >= '0' && c <= '9':
+			seenDigit = true
+		case c == '.' && !seenDot:
+			seenDot = true
+		case (c == 'e' || c == 'E') && seenDigit:
+			if s.pos+1 < len(s.data) && (s.data[s.pos+1] == '+' || s.data[s.pos+1] == '-') {
+				s.pos++
+			}
+		default:
+			return s.parse(start)
+		}
+		s.pos++
+	}
+	return s.parse(start)
+}
+
+func (s *pathScanner) parse(start int) (float64, error) {
+	value, err := strconv.ParseFloat(s.data[start:s.pos], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q in path data", s.data[start:s.pos])
+	}
+	return value, nil
+}
+
+// flag reads an arc flag, which may be written without a separator
+func (s *pathScanner) flag() (bool, error) {
+	s.skipSeparators()
+	if s.pos < len(s.data) && (s.data[s.pos] == '0' || s.data[s.pos] == '1') {
+		s.pos++
+		return s.data[s.pos-1] == '1', nil
+	}
+	return false, fmt.Errorf("invalid arc flag in path data")
+}
+
+// parsePathData flattens path data into contours
+func parsePathData(data string) (svgShape, error) {
+	var shape svgShape
+	scanner := &pathScanner{data: data}
+	var current, start, control point
+	var contour []point
+	var previous byte
+
+	finish := func(closed bool) {
+		if len(contour) > 0 {
+			shape.contours = append(shape.contours, contour)
+			shape.closed = append(shape.closed, closed)
+		}
+		contour = nil
+	}
+	lineTo := func(p point) {
+		if len(contour) == 0 {
+			contour = append(contour, current)
+		}
+		contour = append(contour, p)
+		current = p
+	}
+
+	var command byte
+	for {
+		if next, ok := scanner.command(); ok {
+			command = next
+		} else if !scanner.hasNumber() {
+			if scanner.pos < len(scanner.data) {
+				return shape, fmt.Errorf("unexpected %q in path data", scanner.data[scanner.pos])
+			}
+			break
+		} else if command == 0 {
+			return shape, fmt.Errorf("path data must start with a command")
+		}
+
+		relative := command >= 'a'
+		read := func(count int) ([]float64, error) {
+			values := make([]float64, count)
+			for i := range values {
+				value, err := scanner.number()
+				if err != nil {
+					return nil, err
+				}
+				values[i] = value
+			}
+			return values, nil
+		}
+		at := func(x, y float64) point {
+			if relative {
+				return point{current.x + x, current.y + y}
+			}
+			return point{x, y}
+		}
+
+		switch command | 0x20 { // lower case
+		case 'z':
+			finish(true)
+			current = start
+			previous = command
+			continue
+		case 'm':
+			v, err := read(2)
+			if err != nil {
+				return shape, err
+			}
+			finish(false)
+			current = at(v[0], v[1])
+			start = current
+			contour = []point{current}
+			// Further coordinate pairs are lines
+			if relative {
+				command = 'l'
+			} else {
+				command = 'L'
+			}
+		case 'l':
+			v, err := read(2)
+			if err != nil {
+				return shape, err
+			}
+			lineTo(at(v[0], v[1]))
+		case 'h':
+			v, err := read(1)
+			if err != nil {
+				return shape, err
+			}
+			target := point{v[0], current.y}
+			if relative {
+				target.x += current.x
+			}
+			lineTo(target)
+		case 'v':
+			v, err := read(1)
+			if err != nil {
+				return shape, err
+			}
+			target := point{current.x, v[0]}
+			if relative {
+				target.y += current.y
+			}
+			lineTo(target)
+		case 'c', 's':
+			var c1 point
+			if command|0x20 == 'c' {
+				v, err := read(2)
+				if err != nil {
+					return shape, err
+				}
+				c1 = at(v[0], v[1])
+			} else {
+				c1 = current
+				if p := previous | 0x20; p == 'c' || p == 's' {
+					c1 = point{2*current.x - control.x, 2*current.y - control.y}
+				}
+			}
+			v, err := read(4)
+			if err != nil {
+				return shape, err
+			}
+			c2, end := at(v[0], v[1]), at(v[2], v[3])
+			from := current
+			for _, p := range flattenCubic(from, c1, c2, end) {
+				lineTo(p)
+			}
+			control = c2
+		case 'q', 't':
+			var c point
+			if command|0x20 == 'q' {
+				v, err := read(2)
+				if err != nil {
+					return shape, err
+				}
+				c = at(v[0], v[1])
+			} else {
+				c = current
+				if p := previous | 0x20; p == 'q' || p == 't' {
+					c = point{2*current.x - control.x, 2*current.y - control.y}
+				}
+			}
+			v, err := read(2)
+			if err != nil {
+				return shape, err
+			}
+			end := at(v[0], v[1])
+			from := current
+			// A quadratic curve is a cubic one with its control points two thirds along
+			c1 := point{from.x + 2.0/3*(c.x-from.x), from.y + 2.0/3*(c.y-from.y)}
+			c2 := point{end.x + 2.0/3*(c.x-end.x), end.y + 2.0/3*(c.y-end.y)}
+			for _, p := range flattenCubic(from, c1, c2, end) {
+				lineTo(p)
+			}
+			control = c
+		case 'a':
+			radii, err := read(3)
+			if err != nil {
+				return shape, err
+			}
+			large, err := scanner.flag()
+			if err != nil {
+				return shape, err
+			}
+			sweep, err := scanner.flag()
+			if err != nil {
+				return shape, err
+			}
+			v, err := read(2)
+			if err != nil {
+				return shape, err
+			}
+			for _, p := range flattenArc(current, radii[0], radii[1], radii[2], large, sweep, at(v[0], v[1])) {
+				lineTo(p)
+			}
+		}
+		previous = command
+	}
+
+	finish(false)
+	return shape, nil
+}
+
+// curveSegments is how many lines a curve is flattened into
+const curveSegments = 16
+
+// flattenCubic returns points along a cubic Bézier curve, without its start
+func flattenCubic(p0, p1, p2, p3 point) []point {
+	points := make([]point, 0, curveSegments)
+	for i := 1; i <= curveSegments; i++ {
+		t := float64(i) / curveSegments
+		u := 1 - t
+		a, b, c, d := u*u*u, 3*u*u*t, 3*u*t*t, t*t*t
+		points = append(points, point{
+			a*p0.x + b*p1.x + c*p2.x + d*p3.x,
+			a*p0.y + b*p1.y + c*p2.y + d*p3.y,
+		})
+	}
+	return points
+}
+
+// flattenArc returns points along an elliptical arc in SVG's endpoint notation,
+// without its start (see the SVG specification, "Elliptical arc implementation notes")
+func flattenArc(from point, rx, ry, rotation float64, large, sweep bool, to point) []point {
+	rx, ry = math.Abs(rx), math.Abs(ry)
+	if rx == 0 || ry == 0 || from == to {
+		return []point{to}
+	}
+
+	phi := rotation * math.Pi / 180
+	sinPhi, cosPhi := math.Sin(phi), math.Cos(phi)
+	dx, dy := (from.x-to.x)/2, (from.y-to.y)/2
+	x1 := cosPhi*dx + sinPhi*dy
+	y1 := -sinPhi*dx + cosPhi*dy
+
+	// Scale up radii that are too small to reach the end point
+	if lambda := x1*x1/(rx*rx) + y1*y1/(ry*ry); lambda > 1 {
+		rx, ry = rx*math.Sqrt(lambda), ry*math.Sqrt(lambda)
+	}
+
+	numerator := rx*rx*ry*ry - rx*rx*y1*y1 - ry*ry*x1*x1
+	denominator := rx*rx*y1*y1 + ry*ry*x1*x1
+	factor := math.Sqrt(math.Max(0, numerator/denominator))
+	if large == sweep {
+		factor = -factor
+	}
+	cx1, cy1 := factor*rx*y1/ry, -factor*ry*x1/rx
+	cx := cosPhi*cx1 - sinPhi*cy1 + (from.x+to.x)/2
+	cy := sinPhi*cx1 + cosPhi*cy1 + (from.y+to.y)/2
+
+	angle := func(ux, uy, vx, vy float64) float64 {
+		return math.Atan2(ux*vy-uy*vx, ux*vx+uy*vy)
+	}
+	theta := angle(1, 0, (x1-cx1)/rx, (y1-cy1)/ry)
+	delta := angle((x1-cx1)/rx, (y1-cy1)/ry, (-x1-cx1)/rx, (-y1-cy1)/ry)
+	if !sweep && delta > 0 {
+		delta -= 2 * math.Pi
+	} else if sweep && delta < 0 {
+		delta += 2 * math.Pi
+	}
+
+	segments := int(math.Ceil(math.Abs(delta) / (math.Pi / curveSegments)))
+	if segments < 1 {
+		segments = 1
+	}
+	points := make([]point, 0, segments)
+	for i := 1; i <= segments; i++ {
+		t := theta + delta*float64(i)/float64(segments)
+		x, y := rx*math.Cos(t), ry*math.Sin(t)
+		points = append(points, point{cosPhi*x - sinPhi*y + cx, sinPhi*x + cosPhi*y + cy})
+	}
+	points[len(points)-1] = to
+	return points
+}
+
+// rasterSamples is the number of samples per pixel along each axis
+const rasterSamples = 4
+
+// rasterizeIcon paints an icon into a size by size image in one color. The viewBox
+// is scaled to fit and centered.
+func rasterizeIcon(icon *vectorIcon, size int, paint color.NRGBA) *image.NRGBA {
+	scale := float64(size) / math.Max(icon.viewBox[2], icon.viewBox[3])
+	offsetX := (float64(size) - icon.viewBox[2]*scale) / 2
+	offsetY := (float64(size) - icon.viewBox[3]*scale) / 2
+	toPixels := func(contour []point) []point {
+		pixels := make([]point, len(contour))
+		for i, p := range contour {
+			pixels[i] = point{(p.x-icon.viewBox[0])*scale + offsetX, (p.y-icon.viewBox[1])*scale + offsetY}
+		}
+		return pixels
+	}
+
+	alpha := make([]float64, size*size)
+	paintCoverage := func(coverage []float64) {
+		for i, c := range coverage {
+			alpha[i] += math.Min(c, 1) * (1 - alpha[i])
+		}
+	}
+
+	for _, shape := range icon.shapes {
+		contours := make([][]point, len(shape.contours))
+		for i, contour := range shape.contours {
+			contours[i] = toPixels(contour)
+		}
+		if shape.style.fill {
+			paintCoverage(coverage(contours, shape.style.evenOdd, size))
+		}
+		if shape.style.stroke && shape.style.strokeWidth > 0 {
+			paintCoverage(coverage(strokePolygons(contours, shape.closed, shape.style.strokeWidth*scale/2), false, size))
+		}
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, size, size))
+	for i, a := range alpha {
+		img.Pix[i*4] = paint.R
+		img.Pix[i*4+1] = paint.G
+		img.Pix[i*4+2] = paint.B
+		img.Pix[i*4+3] = uint8(math.Round(a * float64(paint.A)))
+	}
+	return img
+}
+
+// coverage returns how much of each pixel the polygons cover, from 0 to 1
+func coverage(polygons [][]point, evenOdd bool, size int) []float64 {
+	type edge struct {
+		from, to point
+		winding  int
+	}
+	var edges []edge
+	for _, polygon := range polygons {
+		for i := range polygon {
+			a, b := polygon[i], polygon[(i+1)%len(polygon)]
+			switch {
+			case a.y < b.y:
+				edges = append(edges, edge{a, b, 1})
+			case a.y > b.y:
+				edges = append(edges, edge{b, a, -1})
+			}
+		}
+	}
+
+	type crossing struct {
+		x       float64
+		winding int
+	}
+	result := make([]float64, size*size)
+	weight := 1.0 / (rasterSamples * rasterSamples)
+	samplesPerRow := size * rasterSamples
+	var crossings []crossing
+
+	for row := 0; row < size*rasterSamples; row++ {
+		y := (float64(row) + 0.5) / rasterSamples
+		crossings = crossings[:0]
+		for _, e := range edges {
+			if y >= e.from.y && y < e.to.y {
+				x := e.from.x + (y-e.from.y)*(e.to.x-e.from.x)/(e.to.y-e.from.y)
+				crossings = append(crossings, crossing{x, e.winding})
+			}
+		}
+		sort.Slice(crossings, func(i, j int) bool { return crossings[i].x < crossings[j].x })
+
+		winding := 0
+		for i := 0; i+1 < len(crossings); i++ {
+			winding += crossings[i].winding
+			inside := winding != 0
+			if evenOdd {
+				inside = winding%2 != 0
+			}
+			if !inside {
+				continue
+			}
+			// Samples sit at the middle of each sub-pixel column
+			first := int(math.Ceil(crossings[i].x*rasterSamples - 0.5))
+			last := int(math.Ceil(crossings[i+1].x*rasterSamples-0.5)) - 1
+			if first < 0 {
+				first = 0
+			}
+			if last >= samplesPerRow {
+				last = samplesPerRow - 1
+			}
+			pixelRow := (row / rasterSamples) * size
+			for sample := first; sample <= last; sample++ {
+				result[pixelRow+sample/rasterSamples] += weight
+			}
+		}
+	}
+	return result
+}
+
+// strokePolygons outlines polylines with round caps and joins: a rectangle along
+// each segment and a disc at each point. All are wound the same way, so filling
+// them with the nonzero rule paints their union.
+func strokePolygons(contours [][]point, closed []bool, halfWidth float64) [][]point {
+	var polygons [][]point
+	for i, contour := range contours {
+		for j, p := range contour {
+			polygons = append(polygons, disc(p, halfWidth))
+
+			var next point
+			switch {
+			case j+1 < len(contour):
+				next = contour[j+1]
+			case closed[i] && len(contour) > 2:
+				next = contour[0]
+			default:
+				continue
+			}
+			dx, dy := next.x-p.x, next.y-p.y
+			length := math.Hypot(dx, dy)
+			if length == 0 {
+				continue
+			}
+			nx, ny := -dy/length*halfWidth, dx/length*halfWidth
+			polygons = append(polygons, clockwise([]point{
+				{p.x + nx, p.y + ny}, {next.x + nx, next.y + ny},
+				{next.x - nx, next.y - ny}, {p.x - nx, p.y - ny},
+			}))
+		}
+	}
+	return polygons
+}
+
+// disc returns a polygon approximating a circle
+func disc(center point, radius float64) []point {
+	const sides = 24
+	points := make([]point, sides)
+	for i := range points {
+		angle := 2 * math.Pi * float64(i) / sides
+		points[i] = point{center.x + radius*math.Cos(angle), center.y + radius*math.Sin(angle)}
+	}
+	return points
+}
+
+// clockwise returns a polygon wound the same way as disc, reversing it if needed
+func clockwise(polygon []point) []point {
+	area := 0.0
+	for i := range polygon {
+		a, b := polygon[i], polygon[(i+1)%len(polygon)]
+		area += a.x*b.y - b.x*a.y
+	}
+	if area < 0 {
+		for i, j := 0, len(polygon)-1; i < j; i, j = i+1, j-1 {
+			polygon[i], polygon[j] = polygon[j], polygon[i]
+		}
+	}
+	return polygon
+}
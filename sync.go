@@ -0,0 +1,662 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sync keeps the configuration directory in a git repository, driven through the
+// system git binary. Every background save becomes a commit whose message describes
+// the change, and PullProfiles/PushProfiles exchange commits with a remote (typically
+// a bare repository on a local or shared path). When both sides changed the same
+// profile, it is merged key by key (see merge.go); if that conflicts too, the merge is
+// abandoned and the differences are reported per profile instead of leaving conflict
+// markers in the files.
+
+const (
+	syncRemote    = "origin"         // Name of the remote used for pulling and pushing
+	syncConfigKey = "kbdshrtct.sync" // Repository config key recording that sync is on
+	syncBranch    = "main"           // Branch created for new repositories
+)
+
+// syncIgnore lists files in the configuration directory that are never committed
+var syncIgnore = []string{"recovery/", "*.tmp", "profiles.json.migrated"}
+
+// SyncStatus describes the sync repository
+type SyncStatus struct {
+	Available  bool        `json:"available"` // The git binary was found
+	Enabled    bool        `json:"enabled"`
+	Directory  string      `json:"directory"` // Repository root (the configuration directory)
+	Remote     string      `json:"remote"`
+	Branch     string      `json:"branch"`
+	Ahead      int         `json:"ahead"`  // Local commits not yet pushed
+	Behind     int         `json:"behind"` // Remote commits not yet pulled, as of the last pull
+	LastCommit *SyncCommit `json:"lastCommit"`
+}
+
+// SyncCommit is a commit in the sync repository
+type SyncCommit struct {
+	Hash    string    `json:"hash"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// SyncResult is the outcome of a pull
+type SyncResult struct {
+	Status    string         `json:"status"` // "up-to-date", "fast-forward", "merged" or "conflict"
+	Kept      string         `json:"kept"`   // For a resolved pull, which side won conflicting profiles
+	Conflicts []SyncConflict `json:"conflicts"`
+}
+
+// SyncConflict describes a profile changed on both sides since they last agreed
+type SyncConflict struct {
+	Path        string          `json:"path"`
+	ProfileID   string          `json:"profileId"`
+	ProfileName string          `json:"profileName"`
+	Local       []ProfileChange `json:"local"`     // Changes made here since the common version
+	Remote      []ProfileChange `json:"remote"`    // Changes made on the remote since the common version
+	Conflicts   []MergeConflict `json:"conflicts"` // Changes made differently on both sides
+}
+
+// runGit runs git in the configuration directory and returns its trimmed output
+func (a *App) runGit(args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = a.paths.ConfigDir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "LC_ALL=C")
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			message = err.Error()
+		}
+		return strings.TrimSpace(stdout.String()), fmt.Errorf("git %s failed: %s", args[0], message)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// gitAvailable reports whether the git binary can be found
+func gitAvailable() bool {
+	_, err := exec.LookPath("git")
+	return err == nil
+}
+
+// isSyncRepository reports whether the configuration directory is itself a git repository
+func (a *App) isSyncRepository() bool {
+	_, err := os.Stat(filepath.Join(a.paths.ConfigDir, ".git"))
+	return err == nil
+}
+
+// loadSyncSettings turns sync on if it was enabled in a previous session
+func (a *App) loadSyncSettings() {
+	if !gitAvailable() || !a.isSyncRepository() {
+		return
+	}
+	value, err := a.runGit("config", "--bool", "--get", syncConfigKey)
+	a.syncEnabled = err == nil && value == "true"
+}
+
+// EnableSync turns the configuration directory into a git repository (if it isn't one
+// already) and commits the current profiles. remote is the repository to pull from and
+// push to, e.g. a bare repository on a local or network path; empty keeps the current one.
+func (a *App) EnableSync(remote string) error {
+	if !gitAvailable() {
+		return fmt.Errorf("git was not found on the PATH")
+	}
+
+	// Start from what is in memory
+	if err := a.writePendingProfiles(); err != nil {
+		return err
+	}
+
+	a.writeMu.Lock()
+	defer a.writeMu.Unlock()
+
+	if !a.isSyncRepository() {
+		// Never commit into a repository that holds more than the configuration directory
+		if toplevel, err := a.runGit("rev-parse", "--show-toplevel"); err == nil {
+			return fmt.Errorf("data directory %s is inside the git repository %s; use a directory of its own", a.paths.ConfigDir, toplevel)
+		}
+		if _, err := a.runGit("init", "-q"); err != nil {
+			return err
+		}
+		if _, err := a.runGit("symbolic-ref", "HEAD", "refs/heads/"+syncBranch); err != nil {
+			return err
+		}
+	}
+
+	// Commits need an identity; fall back to a local one if the user has none
+	if email, _ := a.runGit("config", "user.email"); email == "" {
+		if _, err := a.runGit("config", "user.email", "kbdshrtct@localhost"); err != nil {
+			return err
+		}
+	}
+	if name, _ := a.runGit("config", "user.name"); name == "" {
+		if _, err := a.runGit("config", "user.name", "Keyboard Cheatsheet"); err != nil {
+			return err
+		}
+	}
+
+	if err := a.ensureSyncIgnore(); err != nil {
+		return err
+	}
+
+	if remote != "" {
+		if _, err := a.runGit("remote", "get-url", syncRemote); err == nil {
+			_, err = a.runGit("remote", "set-url", syncRemote, remote)
+			if err != nil {
+				return err
+			}
+		} else if _, err := a.runGit("remote", "add", syncRemote, remote); err != nil {
+			return err
+		}
+	}
+
+	if _, err := a.runGit("config", "--bool", syncConfigKey, "true"); err != nil {
+		return err
+	}
+	a.syncEnabled = true
+
+	// The first commit takes everything as it is
+	if _, err := a.runGit("rev-parse", "-q", "--verify", "HEAD"); err != nil {
+		if err := a.copyImagesForSync(); err != nil {
+			return err
+		}
+		if _, err := a.runGit("add", "-A", "--", "."); err != nil {
+			return err
+		}
+		_, err := a.runGit("commit", "-q", "--no-verify", "-m", "Start syncing profiles")
+		return err
+	}
+	return a.commitProfileChanges("Update profiles")
+}
+
+// DisableSync stops committing saves. The repository and its history are kept.
+func (a *App) DisableSync() error {
+	a.writeMu.Lock()
+	defer a.writeMu.Unlock()
+
+	if !a.syncEnabled {
+		return nil
+	}
+	if _, err := a.runGit("config", "--bool", syncConfigKey, "false"); err != nil {
+		return err
+	}
+	a.syncEnabled = false
+	return nil
+}
+
+// GetSyncStatus returns whether sync is enabled and how the repository relates to its remote
+func (a *App) GetSyncStatus() (string, error) {
+	a.writeMu.Lock()
+	defer a.writeMu.Unlock()
+
+	status := SyncStatus{
+		Available: gitAvailable(),
+		Enabled:   a.syncEnabled,
+		Directory: a.paths.ConfigDir,
+	}
+
+	if status.Available && a.isSyncRepository() {
+		status.Remote, _ = a.runGit("remote", "get-url", syncRemote)
+		status.Branch, _ = a.runGit("symbolic-ref", "--short", "HEAD")
+
+		if counts, err := a.runGit("rev-list", "--left-right", "--count", "HEAD..."+syncRemote+"/"+status.Branch); err == nil {
+			if fields := strings.Fields(counts); len(fields) == 2 {
+				status.Ahead, _ = strconv.Atoi(fields[0])
+				status.Behind, _ = strconv.Atoi(fields[1])
+			}
+		}
+
+		if line, err := a.runGit("log", "-1", "--format=%H%x00%ct%x00%s"); err == nil && line != "" {
+			parts := strings.SplitN(line, "\x00", 3)
+			if len(parts) == 3 {
+				seconds, _ := strconv.ParseInt(parts[1], 10, 64)
+				status.LastCommit = &SyncCommit{Hash: parts[0], Time: time.Unix(seconds, 0), Message: parts[2]}
+			}
+		}
+	}
+
+	data, err := json.MarshalIndent(status, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// PullProfiles merges commits from the remote. A profile changed on both sides is merged
+// key by key; if the changes conflict, the merge is abandoned and the result lists the
+// changes on each side and the conflicts between them. Pass keep "local" or "remote"
+// to settle such conflicts by keeping one side's version of each conflicting profile.
+// Merged profiles are loaded like any other external change.
+func (a *App) PullProfiles(keep string) (string, error) {
+	if keep != "" && keep != "local" && keep != "remote" {
+		return "", fmt.Errorf("invalid choice %q (must be 'local', 'remote' or empty)", keep)
+	}
+
+	// Commit what is in memory so the merge starts from a clean tree
+	if err := a.writePendingProfiles(); err != nil {
+		return "", err
+	}
+
+	a.writeMu.Lock()
+	result, err := a.pullLocked(keep)
+	a.writeMu.Unlock()
+	if err != nil {
+		return "", err
+	}
+
+	// Pick up the merged files now rather than on the watcher's next tick
+	a.pollExternalChanges()
+
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// PushProfiles sends local commits to the remote
+func (a *App) PushProfiles() error {
+	if err := a.writePendingProfiles(); err != nil {
+		return err
+	}
+
+	a.writeMu.Lock()
+	defer a.writeMu.Unlock()
+
+	branch, err := a.syncBranchLocked()
+	if err != nil {
+		return err
+	}
+	if err := a.commitProfileChanges("Update view state"); err != nil {
+		return err
+	}
+
+	if _, err := a.runGit("push", "-q", syncRemote, "HEAD:refs/heads/"+branch); err != nil {
+		if strings.Contains(err.Error(), "rejected") || strings.Contains(err.Error(), "non-fast-forward") {
+			return fmt.Errorf("the remote has changes that aren't here yet; pull first")
+		}
+		return err
+	}
+	// Keep the remote-tracking branch current for GetSyncStatus
+	a.runGit("update-ref", "refs/remotes/"+syncRemote+"/"+branch, "HEAD")
+	return nil
+}
+
+// syncBranchLocked checks that sync is usable and returns the current branch.
+// The caller must hold writeMu.
+func (a *App) syncBranchLocked() (string, error) {
+	if !a.syncEnabled {
+		return "", fmt.Errorf("sync is not enabled")
+	}
+	if _, err := a.runGit("remote", "get-url", syncRemote); err != nil {
+		return "", fmt.Errorf("no sync remote configured")
+	}
+	branch, err := a.runGit("symbolic-ref", "--short", "HEAD")
+	if err != nil {
+		return "", fmt.Errorf("failed to determine the current branch: %v", err)
+	}
+	return branch, nil
+}
+
+// pullLocked fetches and merges the remote branch. The caller must hold writeMu.
+func (a *App) pullLocked(keep string) (SyncResult, error) {
+	result := SyncResult{Status: "up-to-date", Conflicts: []SyncConflict{}}
+
+	branch, err := a.syncBranchLocked()
+	if err != nil {
+		return result, err
+	}
+	if err := a.commitProfileChanges("Update view state"); err != nil {
+		return result, err
+	}
+
+	// A fresh remote has nothing to pull yet
+	if heads, err := a.runGit("ls-remote", "--heads", syncRemote, branch); err != nil {
+		return result, err
+	} else if heads == "" {
+		return result, nil
+	}
+	if _, err := a.runGit("fetch", "-q", syncRemote, branch); err != nil {
+		return result, err
+	}
+	remoteRef := "refs/remotes/" + syncRemote + "/" + branch
+	a.runGit("update-ref", remoteRef, "FETCH_HEAD")
+
+	if _, err := a.runGit("merge-base", "--is-ancestor", "FETCH_HEAD", "HEAD"); err == nil {
+		return result, nil
+	}
+	if _, err := a.runGit("merge-base", "--is-ancestor", "HEAD", "FETCH_HEAD"); err == nil {
+		if _, err := a.runGit("merge", "-q", "--ff-only", "FETCH_HEAD"); err != nil {
+			return result, err
+		}
+		result.Status = "fast-forward"
+		return result, nil
+	}
+
+	// Both sides moved on: merge without committing so the result can be checked first
+	_, mergeErr := a.runGit("merge", "-q", "--no-ff", "--no-commit", "--allow-unrelated-histories", "FETCH_HEAD")
+	conflicted, err := a.unmergedSyncFiles()
+	if err != nil {
+		a.runGit("merge", "--abort")
+		return result, err
+	}
+	if mergeErr != nil && len(conflicted) == 0 {
+		a.runGit("merge", "--abort")
+		return result, mergeErr
+	}
+
+	// The index is rewritten from memory on the next save; keeping ours is always safe,
+	// and profiles added on the remote are picked up from their files
+	indexPath := "index.json"
+	var profilePaths []string
+	for _, path := range conflicted {
+		if path == indexPath {
+			a.resolveSyncFile(path, "local")
+			continue
+		}
+		profilePaths = append(profilePaths, path)
+	}
+
+	// Profiles changed on both sides are merged key by key; only real conflicts remain
+	var unmerged []string
+	for _, path := range profilePaths {
+		merged, err := a.mergeSyncFile(path)
+		if err != nil {
+			a.runGit("merge", "--abort")
+			return result, err
+		}
+		if !merged {
+			unmerged = append(unmerged, path)
+		}
+	}
+	profilePaths = unmerged
+
+	if len(profilePaths) > 0 {
+		if keep == "" {
+			for _, path := range profilePaths {
+				result.Conflicts = append(result.Conflicts, a.describeSyncConflict(path))
+			}
+			a.runGit("merge", "--abort")
+			result.Status = "conflict"
+			return result, nil
+		}
+		for _, path := range profilePaths {
+			if err := a.resolveSyncFile(path, keep); err != nil {
+				a.runGit("merge", "--abort")
+				return result, err
+			}
+		}
+		result.Kept = keep
+	}
+
+	message := "Merge remote profile changes"
+	if len(profilePaths) > 0 {
+		message = fmt.Sprintf("Merge remote profile changes, keeping the %s version of %d profile(s)", keep, len(profilePaths))
+	}
+	if _, err := a.runGit("commit", "-q", "--no-verify", "-m", message); err != nil {
+		a.runGit("merge", "--abort")
+		return result, err
+	}
+
+	result.Status = "merged"
+	return result, nil
+}
+
+// unmergedSyncFiles returns the files git couldn't merge, plus profile files it merged
+// line by line into something that no longer parses. The caller must hold writeMu.
+func (a *App) unmergedSyncFiles() ([]string, error) {
+	output, err := a.runGit("diff", "--name-only", "--diff-filter=U")
+	if err != nil {
+		return nil, err
+	}
+	conflicted := strings.Fields(output)
+
+	unmerged := make(map[string]bool)
+	for _, path := range conflicted {
+		unmerged[path] = true
+	}
+
+	changed, err := a.runGit("diff", "--cached", "--name-only", "--diff-filter=AM", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range strings.Fields(changed) {
+		if unmerged[path] || !strings.HasPrefix(path, "profiles/") || !strings.HasSuffix(path, ".json") {
+			continue
+		}
+		data, err := a.runGit("show", ":"+path)
+		if err != nil || !json.Valid([]byte(data)) {
+			conflicted = append(conflicted, path)
+		}
+	}
+
+	return conflicted, nil
+}
+
+// mergeSyncFile merges both sides' versions of a conflicting profile file against their
+// common version and stages the result. It returns false, leaving the file alone, if
+// the changes conflict or a side deleted the profile. The caller must hold writeMu.
+func (a *App) mergeSyncFile(path string) (bool, error) {
+	local := a.profileAtRevision("HEAD", path)
+	remote := a.profileAtRevision("MERGE_HEAD", path)
+	if local == nil || remote == nil {
+		return false, nil
+	}
+	base := &Profile{}
+	if mergeBase, err := a.runGit("merge-base", "HEAD", "MERGE_HEAD"); err == nil {
+		if profile := a.profileAtRevision(mergeBase, path); profile != nil {
+			base = profile
+		}
+	}
+
+	merged, conflicts := mergeProfiles(base, local, remote, nil)
+	if len(conflicts) > 0 {
+		return false, nil
+	}
+
+	data, err := json.MarshalIndent(merged, "", "  ")
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal merged profile %s: %v", merged.Name, err)
+	}
+	if err := writeFileAtomic(filepath.Join(a.paths.ConfigDir, filepath.FromSlash(path)), data, 0644); err != nil {
+		return false, err
+	}
+	if _, err := a.runGit("add", "--", path); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// resolveSyncFile settles a conflicting file during a merge by taking one side's version.
+// The caller must hold writeMu.
+func (a *App) resolveSyncFile(path, keep string) error {
+	revision := "HEAD"
+	if keep == "remote" {
+		revision = "MERGE_HEAD"
+	}
+
+	// A side that deleted the file wins by deleting it
+	if _, err := a.runGit("cat-file", "-e", revision+":"+path); err != nil {
+		_, err = a.runGit("rm", "-q", "--ignore-unmatch", "--", path)
+		return err
+	}
+	if _, err := a.runGit("checkout", revision, "--", path); err != nil {
+		return err
+	}
+	_, err := a.runGit("add", "--", path)
+	return err
+}
+
+// describeSyncConflict lists what each side changed in a conflicting profile file since
+// their common version. The caller must hold writeMu during a merge.
+func (a *App) describeSyncConflict(path string) SyncConflict {
+	profileID := strings.TrimSuffix(filepath.Base(path), ".json")
+	conflict := SyncConflict{Path: path, ProfileID: profileID, ProfileName: profileID}
+
+	var base *Profile
+	if mergeBase, err := a.runGit("merge-base", "HEAD", "MERGE_HEAD"); err == nil {
+		base = a.profileAtRevision(mergeBase, path)
+	}
+	local := a.profileAtRevision("HEAD", path)
+	remote := a.profileAtRevision("MERGE_HEAD", path)
+
+	for _, profile := range []*Profile{local, remote, base} {
+		if profile != nil {
+			conflict.ProfileName = profile.Name
+			break
+		}
+	}
+
+	conflict.Local = diffProfileVersions(base, local)
+	conflict.Remote = diffProfileVersions(base, remote)
+	conflict.Conflicts = []MergeConflict{}
+	if local != nil && remote != nil {
+		if base == nil {
+			base = &Profile{}
+		}
+		_, conflicts := mergeProfiles(base, local, remote, nil)
+		conflict.Conflicts = append(conflict.Conflicts, conflicts...)
+	}
+	return conflict
+}
+
+// profileAtRevision parses a profile file as of a revision, or returns nil if it
+// doesn't exist there or can't be parsed. The caller must hold writeMu.
+func (a *App) profileAtRevision(revision, path string) *Profile {
+	data, err := a.runGit("show", revision+":"+path)
+	if err != nil {
+		return nil
+	}
+	profile, err := parseProfileData(strings.TrimSuffix(filepath.Base(path), ".json"), []byte(data))
+	if err != nil {
+		return nil
+	}
+	return profile
+}
+
+// diffProfileVersions diffs two versions of a profile either of which may be missing
+func diffProfileVersions(old, new *Profile) []ProfileChange {
+	switch {
+	case old == nil && new == nil:
+		return []ProfileChange{}
+	case old == nil:
+		return []ProfileChange{{Kind: "added", Scope: "profile", New: new.Name}}
+	case new == nil:
+		return []ProfileChange{{Kind: "removed", Scope: "profile", Old: old.Name}}
+	}
+	changes := diffProfiles(old, new)
+	if changes == nil {
+		changes = []ProfileChange{}
+	}
+	return changes
+}
+
+// ensureSyncIgnore writes a .gitignore keeping backups and temporary files out of the
+// repository. An existing .gitignore is left alone. The caller must hold writeMu.
+func (a *App) ensureSyncIgnore() error {
+	ignorePath := filepath.Join(a.paths.ConfigDir, ".gitignore")
+	if _, err := os.Stat(ignorePath); err == nil {
+		return nil
+	}
+	data := []byte(strings.Join(syncIgnore, "\n") + "\n")
+	if err := writeFileAtomic(ignorePath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %v", ignorePath, err)
+	}
+	return nil
+}
+
+// commitProfileChanges commits everything in the configuration directory with a message
+// generated from the profile changes. When only view state changed (active layer or
+// modifiers) nothing is committed unless fallback is non-empty, in which case it is
+// used as the message. The caller must hold writeMu.
+func (a *App) commitProfileChanges(fallback string) error {
+	if !a.syncEnabled {
+		return nil
+	}
+
+	if err := a.copyImagesForSync(); err != nil {
+		return err
+	}
+	if _, err := a.runGit("add", "-A", "--", "."); err != nil {
+		return err
+	}
+	staged, err := a.runGit("diff", "--cached", "--name-status", "--no-renames")
+	if err != nil {
+		return err
+	}
+	if staged == "" {
+		return nil
+	}
+
+	message := a.describeStagedChanges(staged)
+	if message == "" {
+		if fallback == "" {
+			return nil
+		}
+		message = fallback
+	}
+
+	_, err = a.runGit("commit", "-q", "--no-verify", "-m", message)
+	return err
+}
+
+// describeStagedChanges generates a commit message from `git diff --name-status` output.
+// The caller must hold writeMu.
+func (a *App) describeStagedChanges(staged string) string {
+	var summaries []string
+
+	for _, line := range strings.Split(staged, "\n") {
+		fields := strings.SplitN(line, "\t", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		status, path := fields[0], fields[1]
+
+		if path == "index.json" || strings.HasPrefix(path, "images/") {
+			continue // Order, active profile and images only; profile files describe the change
+		}
+		if !strings.HasPrefix(path, "profiles/") || !strings.HasSuffix(path, ".json") {
+			summaries = append(summaries, "Update "+path)
+			continue
+		}
+
+		var old, new *Profile
+		if status != "A" {
+			old = a.profileAtRevision("HEAD", path)
+		}
+		if status != "D" {
+			new = a.profileAtRevision("", path)
+		}
+
+		name := strings.TrimSuffix(filepath.Base(path), ".json")
+		if new != nil {
+			name = new.Name
+		} else if old != nil {
+			name = old.Name
+		}
+
+		changes := diffProfileVersions(old, new)
+		if summary := summarizeChanges(name, changes); summary != "" {
+			summaries = append(summaries, summary)
+		}
+	}
+
+	switch len(summaries) {
+	case 0:
+		return ""
+	case 1:
+		return summaries[0]
+	}
+	return fmt.Sprintf("Update %d profiles\n\n- %s", len(summaries), strings.Join(summaries, "\n- "))
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// newSyncTestApp starts an app on its own data directory, synced with remote
+func newSyncTestApp(t *testing.T, dataDir, remote string) *App {
+	t.Helper()
+	app := NewApp(dataDir)
+	t.Cleanup(func() { app.shutdown(nil) })
+	if err := app.EnableSync(remote); err != nil {
+		t.Fatalf("EnableSync: %v", err)
+	}
+	return app
+}
+
+// runTestGit runs git outside any app, for setting up repositories
+func runTestGit(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, output)
+	}
+}
+
+// testKey returns a copy of a key on the current layer
+func testKey(t *testing.T, app *App, keyID string) Key {
+	t.Helper()
+	app.mu.RLock()
+	defer app.mu.RUnlock()
+	activeProfile := app.profileManager.GetActiveProfile()
+	if activeProfile == nil || activeProfile.GetCurrentLayout() == nil {
+		t.Fatal("no current layout")
+	}
+	for _, key := range activeProfile.GetCurrentLayout().Layers[activeProfile.CurrentLayer] {
+		if key.ID == keyID {
+			return key.Clone()
+		}
+	}
+	t.Fatalf("key %s not found", keyID)
+	return Key{}
+}
+
+// setTestLabel changes the label of a key on the current layer through UpdateKey
+// and writes it out, which commits it
+func setTestLabel(t *testing.T, app *App, keyID, label string) {
+	t.Helper()
+	key := testKey(t, app, keyID)
+	key.Label = label
+	data, err := json.Marshal(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.UpdateKey(string(data)); err != nil {
+		t.Fatalf("UpdateKey: %v", err)
+	}
+	if err := app.writePendingProfiles(); err != nil {
+		t.Fatalf("writePendingProfiles: %v", err)
+	}
+}
+
+// testProfileID returns the ID of the active profile
+func testProfileID(app *App) string {
+	app.mu.RLock()
+	defer app.mu.RUnlock()
+	return app.profileManager.ActiveProfile
+}
+
+// pullTest pulls into app and returns the result
+func pullTest(t *testing.T, app *App, keep string) SyncResult {
+	t.Helper()
+	data, err := app.PullProfiles(keep)
+	if err != nil {
+		t.Fatalf("PullProfiles(%q): %v", keep, err)
+	}
+	var result SyncResult
+	if err := json.Unmarshal([]byte(data), &result); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+// setupSyncPair returns two apps sharing one profile through a bare remote
+func setupSyncPair(t *testing.T) (*App, *App) {
+	if !gitAvailable() {
+		t.Skip("git not available")
+	}
+	root := t.TempDir()
+	remote := filepath.Join(root, "remote.git")
+	runTestGit(t, root, "init", "-q", "--bare", remote)
+
+	first := newSyncTestApp(t, filepath.Join(root, "first"), remote)
+	if err := first.PushProfiles(); err != nil {
+		t.Fatalf("PushProfiles: %v", err)
+	}
+
+	runTestGit(t, root, "clone", "-q", "--branch", syncBranch, remote, filepath.Join(root, "second"))
+	second := newSyncTestApp(t, filepath.Join(root, "second"), remote)
+
+	if testProfileID(first) != testProfileID(second) {
+		t.Fatalf("second app didn't load the synced profile")
+	}
+	return first, second
+}
+
+func TestSyncFastForwards(t *testing.T) {
+	first, second := setupSyncPair(t)
+
+	setTestLabel(t, first, "L00", "Esc")
+	if err := first.PushProfiles(); err != nil {
+		t.Fatalf("PushProfiles: %v", err)
+	}
+
+	if result := pullTest(t, second, ""); result.Status != "fast-forward" {
+		t.Fatalf("status = %s, want fast-forward", result.Status)
+	}
+	if got := testKey(t, second, "L00").Label; got != "Esc" {
+		t.Errorf("remote change not pulled: L00 = %q", got)
+	}
+	if result := pullTest(t, second, ""); result.Status != "up-to-date" {
+		t.Errorf("second pull: status = %s, want up-to-date", result.Status)
+	}
+}
+
+func TestSyncMergesDifferentKeys(t *testing.T) {
+	first, second := setupSyncPair(t)
+
+	setTestLabel(t, first, "L00", "Esc")
+	if err := first.PushProfiles(); err != nil {
+		t.Fatalf("PushProfiles: %v", err)
+	}
+	setTestLabel(t, second, "L01", "Q")
+
+	if result := pullTest(t, second, ""); result.Status != "merged" {
+		t.Fatalf("status = %s, want merged (conflicts: %+v)", result.Status, result.Conflicts)
+	}
+	if got := testKey(t, second, "L00").Label; got != "Esc" {
+		t.Errorf("remote change not merged: L00 = %q", got)
+	}
+	if got := testKey(t, second, "L01").Label; got != "Q" {
+		t.Errorf("local change lost: L01 = %q", got)
+	}
+
+	if err := second.PushProfiles(); err != nil {
+		t.Fatalf("PushProfiles after merge: %v", err)
+	}
+	if result := pullTest(t, first, ""); result.Status != "fast-forward" {
+		t.Fatalf("status = %s, want fast-forward", result.Status)
+	}
+	if got := testKey(t, first, "L01").Label; got != "Q" {
+		t.Errorf("merge not pulled: L01 = %q", got)
+	}
+}
+
+func TestSyncReportsConflicts(t *testing.T) {
+	first, second := setupSyncPair(t)
+
+	setTestLabel(t, first, "L00", "Esc")
+	if err := first.PushProfiles(); err != nil {
+		t.Fatalf("PushProfiles: %v", err)
+	}
+	setTestLabel(t, second, "L00", "Tab")
+
+	// Pushing before pulling the other side's changes is refused
+	if err := second.PushProfiles(); err == nil {
+		t.Fatal("push of a diverged branch succeeded")
+	}
+
+	result := pullTest(t, second, "")
+	if result.Status != "conflict" || len(result.Conflicts) != 1 {
+		t.Fatalf("status = %s with %d conflicts, want one conflict", result.Status, len(result.Conflicts))
+	}
+	if conflict := result.Conflicts[0]; conflict.ProfileID != testProfileID(second) || len(conflict.Conflicts) == 0 {
+		t.Errorf("unexpected conflict: %+v", conflict)
+	}
+	if got := testKey(t, second, "L00").Label; got != "Tab" {
+		t.Errorf("abandoned merge changed L00 to %q", got)
+	}
+
+	if result := pullTest(t, second, "remote"); result.Status != "merged" || result.Kept != "remote" {
+		t.Fatalf("status = %s keeping %q, want merged keeping remote", result.Status, result.Kept)
+	}
+	if got := testKey(t, second, "L00").Label; got != "Esc" {
+		t.Errorf("remote version not kept: L00 = %q", got)
+	}
+}
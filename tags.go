@@ -0,0 +1,308 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Keys can carry free-form tags such as "git" or "window-mgmt". A KeyFilter picks
+// keys by tags, layout, layer, modifier combination and category across a whole
+// profile, so "just the git shortcuts" can be shown or exported from every layer at
+// once. Filters can be saved with the profile under a name.
+
+// KeyFilter selects keys of a profile. Empty fields don't limit it.
+type KeyFilter struct {
+	Tags     []string `json:"tags"`     // Keys must have all of these tags
+	AnyTag   bool     `json:"anyTag"`   // Keys need only one of the tags
+	Layout   string   `json:"layout"`   // Layout name
+	Layer    string   `json:"layer"`    // Layer name
+	Combo    string   `json:"combo"`    // A modifier combination such as "ctrl+shift", or "none" for keys without modifiers
+	Category string   `json:"category"` // Key category (see categories.go)
+}
+
+// SavedFilter is a key filter kept with a profile under a name
+type SavedFilter struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Filter    KeyFilter `json:"filter"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// KeyMatch is a key selected by a filter, with where it is
+type KeyMatch struct {
+	Layout string `json:"layout"`
+	Layer  string `json:"layer"`
+	Combo  string `json:"combo,omitempty"` // Empty for keys without modifiers
+	Key    Key    `json:"key"`
+}
+
+// TagCount is a key tag and how many keys have it
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// isEmpty reports whether the filter selects every key
+func (f KeyFilter) isEmpty() bool {
+	return len(f.Tags) == 0 && f.Layout == "" && f.Layer == "" && f.Combo == "" && f.Category == ""
+}
+
+// matchesKey reports whether a key has the filter's tags and category
+func (f KeyFilter) matchesKey(key *Key) bool {
+	if f.Category != "" && key.Category != f.Category {
+		return false
+	}
+	if len(f.Tags) == 0 {
+		return true
+	}
+	for _, tag := range f.Tags {
+		has := hasTag(key.Tags, tag)
+		if has && f.AnyTag {
+			return true
+		}
+		if !has && !f.AnyTag {
+			return false
+		}
+	}
+	return !f.AnyTag
+}
+
+// filterKeys returns the keys of a profile that match a filter, layout by layout
+// in the order of eachKey
+func filterKeys(profile *Profile, filter KeyFilter) []KeyMatch {
+	matches := []KeyMatch{}
+	scope := FindScope{Layer: filter.Layer, Combo: filter.Combo}
+	for i := range profile.Layouts {
+		layout := &profile.Layouts[i]
+		if filter.Layout != "" && layout.Name != filter.Layout {
+			continue
+		}
+		scope.eachKey(layout, func(layer, combo string, key *Key) {
+			if filter.matchesKey(key) {
+				matches = append(matches, KeyMatch{Layout: layout.Name, Layer: layer, Combo: combo, Key: key.Clone()})
+			}
+		})
+	}
+	return matches
+}
+
+// findSavedFilter returns the index of a saved filter of a profile
+func findSavedFilter(filters []SavedFilter, filterID string) (int, error) {
+	for i := range filters {
+		if filters[i].ID == filterID {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("saved filter not found: %s", filterID)
+}
+
+// cloneSavedFilters returns a deep copy of a profile's saved filters, preserving nil
+func cloneSavedFilters(filters []SavedFilter) []SavedFilter {
+	if filters == nil {
+		return nil
+	}
+	cloned := make([]SavedFilter, len(filters))
+	for i, filter := range filters {
+		filter.Filter.Tags = cloneStrings(filter.Filter.Tags)
+		cloned[i] = filter
+	}
+	return cloned
+}
+
+// SetKeyTags replaces the tags of a key on the current layer, in the active modifier
+// combination. tagsJSON is a list of tags.
+func (a *App) SetKeyTags(keyID, tagsJSON string) error {
+	var tags []string
+	if err := json.Unmarshal([]byte(tagsJSON), &tags); err != nil {
+		return fmt.Errorf("invalid tags: %v", err)
+	}
+	tags = normalizeTags(tags)
+	if len(tags) == 0 {
+		tags = nil
+	}
+
+	return a.editCurrentLayer(func(layout *KeyboardLayout, layer, combo string) error {
+		key := findKey(layout.keysFor(layer, combo, true), keyID)
+		if key == nil {
+			return fmt.Errorf("key %s not found", keyID)
+		}
+		key.Tags = tags
+		return nil
+	})
+}
+
+// GetKeyTags returns the tags used on the keys of the active profile, with how many
+// keys have each, alphabetically
+func (a *App) GetKeyTags() (string, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	activeProfile := a.profileManager.GetActiveProfile()
+	if activeProfile == nil {
+		return "", fmt.Errorf("no active profile available")
+	}
+
+	counts := make(map[string]int)
+	var tags []string
+	for i := range activeProfile.Layouts {
+		eachLayoutKey(&activeProfile.Layouts[i], func(key *Key) {
+			for _, tag := range key.Tags {
+				name := strings.ToLower(tag)
+				if _, seen := counts[name]; !seen {
+					tags = append(tags, tag)
+				}
+				counts[name]++
+			}
+		})
+	}
+	sort.Slice(tags, func(i, j int) bool { return strings.ToLower(tags[i]) < strings.ToLower(tags[j]) })
+
+	result := make([]TagCount, len(tags))
+	for i, tag := range tags {
+		result[i] = TagCount{Tag: tag, Count: counts[strings.ToLower(tag)]}
+	}
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal key tags: %v", err)
+	}
+	return string(data), nil
+}
+
+// GetKeysByFilter returns the keys of the active profile that match a filter, in all
+// its layouts and layers. filterJSON is a KeyFilter.
+func (a *App) GetKeysByFilter(filterJSON string) (string, error) {
+	var filter KeyFilter
+	if err := json.Unmarshal([]byte(filterJSON), &filter); err != nil {
+		return "", fmt.Errorf("invalid key filter: %v", err)
+	}
+	filter.Tags = normalizeTags(filter.Tags)
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	activeProfile := a.profileManager.GetActiveProfile()
+	if activeProfile == nil {
+		return "", fmt.Errorf("no active profile available")
+	}
+	return marshalKeyMatches(filterKeys(activeProfile, filter))
+}
+
+// GetKeysBySavedFilter returns the keys of the active profile that match one of its
+// saved filters
+func (a *App) GetKeysBySavedFilter(filterID string) (string, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	activeProfile := a.profileManager.GetActiveProfile()
+	if activeProfile == nil {
+		return "", fmt.Errorf("no active profile available")
+	}
+	index, err := findSavedFilter(activeProfile.SavedFilters, filterID)
+	if err != nil {
+		return "", err
+	}
+	return marshalKeyMatches(filterKeys(activeProfile, activeProfile.SavedFilters[index].Filter))
+}
+
+// GetSavedFilters returns the saved filters of the active profile
+func (a *App) GetSavedFilters() (string, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	activeProfile := a.profileManager.GetActiveProfile()
+	if activeProfile == nil {
+		return "", fmt.Errorf("no active profile available")
+	}
+	filters := activeProfile.SavedFilters
+	if filters == nil {
+		filters = []SavedFilter{}
+	}
+	data, err := json.MarshalIndent(filters, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal saved filters: %v", err)
+	}
+	return string(data), nil
+}
+
+// SaveKeyFilter saves a filter with the active profile and returns it with its ID.
+// A filter with the ID of a saved one replaces it. filterJSON is a SavedFilter.
+func (a *App) SaveKeyFilter(filterJSON string) (string, error) {
+	var saved SavedFilter
+	if err := json.Unmarshal([]byte(filterJSON), &saved); err != nil {
+		return "", fmt.Errorf("invalid saved filter: %v", err)
+	}
+	saved.Name = strings.TrimSpace(saved.Name)
+	if saved.Name == "" {
+		return "", fmt.Errorf("filter name cannot be empty")
+	}
+	saved.Filter.Tags = normalizeTags(saved.Filter.Tags)
+	if saved.Filter.isEmpty() {
+		return "", fmt.Errorf("filter must limit the keys by at least one tag, layout, layer, combination or category")
+	}
+
+	a.lock()
+	defer a.unlock()
+
+	activeProfile := a.profileManager.GetActiveProfile()
+	if activeProfile == nil {
+		return "", fmt.Errorf("no active profile available")
+	}
+
+	now := time.Now()
+	if saved.ID == "" {
+		saved.ID = fmt.Sprintf("filter_%d", now.UnixNano())
+		saved.CreatedAt = now
+		activeProfile.SavedFilters = append(activeProfile.SavedFilters, saved)
+	} else {
+		index, err := findSavedFilter(activeProfile.SavedFilters, saved.ID)
+		if err != nil {
+			return "", err
+		}
+		saved.CreatedAt = activeProfile.SavedFilters[index].CreatedAt
+		activeProfile.SavedFilters[index] = saved
+	}
+
+	activeProfile.ModifiedAt = now
+	a.requestSave(activeProfile.ID)
+
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal saved filter: %v", err)
+	}
+	return string(data), nil
+}
+
+// DeleteSavedFilter removes a saved filter from the active profile
+func (a *App) DeleteSavedFilter(filterID string) error {
+	a.lock()
+	defer a.unlock()
+
+	activeProfile := a.profileManager.GetActiveProfile()
+	if activeProfile == nil {
+		return fmt.Errorf("no active profile available")
+	}
+	index, err := findSavedFilter(activeProfile.SavedFilters, filterID)
+	if err != nil {
+		return err
+	}
+	activeProfile.SavedFilters = append(activeProfile.SavedFilters[:index], activeProfile.SavedFilters[index+1:]...)
+	if len(activeProfile.SavedFilters) == 0 {
+		activeProfile.SavedFilters = nil
+	}
+
+	activeProfile.ModifiedAt = time.Now()
+	a.requestSave(activeProfile.ID)
+	return nil
+}
+
+// marshalKeyMatches returns the keys selected by a filter as JSON
+func marshalKeyMatches(matches []KeyMatch) (string, error) {
+	data, err := json.MarshalIndent(matches, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal keys: %v", err)
+	}
+	return string(data), nil
+}
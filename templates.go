@@ -0,0 +1,281 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Templates are snapshots of a profile's layouts and settings that new profiles can
+// start from. Each is stored as templates/<id>.json in the configuration directory
+// and written straight away rather than through the background writer.
+
+// ProfileTemplate is a saved starting point for new profiles
+type ProfileTemplate struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"createdAt"`
+	Profile     Profile   `json:"profile"` // Layouts and settings copied into new profiles
+}
+
+// TemplateSummary describes a template without its layouts
+type TemplateSummary struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"createdAt"`
+	Layouts     []string  `json:"layouts"`
+}
+
+// DuplicateProfile creates a copy of a profile, including its layouts and images,
+// under a new name
+func (a *App) DuplicateProfile(profileID, newName string) (string, error) {
+	a.lock()
+	defer a.unlock()
+
+	if err := a.checkNewProfileName(newName); err != nil {
+		return "", err
+	}
+
+	source := a.profileManager.GetProfile(profileID)
+	if source == nil {
+		return "", fmt.Errorf("profile not found: %s", profileID)
+	}
+	if err := a.ensureProfileLoaded(source); err != nil {
+		return "", err
+	}
+	// Loading may quarantine profiles, so look it up again
+	if source = a.profileManager.GetProfile(profileID); source == nil {
+		return "", fmt.Errorf("profile not found: %s", profileID)
+	}
+
+	newProfile := source.Clone()
+	newProfile.ID = fmt.Sprintf("profile_%d", time.Now().UnixNano())
+	newProfile.Name = newName
+	newProfile.CreatedAt = time.Now()
+	newProfile.ModifiedAt = newProfile.CreatedAt
+
+	a.profileManager.AddProfile(newProfile)
+	a.notifyProfileChanged(newProfile.ID, "created")
+	a.requestSave(newProfile.ID)
+
+	return newProfile.ToJSON()
+}
+
+// SaveProfileAsTemplate stores a copy of a profile as a template and returns its summary
+func (a *App) SaveProfileAsTemplate(profileID, name, description string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fmt.Errorf("template name cannot be empty")
+	}
+
+	a.lock()
+	source := a.profileManager.GetProfile(profileID)
+	if source == nil {
+		a.unlock()
+		return "", fmt.Errorf("profile not found: %s", profileID)
+	}
+	if err := a.ensureProfileLoaded(source); err != nil {
+		a.unlock()
+		return "", err
+	}
+	// Loading may quarantine profiles, so look it up again
+	if source = a.profileManager.GetProfile(profileID); source == nil {
+		a.unlock()
+		return "", fmt.Errorf("profile not found: %s", profileID)
+	}
+	snapshot := source.Clone()
+	a.unlock()
+
+	// The profile's identity and view state don't belong in a template
+	snapshot.ID = ""
+	snapshot.Name = ""
+	snapshot.Icon = ""
+	snapshot.ActiveModifiers = []string{}
+	snapshot.Parent = "" // The template holds the resolved layouts
+
+	template := ProfileTemplate{
+		ID:          fmt.Sprintf("template_%d", time.Now().UnixNano()),
+		Name:        name,
+		Description: description,
+		CreatedAt:   time.Now(),
+		Profile:     snapshot,
+	}
+
+	templatePath, err := a.getTemplatePath(template.ID)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(templatePath), 0755); err != nil {
+		return "", fmt.Errorf("failed to create templates directory: %v", err)
+	}
+	data, err := json.MarshalIndent(template, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal template: %v", err)
+	}
+	if err := writeFileAtomic(templatePath, data, 0644); err != nil {
+		return "", err
+	}
+
+	data, err = json.MarshalIndent(template.Summary(), "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// GetProfileTemplates returns the saved templates, newest first
+func (a *App) GetProfileTemplates() (string, error) {
+	templatesDir, err := a.getTemplatesDir()
+	if err != nil {
+		return "", err
+	}
+
+	summaries := []TemplateSummary{}
+	entries, err := os.ReadDir(templatesDir)
+	if err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("failed to read templates directory: %v", err)
+	}
+	for _, entry := range entries {
+		templateID := strings.TrimSuffix(entry.Name(), ".json")
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") || !isValidProfileID(templateID) {
+			continue
+		}
+		template, err := a.loadTemplate(templateID)
+		if err != nil {
+			fmt.Printf("Warning: Skipping template %s: %v\n", entry.Name(), err)
+			continue
+		}
+		summaries = append(summaries, template.Summary())
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].CreatedAt.After(summaries[j].CreatedAt)
+	})
+
+	data, err := json.MarshalIndent(summaries, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// CreateProfileFromTemplate creates a new profile starting from a template's layouts and settings
+func (a *App) CreateProfileFromTemplate(templateID, name string) (string, error) {
+	template, err := a.loadTemplate(templateID)
+	if err != nil {
+		return "", err
+	}
+
+	a.lock()
+	defer a.unlock()
+
+	if err := a.checkNewProfileName(name); err != nil {
+		return "", err
+	}
+
+	newProfile := template.Profile.Clone()
+	newProfile.ID = fmt.Sprintf("profile_%d", time.Now().UnixNano())
+	newProfile.Name = name
+	newProfile.CreatedAt = time.Now()
+	newProfile.ModifiedAt = newProfile.CreatedAt
+	repairProfile(&newProfile)
+
+	a.profileManager.AddProfile(newProfile)
+	a.notifyProfileChanged(newProfile.ID, "created")
+	a.requestSave(newProfile.ID)
+
+	return newProfile.ToJSON()
+}
+
+// DeleteProfileTemplate removes a template. Profiles created from it are not affected.
+func (a *App) DeleteProfileTemplate(templateID string) error {
+	templatePath, err := a.getTemplatePath(templateID)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(templatePath); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("template not found: %s", templateID)
+		}
+		return fmt.Errorf("failed to delete template: %v", err)
+	}
+	return nil
+}
+
+// Summary returns the template's metadata and layout names
+func (t *ProfileTemplate) Summary() TemplateSummary {
+	summary := TemplateSummary{
+		ID:          t.ID,
+		Name:        t.Name,
+		Description: t.Description,
+		CreatedAt:   t.CreatedAt,
+		Layouts:     []string{},
+	}
+	for _, layout := range t.Profile.Layouts {
+		summary.Layouts = append(summary.Layouts, layout.Name)
+	}
+	return summary
+}
+
+// loadTemplate reads a template from disk
+func (a *App) loadTemplate(templateID string) (*ProfileTemplate, error) {
+	templatePath, err := a.getTemplatePath(templateID)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(templatePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("template not found: %s", templateID)
+		}
+		return nil, fmt.Errorf("failed to read template: %v", err)
+	}
+
+	var template ProfileTemplate
+	if err := json.Unmarshal(data, &template); err != nil {
+		return nil, fmt.Errorf("template %s corrupted: %v", templateID, err)
+	}
+	template.ID = templateID
+	return &template, nil
+}
+
+// getTemplatesDir returns the directory holding profile templates
+func (a *App) getTemplatesDir() (string, error) {
+	configPath, err := a.getConfigFilePath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(configPath), "templates"), nil
+}
+
+// getTemplatePath returns the file for a template, rejecting IDs that aren't safe file names
+func (a *App) getTemplatePath(templateID string) (string, error) {
+	if !isValidProfileID(templateID) {
+		return "", fmt.Errorf("invalid template ID: %q", templateID)
+	}
+	templatesDir, err := a.getTemplatesDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(templatesDir, templateID+".json"), nil
+}
+
+// checkNewProfileName rejects empty names and names already in use.
+// The caller must hold the lock.
+func (a *App) checkNewProfileName(name string) error {
+	if name == "" {
+		return fmt.Errorf("profile name cannot be empty")
+	}
+	for _, profile := range a.profileManager.Profiles {
+		if profile.Name == name {
+			return fmt.Errorf("profile with name '%s' already exists", name)
+		}
+	}
+	return nil
+}
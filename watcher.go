@@ -0,0 +1,365 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// The watcher polls the index and profile files for changes made by other programs
+// (scripts, a dotfiles checkout, a text editor). Files written by the app itself are
+// recognised by content hash. A changed profile is reloaded when it has no unsaved
+// in-memory edits; otherwise the change is refused and recorded as a conflict, and
+// writes of that profile are held back until ResolveProfileConflict is called.
+
+// watchInterval is how often the profile files are checked for external changes
+const watchInterval = time.Second
+
+// fileStamp identifies the last known version of a watched file
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+	hash    [sha256.Size]byte
+}
+
+// ProfileConflict describes an external change that was refused because of unsaved edits
+type ProfileConflict struct {
+	ProfileID   string    `json:"profileId"`
+	ProfileName string    `json:"profileName"`
+	Path        string    `json:"path"`
+	Deleted     bool      `json:"deleted"` // The file was removed rather than modified
+	DetectedAt  time.Time `json:"detectedAt"`
+}
+
+// externalChange is a watched file whose content changed outside the app
+type externalChange struct {
+	path    string
+	data    []byte
+	deleted bool
+}
+
+// startWatcher records the current state of the profile files and starts polling them
+func (a *App) startWatcher() {
+	a.writeMu.Lock()
+	a.scanExternalChanges()
+	a.writeMu.Unlock()
+
+	go a.watchLoop()
+}
+
+// stopWatcher stops the polling loop and waits for it to exit
+func (a *App) stopWatcher() {
+	select {
+	case <-a.watchStop:
+		// Already stopped
+	default:
+		close(a.watchStop)
+	}
+	<-a.watchDone
+}
+
+// watchLoop polls for external changes until stopped
+func (a *App) watchLoop() {
+	defer close(a.watchDone)
+
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			a.pollExternalChanges()
+		case <-a.watchStop:
+			return
+		}
+	}
+}
+
+// pollExternalChanges applies changes made to the profile files by other programs
+func (a *App) pollExternalChanges() {
+	// Holding writeMu keeps the app's own writes from being mistaken for external ones
+	a.writeMu.Lock()
+	defer a.writeMu.Unlock()
+
+	changes := a.scanExternalChanges()
+	if len(changes) == 0 {
+		return
+	}
+
+	a.lock()
+	defer a.unlock()
+
+	for _, change := range changes {
+		a.applyExternalChange(change)
+	}
+}
+
+// watchedFiles lists the index and every profile file currently on disk
+func (a *App) watchedFiles() []string {
+	var paths []string
+
+	if indexPath, err := a.getIndexFilePath(); err == nil {
+		paths = append(paths, indexPath)
+	}
+
+	profilesDir, err := a.getProfilesDir()
+	if err != nil {
+		return paths
+	}
+	entries, err := os.ReadDir(profilesDir)
+	if err != nil {
+		return paths
+	}
+	for _, entry := range entries {
+		profileID := strings.TrimSuffix(entry.Name(), ".json")
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") || !isValidProfileID(profileID) {
+			continue
+		}
+		paths = append(paths, filepath.Join(profilesDir, entry.Name()))
+	}
+
+	return paths
+}
+
+// scanExternalChanges compares the watched files to their last known stamps and returns
+// those whose content changed. The caller must hold writeMu.
+func (a *App) scanExternalChanges() []externalChange {
+	var changes []externalChange
+
+	seen := make(map[string]bool)
+	for _, path := range a.watchedFiles() {
+		seen[path] = true
+
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		known, isKnown := a.knownFiles[path]
+		if isKnown && known.modTime.Equal(info.ModTime()) && known.size == info.Size() {
+			continue
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		stamp := fileStamp{modTime: info.ModTime(), size: info.Size(), hash: sha256.Sum256(data)}
+		a.knownFiles[path] = stamp
+
+		// Touched but unchanged, or seen for the first time at startup
+		if (isKnown && known.hash == stamp.hash) || !a.watching {
+			continue
+		}
+		changes = append(changes, externalChange{path: path, data: data})
+	}
+
+	for path := range a.knownFiles {
+		if !seen[path] {
+			delete(a.knownFiles, path)
+			changes = append(changes, externalChange{path: path, deleted: true})
+		}
+	}
+
+	a.watching = true
+	return changes
+}
+
+// recordFileStamp remembers a file the app has just written so the watcher ignores it.
+// The caller must hold writeMu.
+func (a *App) recordFileStamp(path string, data []byte) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	a.knownFiles[path] = fileStamp{modTime: info.ModTime(), size: info.Size(), hash: sha256.Sum256(data)}
+}
+
+// forgetFileStamp stops tracking a file the app has just removed.
+// The caller must hold writeMu.
+func (a *App) forgetFileStamp(path string) {
+	delete(a.knownFiles, path)
+}
+
+// applyExternalChange merges one externally changed file into memory.
+// The caller must hold writeMu and the write lock.
+func (a *App) applyExternalChange(change externalChange) {
+	if indexPath, err := a.getIndexFilePath(); err == nil && change.path == indexPath {
+		if !change.deleted {
+			a.applyExternalIndex(change.data)
+		}
+		return
+	}
+
+	profileID := strings.TrimSuffix(filepath.Base(change.path), ".json")
+	profile := a.profileManager.GetProfile(profileID)
+
+	// Unsaved local edits win until the user decides
+	if profile != nil && a.dirtyProfiles[profileID] {
+		conflict := ProfileConflict{
+			ProfileID:   profileID,
+			ProfileName: profile.Name,
+			Path:        change.path,
+			Deleted:     change.deleted,
+			DetectedAt:  time.Now(),
+		}
+		a.profileConflicts[profileID] = conflict
+		fmt.Printf("Warning: Profile %s changed on disk while it has unsaved edits; keeping local version until resolved\n", profile.Name)
+		a.notify(EventProfileConflict, conflict)
+		return
+	}
+
+	if change.deleted {
+		if profile == nil || len(a.profileManager.Profiles) <= 1 {
+			return
+		}
+		if err := a.detachChildren(profileID); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+		if err := a.profileManager.DeleteProfile(profileID); err == nil {
+			if err := a.ensureActiveProfileLoaded(); err != nil {
+				fmt.Printf("Warning: %v\n", err)
+			}
+			a.notifyProfileChanged(profileID, "external")
+			a.requestSave()
+		}
+		return
+	}
+
+	parsed, err := parseProfileData(profileID, change.data)
+	if err != nil {
+		// Likely a half-finished edit; keep what is in memory and wait for the next change
+		fmt.Printf("Warning: Ignoring external change to %s: %v\n", change.path, err)
+		return
+	}
+	a.loadStoredImages(parsed)
+	if profile != nil && profile.IsLoaded() {
+		if err := a.resolveInheritedLayouts(parsed); err != nil {
+			fmt.Printf("Warning: Ignoring external change to %s: %v\n", change.path, err)
+			return
+		}
+		profile = a.profileManager.GetProfile(profileID)
+		if profile == nil {
+			return
+		}
+	}
+	repairProfile(parsed)
+
+	switch {
+	case profile == nil:
+		// A profile added by another program; keep it lazy like the rest
+		a.profileManager.AddProfile(profileStub(parsed.Summary()))
+	case !profile.IsLoaded():
+		*profile = profileStub(parsed.Summary())
+		delete(a.profileLoadErrors, profileID)
+	default:
+		*profile = *parsed
+		a.resolveChildren(profileID, 0)
+	}
+
+	// Only the index needs rewriting; the profile file already holds the new data
+	delete(a.profileConflicts, profileID)
+	a.requestSave()
+	a.notifyProfileChanged(profileID, "external")
+}
+
+// applyExternalIndex takes the active profile, ordering and shared palette from an externally edited index,
+// adding any profiles it references that have a file but aren't known yet.
+// The caller must hold writeMu and the write lock.
+func (a *App) applyExternalIndex(data []byte) {
+	var index ProfileIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		fmt.Printf("Warning: Ignoring external change to profile index: %v\n", err)
+		return
+	}
+
+	ordered := make([]Profile, 0, len(a.profileManager.Profiles))
+	placed := make(map[string]bool)
+	for _, summary := range index.Profiles {
+		if placed[summary.ID] {
+			continue
+		}
+		if existing := a.profileManager.GetProfile(summary.ID); existing != nil {
+			ordered = append(ordered, *existing)
+			placed[summary.ID] = true
+			continue
+		}
+		if profilePath, err := a.getProfileDataPath(summary.ID); err == nil {
+			if _, err := os.Stat(profilePath); err == nil {
+				ordered = append(ordered, profileStub(summary))
+				placed[summary.ID] = true
+			}
+		}
+	}
+	for _, profile := range a.profileManager.Profiles {
+		if !placed[profile.ID] {
+			ordered = append(ordered, profile)
+		}
+	}
+	a.profileManager.Profiles = ordered
+	a.profileManager.Palette = index.Palette
+
+	if index.ActiveProfile != a.profileManager.ActiveProfile {
+		if profile := a.profileManager.GetProfile(index.ActiveProfile); profile != nil && a.ensureProfileLoaded(profile) == nil {
+			a.profileManager.ActiveProfile = index.ActiveProfile
+		}
+	}
+
+	a.notifyProfileChanged(a.profileManager.ActiveProfile, "external")
+}
+
+// GetProfileConflicts returns external changes that were refused because of unsaved edits
+func (a *App) GetProfileConflicts() (string, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	conflicts := make([]ProfileConflict, 0, len(a.profileConflicts))
+	for _, conflict := range a.profileConflicts {
+		conflicts = append(conflicts, conflict)
+	}
+
+	data, err := json.MarshalIndent(conflicts, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// ResolveProfileConflict settles a refused external change. "local" keeps the in-memory
+// profile and overwrites the file; "external" discards local edits and loads the file.
+func (a *App) ResolveProfileConflict(profileID, resolution string) error {
+	a.writeMu.Lock()
+	defer a.writeMu.Unlock()
+
+	a.lock()
+	defer a.unlock()
+
+	conflict, exists := a.profileConflicts[profileID]
+	if !exists {
+		return fmt.Errorf("no conflict recorded for profile %s", profileID)
+	}
+
+	switch resolution {
+	case "local":
+		delete(a.profileConflicts, profileID)
+		a.requestSave(profileID)
+		return nil
+	case "external":
+		delete(a.dirtyProfiles, profileID)
+		delete(a.profileConflicts, profileID)
+
+		data, err := os.ReadFile(conflict.Path)
+		if err != nil {
+			a.applyExternalChange(externalChange{path: conflict.Path, deleted: true})
+			return nil
+		}
+		a.recordFileStamp(conflict.Path, data)
+		a.applyExternalChange(externalChange{path: conflict.Path, data: data})
+		return nil
+	default:
+		return fmt.Errorf("invalid resolution %q (must be 'local' or 'external')", resolution)
+	}
+}